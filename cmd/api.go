@@ -16,9 +16,15 @@ import (
 	"github.com/go-chi/cors"
 	cli "github.com/spf13/cobra"
 	temporal "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
 
 	"github.com/yegor86/tumbler-doll/internal/api/v1/handler"
 	"github.com/yegor86/tumbler-doll/internal/grpc"
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+	"github.com/yegor86/tumbler-doll/internal/nodes"
+	"github.com/yegor86/tumbler-doll/internal/queue"
+	"github.com/yegor86/tumbler-doll/internal/triggers"
+	"github.com/yegor86/tumbler-doll/internal/workflow"
 )
 
 func init() {
@@ -47,9 +53,71 @@ var (
 			router.Get("/upload", handler.UploadForm)
 			router.Get("/jobs", handler.ListJobs("/"))
 			router.Get("/jobs/*", handler.ListJobs("/"))
-			router.Post("/submit/*", handler.SubmitJob(wfClient))
+			// builds of jobs go through the queue
+			buildQueue := queue.New(queue.Options{
+				QuietPeriod:     time.Duration(config.Queue.QuietPeriod) * time.Second,
+				MaxBuilds:       config.Queue.MaxBuilds,
+				MaxBuildsPerJob: config.Queue.MaxBuildsPerJob,
+			})
+			// cron, pollSCM and upstream triggers feed the same queue
+			// the builds trigger the jobs downstream of them via BuildCompletedActivity
+			dispatcher := triggers.NewDispatcher(wfClient, buildQueue, config.Triggers.TimeZone)
+			queueCtx, stopQueue := context.WithCancel(context.Background())
+			defer stopQueue()
+			go buildQueue.Run(queueCtx)
+
+			triggerWorker := worker.New(wfClient, triggers.TaskQueue, worker.Options{})
+			triggerWorker.RegisterWorkflow(triggers.TriggerWorkflow)
+			triggerWorker.RegisterActivity(&triggers.Activities{Dispatcher: dispatcher})
+			if err := triggerWorker.Start(); err != nil {
+				log.Fatalf("Unable to start trigger worker: %v", err)
+			}
+			defer triggerWorker.Stop()
+
+			// workers report the status of their nodes to the registry, which routes the stages with a label
+			nodesWorker := worker.New(wfClient, nodes.TaskQueue, worker.Options{})
+			nodesWorker.RegisterWorkflow(nodes.RegistryWorkflow)
+			nodesWorker.RegisterActivity(&nodes.Activities{WfClient: wfClient})
+			if err := nodesWorker.Start(); err != nil {
+				log.Fatalf("Unable to start nodes worker: %v", err)
+			}
+			defer nodesWorker.Stop()
+
+			// the builds leave their secrets with the API, the stages get them encrypted and they're deleted
+			// when the builds complete
+			controllerWorker := worker.New(wfClient, workflow.ControllerTaskQueue, worker.Options{})
+			controllerWorker.RegisterActivity(&workflow.ControllerActivities{})
+			if err := controllerWorker.Start(); err != nil {
+				log.Fatalf("Unable to start controller worker: %v", err)
+			}
+			defer controllerWorker.Stop()
+
+			jobDb := jobs.GetInstance()
+			jobDb.OnLoad(func(root *jobs.Job) {
+				if err := dispatcher.Sync(context.Background(), root); err != nil {
+					log.Printf("Failed to register job triggers: %v", err)
+				}
+			})
+			// the jobs were loaded before the triggers could be registered
+			if _, err := jobDb.LoadJobs(); err != nil {
+				log.Printf("Failed to reload jobs: %v", err)
+			}
+
+			router.Post("/submit/*", handler.SubmitJob(wfClient, buildQueue))
 			router.Post("/uploadfile", handler.UploadFile(wfClient))
 			router.HandleFunc("/stream/*", handler.ReadLogs(wfClient))
+			router.Post("/api/v1/pipeline/validate", handler.ValidatePipeline(declarePlugins()))
+			router.Get("/api/v1/builds/{id}/state", handler.GetBuildState(wfClient))
+			router.Post("/api/v1/builds/{id}/abort", handler.SignalBuild(wfClient, workflow.AbortSignal))
+			router.Post("/api/v1/builds/{id}/pause", handler.SignalBuild(wfClient, workflow.PauseSignal))
+			router.Post("/api/v1/builds/{id}/resume", handler.SignalBuild(wfClient, workflow.ResumeSignal))
+			router.Post("/api/v1/builds/{id}/input", handler.RespondToInput(wfClient))
+			router.Post("/api/v1/builds/{id}/restart", handler.RestartBuild(wfClient))
+			router.Get("/api/v1/jobs/*", handler.BuildHistory())
+			router.Get("/api/v1/nodes", handler.ListNodes(wfClient))
+			router.Get("/api/v1/queue", handler.ListQueue(buildQueue))
+			router.Get("/api/v1/queue/{id}", handler.GetQueueItem(buildQueue))
+			router.Delete("/api/v1/queue/{id}", handler.CancelQueueItem(buildQueue))
 
 			var wg sync.WaitGroup
         	wg.Add(2)
@@ -113,6 +181,11 @@ func newRouter() (chi.Router, error) {
 		// router.Use(logger.LoggerStandardMiddleware(log.Logger.With("context", "server"), loggerConfig))
 	}
 
+	// the users are authenticated by the reverse proxy in front of the API
+	if config.Server.Auth.UserHeader != "" {
+		router.Use(handler.RemoteUser(config.Server.Auth.UserHeader))
+	}
+
 	// CORS handler
 	if config.Server.CORS.Enabled {
 		var corsOptions cors.Options
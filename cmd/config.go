@@ -33,6 +33,30 @@ type Config struct {
 		Pidfile string `yaml:"pidfile"`
 	} `yaml:"profiler"`
 
+	// Queue limits, zero means no limit
+	Queue struct {
+		// QuietPeriod is in seconds, requests for the same build within it are collapsed
+		QuietPeriod     int `yaml:"quietPeriod"`
+		MaxBuilds       int `yaml:"maxBuilds"`
+		MaxBuildsPerJob int `yaml:"maxBuildsPerJob"`
+	} `yaml:"queue"`
+
+	Triggers struct {
+		// TimeZone is the IANA name of the time zone the cron and pollSCM specs are read in, UTC when empty
+		TimeZone string `yaml:"timeZone"`
+	} `yaml:"triggers"`
+
+	// Agent is the node a worker runs as, the labels and executors which aren't set
+	// are read from JENKINS_HOME/nodes/<name>/config.xml
+	Agent struct {
+		// Name defaults to the host name
+		Name      string   `yaml:"name"`
+		Labels    []string `yaml:"labels"`
+		Executors int      `yaml:"executors"`
+		// Engine runs the containers of the docker agents: docker, podman or containerd
+		Engine string `yaml:"engine"`
+	} `yaml:"agent"`
+
 	Server struct {
 		Host     string `yaml:"host"`
 		Port     string `yaml:"port"`
@@ -62,6 +86,11 @@ type Config struct {
 			Enabled     bool     `yaml:"enabled"`
 			IgnorePaths []string `yaml:"ignore_paths"`
 		} `yaml:"metrics"`
+
+		// Auth names the header the authenticating reverse proxy passes the user in
+		Auth struct {
+			UserHeader string `yaml:"user_header"`
+		} `yaml:"auth"`
 	} `yaml:"server"`
 }
 
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	cli "github.com/spf13/cobra"
+
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+type lintResult struct {
+	File   string               `json:"file"`
+	Valid  bool                 `json:"valid"`
+	Errors workflow.Diagnostics `json:"errors"`
+}
+
+var lintFormat string
+
+func init() {
+	lintCmd.Flags().StringVar(&lintFormat, "format", "json", "output format: json or text")
+	rootCmd.AddCommand(lintCmd)
+}
+
+var (
+	lintCmd = &cli.Command{
+		Use:   "lint <Jenkinsfile>...",
+		Short: "Validate Jenkinsfiles",
+		Long:  `Parse Jenkinsfiles and check them for unknown steps, missing step parameters and invalid stages. Exits with status 1 if any of them is invalid.`,
+		Args:  cli.MinimumNArgs(1),
+		// the Jenkinsfiles are all it reads
+		Annotations: map[string]string{withoutJobs: "true"},
+		// the diagnostics are the output, Execute prints the error
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cli.Command, args []string) error {
+			if lintFormat != "json" && lintFormat != "text" {
+				return fmt.Errorf("unknown format %q", lintFormat)
+			}
+			pluginManager := declarePlugins()
+			isStep := func(step string) bool {
+				_, _, ok := pluginManager.GetPluginInfo(step)
+				return ok
+			}
+
+			var dslParser workflow.DslParser
+			results := make([]lintResult, 0, len(args))
+			valid := true
+			for _, fileName := range args {
+				data, err := os.ReadFile(fileName)
+				if err != nil {
+					return err
+				}
+				diagnostics := dslParser.Validate(fileName, string(data), isStep)
+				valid = valid && len(diagnostics) == 0
+				results = append(results, lintResult{
+					File:   fileName,
+					Valid:  len(diagnostics) == 0,
+					Errors: diagnostics,
+				})
+			}
+
+			if lintFormat == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(results); err != nil {
+					return err
+				}
+			} else {
+				// one file:line:column: message per line, like compilers do
+				for _, result := range results {
+					for _, diagnostic := range result.Errors {
+						fmt.Println(diagnostic.Error())
+					}
+				}
+			}
+
+			if !valid {
+				return errors.New("invalid Jenkinsfile")
+			}
+			return nil
+		},
+	}
+)
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	cli "github.com/spf13/cobra"
+	temporal "go.temporal.io/sdk/client"
+
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+var restartCmd = &cli.Command{
+	Use:   "restart <workflowId> <stage>",
+	Short: "Restart a finished build from a stage",
+	Long: `Start a new build with the pipeline and the parameters of a finished one.
+The stages before the given top-level stage are skipped and keep the results of the finished build.`,
+	Args: cli.ExactArgs(2),
+	Run: func(cmd *cli.Command, args []string) {
+		wfClient, ok := cmd.Context().Value("wfClient").(temporal.Client)
+		if !ok {
+			log.Fatalf("Failed to obtain temporal client")
+		}
+		we, err := workflow.RestartBuild(wfClient, args[0], args[1])
+		if err != nil {
+			log.Fatalf("Unable to restart build %s: %v", args[0], err)
+		}
+		fmt.Printf("Started workflow: WorkflowID=%s, RunID=%s\n", we.GetID(), we.GetRunID())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restartCmd)
+}
@@ -8,6 +8,8 @@ import (
 	cli "github.com/spf13/cobra"
 	temporal "go.temporal.io/sdk/client"
 	"golang.org/x/net/context"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
 )
 
 func init() {
@@ -23,13 +25,28 @@ var (
 	rootCmd = &cli.Command{
 		Version: GitVersion,
 		Use:     Executable,
+		PersistentPreRunE: func(cmd *cli.Command, args []string) error {
+			if cmd.Annotations[withoutJobs] != "" {
+				return nil
+			}
+			loaded, err := jobs.GetInstance().LoadJobs()
+			if err != nil {
+				return err
+			}
+			log.Printf("Jobs: %v", loaded)
+			return nil
+		},
 	}
 )
 
+// withoutJobs annotates the commands which don't need the jobs of JENKINS_HOME, e.g. lint
+const withoutJobs = "withoutJobs"
+
 // Execute starts the program
 func Execute(client temporal.Client) {
 	ctx := context.WithValue(context.Background(), "wfClient", client)
 	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
 	}
 }
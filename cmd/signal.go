@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	cli "github.com/spf13/cobra"
+	temporal "go.temporal.io/sdk/client"
+
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+// Build control commands, e.g. abort <workflowId>
+func init() {
+	for signal, description := range map[string]string{
+		workflow.AbortSignal:  "Abort a running build",
+		workflow.PauseSignal:  "Pause a running build before its next step",
+		workflow.ResumeSignal: "Resume a paused build",
+	} {
+		rootCmd.AddCommand(&cli.Command{
+			Use:   signal + " <workflowId>",
+			Short: description,
+			Long:  description + `. The workflow id is the one returned on submit, e.g. my-job/<uuid>`,
+			Args:  cli.ExactArgs(1),
+			Run: func(cmd *cli.Command, args []string) {
+				wfClient, ok := cmd.Context().Value("wfClient").(temporal.Client)
+				if !ok {
+					log.Fatalf("Failed to obtain temporal client")
+				}
+				if err := workflow.SignalBuild(wfClient, args[0], signal); err != nil {
+					log.Fatalf("Unable to %s build %s: %v", signal, args[0], err)
+				}
+				fmt.Printf("Sent %s signal to %s\n", signal, args[0])
+			},
+		})
+	}
+}
@@ -12,6 +12,9 @@ import (
 
 	cli "github.com/spf13/cobra"
 
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+	"github.com/yegor86/tumbler-doll/internal/nodes"
+	"github.com/yegor86/tumbler-doll/internal/triggers"
 	"github.com/yegor86/tumbler-doll/internal/workflow"
 	"github.com/yegor86/tumbler-doll/plugins"
 	"github.com/yegor86/tumbler-doll/plugins/docker"
@@ -36,15 +39,10 @@ var (
 			pluginManager := plugins.GetInstance()
 			defer pluginManager.UnregisterAll()
 
-			plugins := map[string]plugins.Plugin{
-				"scm":   &scm.ScmPlugin{},
-				"shell": &shell.ShellPlugin{},
-				"docker": &docker.DockerPlugin{},
-			}
-			
 			ctx := context.WithValue(context.Background(), "temporalHostport", os.Getenv("TEMPORAL_HOSTPORT"))
+			ctx = context.WithValue(ctx, "containerEngine", config.Agent.Engine)
 			
-			for name, plugin := range plugins {
+			for name, plugin := range builtinPlugins() {
 				err := pluginManager.Register(ctx, name, plugin)
 				if err != nil {
 					log.Printf("Failed to register plugin %s: %v", name, err)
@@ -53,20 +51,98 @@ var (
 			exitOnSyscall(pluginManager)
 			
 
-			w := worker.New(wfClient, "JobQueue", worker.Options{})
+			node, err := nodes.Configure(config.Agent.Name, config.Agent.Labels, config.Agent.Executors)
+			if err != nil {
+				log.Fatalf("Unable to configure node: %v", err)
+			}
+			tuner, err := executorTuner(node.Executors)
+			if err != nil {
+				log.Fatalf("Unable to configure executors: %v", err)
+			}
+			options := worker.Options{Tuner: tuner}
+
+			// the stages reusing a container stay on the node, see NodeTaskQueueActivity
+			nodeTaskQueue, err := nodes.NodeTaskQueue(node)
+			if err != nil {
+				log.Fatalf("Unable to configure node: %v", err)
+			}
+			stageActivities := &workflow.StageActivities{NodeTaskQueue: nodeTaskQueue}
+
+			w := worker.New(wfClient, workflow.DefaultTaskQueue, options)
 
 			w.RegisterWorkflow(workflow.GroovyDSLWorkflow)
-			w.RegisterActivity(&workflow.StageActivities{})
+			w.RegisterWorkflow(workflow.JobLockWorkflow)
+			w.RegisterActivity(stageActivities)
+			w.RegisterActivity(triggers.PollSCMActivity)
+			workers := []worker.Worker{w}
 
-			// Start the worker
-			err := w.Run(worker.InterruptCh())
-			if err != nil {
-				log.Fatalf("Unable to start worker: %v", err)
+			// stages with a label run on the task queue of their label expression, the one of the node name
+			// gets the stages with expressions the node doesn't poll, see nodes.LabelTaskQueueActivity
+			taskQueues := nodes.TaskQueues(node, jobs.GetInstance().Root)
+			for _, taskQueue := range taskQueues {
+				labelWorker := worker.New(wfClient, taskQueue, options)
+				labelWorker.RegisterActivity(stageActivities)
+				workers = append(workers, labelWorker)
 			}
+			log.Printf("Node %s with %d executors polls %v", node.Name, node.Executors, taskQueues)
+
+			// Start the workers
+			for _, w := range workers {
+				if err := w.Start(); err != nil {
+					log.Fatalf("Unable to start worker: %v", err)
+				}
+				defer w.Stop()
+			}
+
+			advertiseCtx, stopAdvertising := context.WithCancel(context.Background())
+			defer stopAdvertising()
+			go nodes.Advertise(advertiseCtx, wfClient, node, workflow.BusyExecutors)
+
+			<-worker.InterruptCh()
 		},
 	}
 )
 
+// executorTuner shares the activity slots of the workers of a node, there's one per executor
+func executorTuner(executors int) (worker.WorkerTuner, error) {
+	tuner, err := worker.NewFixedSizeTuner(worker.FixedSizeTunerOptions{})
+	if err != nil {
+		return nil, err
+	}
+	slots, err := worker.NewFixedSizeSlotSupplier(executors)
+	if err != nil {
+		return nil, err
+	}
+	return &sharedActivitySlots{WorkerTuner: tuner, slots: slots}, nil
+}
+
+type sharedActivitySlots struct {
+	worker.WorkerTuner
+	slots worker.SlotSupplier
+}
+
+func (t *sharedActivitySlots) GetActivityTaskSlotSupplier() worker.SlotSupplier {
+	return t.slots
+}
+
+// builtinPlugins returns the plugins shipped with tumbler-doll by name
+func builtinPlugins() map[string]plugins.Plugin {
+	return map[string]plugins.Plugin{
+		"scm":    &scm.ScmPlugin{},
+		"shell":  &shell.ShellPlugin{},
+		"docker": &docker.DockerPlugin{},
+	}
+}
+
+// declarePlugins makes the steps of the builtin plugins known without starting them
+func declarePlugins() *plugins.PluginManager {
+	pluginManager := plugins.GetInstance()
+	for name, plugin := range builtinPlugins() {
+		pluginManager.Declare(name, plugin)
+	}
+	return pluginManager
+}
+
 func exitOnSyscall(pluginManager *plugins.PluginManager) {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
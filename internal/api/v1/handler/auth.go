@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+)
+
+type userKey struct{}
+
+// RemoteUser takes the identity of the user from the header set by the reverse proxy which authenticates
+// the requests, e.g. X-Forwarded-User. The API doesn't authenticate the users itself, so the proxy must
+// overwrite the header sent by the client.
+func RemoteUser(header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user := r.Header.Get(header); user != "" {
+				r = r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticatedUser returns the user set by RemoteUser, or an empty string for an anonymous request
+func authenticatedUser(r *http.Request) string {
+	user, _ := r.Context().Value(userKey{}).(string)
+	return user
+}
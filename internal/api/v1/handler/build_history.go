@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+)
+
+// buildHistoryPath matches {path}/builds and {path}/builds/{n}, job paths may contain slashes
+var buildHistoryPath = regexp.MustCompile(`^(.+)/builds(?:/(\d+))?/?$`)
+
+// Handler function for GET /api/v1/jobs/{path}/builds and /api/v1/jobs/{path}/builds/{n}
+// The path is the job name relative to the jobs root, e.g. folder/my-job. The history is read from
+// the build.xml records of the job, so it outlives the workflow history.
+func BuildHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		match := buildHistoryPath.FindStringSubmatch(chi.URLParam(r, "*"))
+		if match == nil || strings.Contains(match[1], "..") {
+			http.Error(w, "Invalid build history path", http.StatusNotFound)
+			return
+		}
+		jobName := jobs.FullName(match[1])
+		if _, err := os.Stat(jobs.JobDir(jobName)); err != nil {
+			http.Error(w, "job "+match[1]+" not found", http.StatusNotFound)
+			return
+		}
+
+		var history any
+		if match[2] == "" {
+			records, err := jobs.ListBuildRecords(jobName)
+			if err != nil {
+				http.Error(w, "Error reading build history", http.StatusInternalServerError)
+				log.Printf("Unable to read build history of %s: %v", jobName, err)
+				return
+			}
+			history = records
+		} else {
+			number, _ := strconv.Atoi(match[2])
+			record, err := jobs.ReadBuildRecord(jobName, number)
+			if errors.Is(err, os.ErrNotExist) {
+				http.Error(w, "build "+match[2]+" not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Error reading build record", http.StatusInternalServerError)
+				log.Printf("Unable to read build %d of %s: %v", number, jobName, err)
+				return
+			}
+			history = record
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(history); err != nil {
+			http.Error(w, "Failed to encode build history as JSON", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/yegor86/tumbler-doll/internal/queue"
+)
+
+// Handler function for GET /api/v1/queue
+func ListQueue(buildQueue *queue.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(buildQueue.Items()); err != nil {
+			http.Error(w, "Failed to encode queue as JSON", http.StatusInternalServerError)
+		}
+	}
+}
+
+// Handler function for GET /api/v1/queue/{id}
+// Items that left the queue recently are still returned, with the workflow id of their build.
+func GetQueueItem(buildQueue *queue.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid queue item id", http.StatusBadRequest)
+			return
+		}
+		item, ok := buildQueue.Get(id)
+		if !ok {
+			http.Error(w, "Queue item not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(item); err != nil {
+			http.Error(w, "Failed to encode queue item as JSON", http.StatusInternalServerError)
+		}
+	}
+}
+
+// Handler function for DELETE /api/v1/queue/{id}
+func CancelQueueItem(buildQueue *queue.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid queue item id", http.StatusBadRequest)
+			return
+		}
+		if !buildQueue.Cancel(id) {
+			http.Error(w, "Queue item not found or already started", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
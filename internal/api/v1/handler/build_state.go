@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	temporal "go.temporal.io/sdk/client"
+
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+// buildId returns the workflow id of the build, the slash between the job and the build id is URL-encoded
+func buildId(r *http.Request) (string, error) {
+	return url.PathUnescape(chi.URLParam(r, "id"))
+}
+
+// Handler function for GET /api/v1/builds/{id}/state
+func GetBuildState(wfClient temporal.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		workflowId, err := buildId(r)
+		if err != nil {
+			http.Error(w, "Invalid build id", http.StatusBadRequest)
+			return
+		}
+		state, err := workflow.GetState(wfClient, workflowId)
+		if err != nil {
+			http.Error(w, "Error querying build state: "+err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(state); err != nil {
+			http.Error(w, "Failed to encode build state as JSON", http.StatusInternalServerError)
+		}
+	}
+}
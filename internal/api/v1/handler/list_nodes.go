@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	temporal "go.temporal.io/sdk/client"
+
+	"github.com/yegor86/tumbler-doll/internal/nodes"
+)
+
+// Handler function for GET /api/v1/nodes
+// Nodes configured in JENKINS_HOME/nodes are listed even when they're offline.
+func ListNodes(wfClient temporal.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		statuses, err := nodes.List(r.Context(), wfClient)
+		if err != nil {
+			http.Error(w, "Failed to list nodes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(statuses); err != nil {
+			http.Error(w, "Failed to encode nodes as JSON", http.StatusInternalServerError)
+		}
+	}
+}
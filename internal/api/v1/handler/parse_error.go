@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+type ParseErrorResponse struct {
+	Status string               `json:"status"`
+	Errors workflow.Diagnostics `json:"errors"`
+}
+
+// writeParseError reports an invalid Jenkinsfile as a 400 JSON response with diagnostics
+func writeParseError(w http.ResponseWriter, err error) {
+	var diagnostics workflow.Diagnostics
+	if !errors.As(err, &diagnostics) {
+		http.Error(w, "Error reading script", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(ParseErrorResponse{
+		Status: "Invalid Jenkinsfile",
+		Errors: diagnostics,
+	}); err != nil {
+		log.Printf("Failed to encode diagnostics as JSON: %v", err)
+	}
+}
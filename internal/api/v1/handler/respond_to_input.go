@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	temporal "go.temporal.io/sdk/client"
+
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+type RespondToInputResponse struct {
+	Status     string
+	WorkflowID string
+	InputID    string
+}
+
+// Handler function for POST /api/v1/builds/{id}/input
+// The body is an InputResponse, the input id may be omitted while the build waits for a single input.
+// The submitter is the authenticated user, see RemoteUser, the one in the body is ignored.
+func RespondToInput(wfClient temporal.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		workflowId, err := buildId(r)
+		if err != nil {
+			http.Error(w, "Invalid build id", http.StatusBadRequest)
+			return
+		}
+		var response workflow.InputResponse
+		if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
+			http.Error(w, "Invalid input response: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		response.Submitter = authenticatedUser(r)
+		if response.Submitter == "" {
+			http.Error(w, "Authentication is required", http.StatusUnauthorized)
+			return
+		}
+
+		state, err := workflow.GetState(wfClient, workflowId)
+		if err != nil {
+			http.Error(w, "Error querying build state: "+err.Error(), http.StatusNotFound)
+			return
+		}
+		pending := findInput(state.Inputs, response.Id)
+		if pending == nil {
+			http.Error(w, "Build isn't waiting for input "+response.Id, http.StatusNotFound)
+			return
+		}
+		response.Id = pending.Id
+
+		// the workflow checks the response again, rejecting it here gives the user a meaningful status
+		if _, err := pending.Validate(workflow.InputResponse{Submitter: response.Submitter}); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if _, err := pending.Validate(response); err != nil {
+			http.Error(w, "Invalid input parameters: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := workflow.RespondToInput(wfClient, workflowId, response); err != nil {
+			http.Error(w, "Error signaling build: "+err.Error(), http.StatusNotFound)
+			log.Printf("Unable to respond to input %s of build %s: %v", response.Id, workflowId, err)
+			return
+		}
+
+		status := "Rejected"
+		if response.Approve {
+			status = "Approved"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(RespondToInputResponse{
+			Status:     status,
+			WorkflowID: workflowId,
+			InputID:    response.Id,
+		}); err != nil {
+			http.Error(w, "Failed to encode response as JSON", http.StatusInternalServerError)
+		}
+	}
+}
+
+// findInput returns the pending input with the id, or the only pending one when the id is empty
+func findInput(inputs []*workflow.PendingInput, id string) *workflow.PendingInput {
+	if id == "" {
+		if len(inputs) == 1 {
+			return inputs[0]
+		}
+		return nil
+	}
+	for _, input := range inputs {
+		if input.Id == id {
+			return input
+		}
+	}
+	return nil
+}
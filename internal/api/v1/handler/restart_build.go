@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	temporal "go.temporal.io/sdk/client"
+
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+type RestartBuildRequest struct {
+	Stage string `json:"stage"`
+}
+
+// Handler function for POST /api/v1/builds/{id}/restart
+// The body names the top-level stage to restart from, e.g. {"stage": "Deploy"}
+func RestartBuild(wfClient temporal.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		workflowId, err := buildId(r)
+		if err != nil {
+			http.Error(w, "Invalid build id", http.StatusBadRequest)
+			return
+		}
+		var request RestartBuildRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Stage == "" {
+			http.Error(w, "Stage to restart from is required", http.StatusBadRequest)
+			return
+		}
+
+		we, err := workflow.RestartBuild(wfClient, workflowId, request.Stage)
+		if errors.Is(err, workflow.ErrBuildRunning) || errors.Is(err, workflow.ErrJobRunning) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error restarting build: "+err.Error(), http.StatusBadRequest)
+			log.Printf("Unable to restart build %s from %s: %v", workflowId, request.Stage, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(SubmitJobResponse{
+			Status:     "Restarted build from stage " + request.Stage,
+			WorkflowID: we.GetID(),
+			RunId:      we.GetRunID(),
+		}); err != nil {
+			http.Error(w, "Failed to encode response as JSON", http.StatusInternalServerError)
+		}
+	}
+}
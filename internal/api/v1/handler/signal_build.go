@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	temporal "go.temporal.io/sdk/client"
+
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+type SignalBuildResponse struct {
+	Status     string
+	WorkflowID string
+}
+
+// Handler function for POST /api/v1/builds/{id}/abort, /pause and /resume
+func SignalBuild(wfClient temporal.Client, signal string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		workflowId, err := buildId(r)
+		if err != nil {
+			http.Error(w, "Invalid build id", http.StatusBadRequest)
+			return
+		}
+		if err := workflow.SignalBuild(wfClient, workflowId, signal); err != nil {
+			http.Error(w, "Error signaling build: "+err.Error(), http.StatusNotFound)
+			log.Printf("Unable to %s build %s: %v", signal, workflowId, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(SignalBuildResponse{
+			Status:     "Sent " + signal + " signal",
+			WorkflowID: workflowId,
+		}); err != nil {
+			http.Error(w, "Failed to encode response as JSON", http.StatusInternalServerError)
+		}
+	}
+}
@@ -36,16 +36,29 @@ func ReadLogs(wfClient temporal.Client) http.HandlerFunc {
 		
 		delim := strings.LastIndex(workflowId, "/")
 		jobId := workflowId[delim + 1:]
-		state := workflow.Undefined
+		state := &workflow.BuildState{Status: workflow.StatusPending}
 
 		ipath := filepath.Join(os.Getenv("JENKINS_HOME"), jobPath, "builds", jobId, "log")
 		err := os.ErrNotExist
-		for err != nil && state != workflow.Done {
+		for err != nil && !state.IsDone() {
 			_, err = os.Stat(ipath)
 			if err != nil && !errors.Is(err, os.ErrNotExist) {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			if err != nil {
+				// a build without output has no log file
+				state, err = workflow.GetState(wfClient, workflowId)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if state.IsDone() {
+					fmt.Fprintf(w, "Completed job: WorkflowID=%s", jobId)
+					return
+				}
+				err = os.ErrNotExist
+			}
 			time.Sleep(100 * time.Millisecond)
 		}
 
@@ -59,7 +72,7 @@ func ReadLogs(wfClient temporal.Client) http.HandlerFunc {
 		// Remember inFile read-offset to use it in case of inFile was not fully read at the first traversal
 		var seekOffset int64 = 0
 
-		for state != workflow.Done {
+		for !state.IsDone() {
 			_, err = ifile.Seek(seekOffset, io.SeekStart)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
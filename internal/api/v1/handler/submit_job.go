@@ -1,15 +1,17 @@
 package handler
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/google/uuid"
 	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+	"github.com/yegor86/tumbler-doll/internal/queue"
 	"github.com/yegor86/tumbler-doll/internal/workflow"
 	temporal "go.temporal.io/sdk/client"
 )
@@ -20,12 +22,15 @@ var (
 
 type SubmitJobResponse struct {
 	Status     string
-	WorkflowID string
-	RunId      string
+	WorkflowID string `json:",omitempty"`
+	RunId      string `json:",omitempty"`
+	// QueueId identifies the queue item of the build, see GET /api/v1/queue/{id}
+	QueueId int64 `json:",omitempty"`
 }
 
-// Handler function for POST /submit/{jobpath}
-func SubmitJob(wfClient temporal.Client) http.HandlerFunc {
+// Handler function for POST /submit/{jobpath}?priority=N
+// The build starts right away unless the queue holds it back, the response has a queue id only then.
+func SubmitJob(wfClient temporal.Client, buildQueue *queue.Queue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
@@ -34,42 +39,60 @@ func SubmitJob(wfClient temporal.Client) http.HandlerFunc {
 
 		jobDB := jobs.GetInstance()
 
+		// the path is relative to the jobs root, e.g. folder/job
 		jobPath := chi.URLParam(r, "*")
-		job := jobDB.FindJobs(jobPath)
-		if job == nil {
+		job := jobDB.FindJobs(jobs.FullName(jobPath))
+		if job == nil || job.IsDir {
 			http.Error(w, fmt.Sprintf("job %s not found", jobPath), http.StatusNotFound)
 			return
 		}
 
-		pipeline, err := dslParser.Parse(job.Script)
+		pipeline, err := dslParser.ParseFile(jobPath, job.Script)
 		if err != nil {
-			http.Error(w, "Error reading script", http.StatusInternalServerError)
-			log.Printf("Error reading script %s", jobPath)
+			log.Printf("Error reading script %s: %v", jobPath, err)
+			writeParseError(w, err)
 			return
 		}
 
-		jobId := uuid.New().String()
-		workflowOptions := temporal.StartWorkflowOptions{
-			ID:        job.Name + "/" + jobId,
-			TaskQueue: "JobQueue",
+		// Parameter values are submitted as an optional JSON object, e.g. {"DEPLOY_ENV": "staging", "DRY_RUN": true}
+		var values map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&values); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid build parameters: "+err.Error(), http.StatusBadRequest)
+			return
 		}
-		props := map[string]interface{}{
-			"jobPath": jobPath,
-			"jobId":   jobId,
+		params, err := pipeline.Parameters.Resolve(values)
+		if err != nil {
+			http.Error(w, "Invalid build parameters: "+err.Error(), http.StatusBadRequest)
+			return
 		}
-		we, err := wfClient.ExecuteWorkflow(context.Background(), workflowOptions, workflow.GroovyDSLWorkflow, *pipeline, props)
+
+		// builds wait in the queue for their quiet period and for the concurrency limits
+		priority, _ := strconv.Atoi(r.URL.Query().Get("priority"))
+		item := queue.JobItem(wfClient, job.Name, pipeline, params, map[string]interface{}{"jobPath": jobPath})
+		item.Priority = priority
+		item = buildQueue.Schedule(item)
 
 		w.Header().Set("Content-Type", "application/json")
-		if err != nil {
+		if item.Error != "" {
 			http.Error(w, "Error executing workflow", http.StatusInternalServerError)
-			log.Printf("Unable to execute workflow %v", err)
+			return
+		}
+		if item.WorkflowID == "" {
+			w.WriteHeader(http.StatusAccepted)
+			if err := json.NewEncoder(w).Encode(SubmitJobResponse{
+				Status:  "Queued: " + item.Why,
+				QueueId: item.Id,
+			}); err != nil {
+				http.Error(w, "Failed to encode jobs as JSON", http.StatusInternalServerError)
+			}
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode(SubmitJobResponse{
 			Status:     "Started workflow: WorkflowID=%s, RunID=%s",
-			WorkflowID: we.GetID(),
-			RunId:      we.GetRunID(),
+			WorkflowID: item.WorkflowID,
+			RunId:      item.RunId,
+			QueueId:    item.Id,
 		}); err != nil {
 			http.Error(w, "Failed to encode jobs as JSON", http.StatusInternalServerError)
 		}
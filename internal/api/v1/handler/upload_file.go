@@ -66,10 +66,10 @@ func UploadFile(wfClient temporal.Client) http.HandlerFunc {
 		}
 
 		var dslParser workflow.DslParser
-		pipeline, err := dslParser.Parse(string(data))
+		pipeline, err := dslParser.ParseFile(file_header.Filename, string(data))
 		if err != nil {
-			http.Error(w, "Error reading file", http.StatusInternalServerError)
-			log.Printf("Error reading file %v", file_header.Filename)
+			log.Printf("Error reading file %v: %v", file_header.Filename, err)
+			writeParseError(w, err)
 			return
 		}
 
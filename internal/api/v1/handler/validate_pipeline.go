@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+	"github.com/yegor86/tumbler-doll/plugins"
+)
+
+type ValidatePipelineResponse struct {
+	Valid  bool                 `json:"valid"`
+	Errors workflow.Diagnostics `json:"errors"`
+}
+
+// Handler function for POST /api/v1/pipeline/validate
+// The Jenkinsfile is sent either as the request body or as the "file" field of a multipart form.
+func ValidatePipeline(pluginManager *plugins.PluginManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		fileName := "Jenkinsfile"
+		var reader io.Reader = r.Body
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+			file, fileHeader, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, "Unable to retrieve the file", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+			fileName = fileHeader.Filename
+			reader = file
+		}
+		data, err := io.ReadAll(io.LimitReader(reader, 10<<20))
+		if err != nil {
+			http.Error(w, "Error reading Jenkinsfile", http.StatusBadRequest)
+			return
+		}
+
+		diagnostics := dslParser.Validate(fileName, string(data), func(step string) bool {
+			_, _, ok := pluginManager.GetPluginInfo(step)
+			return ok
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(ValidatePipelineResponse{
+			Valid:  len(diagnostics) == 0,
+			Errors: diagnostics,
+		}); err != nil {
+			http.Error(w, "Failed to encode diagnostics as JSON", http.StatusInternalServerError)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package cryptography
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"sync"
 
+	"github.com/google/uuid"
+
 	customCryptoLib "github.com/yegor86/tumbler-doll/internal/jenkins/cryptography"
 	"github.com/yegor86/tumbler-doll/internal/jenkins/xml"
 )
@@ -41,6 +45,73 @@ func (crypto *Cryptography) GetCredentialsById(credentialsId string) *xml.Creden
 	return nil
 }
 
+// StoreSecret encrypts a value which mustn't reach the workflow history, e.g. the value of a password parameter,
+// into $JENKINS_HOME/secrets/values and returns the id to load it with
+func (crypto *Cryptography) StoreSecret(value string) (string, error) {
+	if len(crypto.secretKeyData) < 16 {
+		return "", errors.New("secret key isn't loaded")
+	}
+	secret := &Secret{}
+	encrypted, err := secret.encryptAes128Gcm([]byte(value), crypto.secretKeyData[:16])
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(os.Getenv("JENKINS_HOME"), "secrets", "values")
+	if err := os.MkdirAll(dir, 0740); err != nil {
+		return "", err
+	}
+	id := uuid.New().String()
+	if err := os.WriteFile(filepath.Join(dir, id), []byte(encrypted), defaultFileMode); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// LoadSecret decrypts a value kept by StoreSecret
+func (crypto *Cryptography) LoadSecret(id string) (string, error) {
+	encrypted, err := crypto.ReadSecret(id)
+	if err != nil {
+		return "", err
+	}
+	return crypto.DecryptSecret(encrypted)
+}
+
+// ReadSecret returns a value kept by StoreSecret as it's stored, encrypted with the secret key
+func (crypto *Cryptography) ReadSecret(id string) (string, error) {
+	// ids are made by StoreSecret, anything else could point outside of the directory
+	if _, err := uuid.Parse(id); err != nil {
+		return "", fmt.Errorf("invalid secret id %q", id)
+	}
+	encrypted, err := os.ReadFile(filepath.Join(os.Getenv("JENKINS_HOME"), "secrets", "values", id))
+	if err != nil {
+		return "", err
+	}
+	return string(encrypted), nil
+}
+
+// DecryptSecret decrypts a value read by ReadSecret. The secret key is the one the credentials are decrypted
+// with, the nodes share it with the controller.
+func (crypto *Cryptography) DecryptSecret(encrypted string) (string, error) {
+	if len(crypto.secretKeyData) < 16 {
+		return "", errors.New("secret key isn't loaded")
+	}
+	secret := &Secret{}
+	return secret.decryptAes128Gcm(encrypted, crypto.secretKeyData[:16])
+}
+
+// DeleteSecret removes a value kept by StoreSecret, e.g. when the build it was stored for completes
+func (crypto *Cryptography) DeleteSecret(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("invalid secret id %q", id)
+	}
+	err := os.Remove(filepath.Join(os.Getenv("JENKINS_HOME"), "secrets", "values", id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
 // LoadOrSeedCrypto load or seed encrypted files
 func (crypto *Cryptography) LoadOrSeedCrypto() error {
 
@@ -1,6 +1,9 @@
 package cryptography
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -23,3 +26,25 @@ func Test_aes128gcm_encrypt_decrypt(t *testing.T) {
 		t.Errorf("Expected '%s', got '%s'", plainText, decrypted)
 	}
 }
+
+func Test_stores_and_loads_secret(t *testing.T) {
+	t.Setenv("JENKINS_HOME", t.TempDir())
+	crypto := &Cryptography{secretKeyData: GenerateKey(16)}
+
+	id, err := crypto.StoreSecret("s3cr3t")
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(os.Getenv("JENKINS_HOME"), "secrets", "values", id))
+	if err != nil || strings.Contains(string(data), "s3cr3t") {
+		t.Errorf("Expected the secret to be stored encrypted, got %q (%v)", data, err)
+	}
+
+	value, err := crypto.LoadSecret(id)
+	if err != nil || value != "s3cr3t" {
+		t.Errorf("Expected 's3cr3t', got '%s' (%v)", value, err)
+	}
+	if _, err := crypto.LoadSecret("../../credentials.xml"); err == nil {
+		t.Errorf("Expected an id which isn't made by StoreSecret to be rejected")
+	}
+}
@@ -32,9 +32,10 @@ func LoadEnvVars() {
 	printEnv()
 }
 
+// printEnv writes to stderr to keep stdout clean for commands with machine-readable output, e.g. lint
 func printEnv() {
 	for _, e := range os.Environ() {
-        fmt.Println(e)
+        fmt.Fprintln(os.Stderr, e)
     }
 }
 
@@ -0,0 +1,375 @@
+package jobs
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Cause types of a build
+const (
+	UserCause     = "user"
+	RestartCause  = "restart"
+	TimerCause    = "timer"
+	SCMCause      = "scm"
+	UpstreamCause = "upstream"
+)
+
+type (
+	// BuildRecord is what's kept of a finished build in builds/<N>/build.xml of the job
+	BuildRecord struct {
+		Number    int       `json:"id"`
+		Result    string    `json:"status"`
+		Timestamp time.Time `json:"timestamp"`
+		// Duration is in milliseconds, like in the Jenkins API
+		Duration   int64            `json:"duration"`
+		Causes     []Cause          `json:"causes"`
+		Parameters []ParameterValue `json:"parameters,omitempty"`
+		Stages     []StageRecord    `json:"stages,omitempty"`
+		// Downstream are the builds started by the build step
+		Downstream []DownstreamBuild `json:"downstream,omitempty"`
+	}
+
+	// DownstreamBuild is a build of another job started by a build
+	DownstreamBuild struct {
+		JobName string `json:"jobName"`
+		Number  int    `json:"number"`
+	}
+
+	// Cause tells why a build started
+	Cause struct {
+		Type   string `json:"type"`
+		UserId string `json:"userId,omitempty"`
+		// OriginBuild and OriginStage are the build and the stage a restarted build started from
+		OriginBuild int    `json:"originBuild,omitempty"`
+		OriginStage string `json:"originStage,omitempty"`
+		// UpstreamProject and UpstreamBuild are the job and the build which triggered the build
+		UpstreamProject string `json:"upstreamProject,omitempty"`
+		UpstreamBuild   int    `json:"upstreamBuild,omitempty"`
+	}
+
+	// ParameterValue is the value of a build parameter, password values aren't kept
+	ParameterValue struct {
+		Name  string `json:"name"`
+		Type  string `json:"type"`
+		Value any    `json:"value,omitempty"`
+	}
+
+	// StageRecord is the outcome of a stage, Stages holds its parallel branches, nested stages or matrix cells.
+	// Output is what the steps of the stage returned, a restarted build carries it over.
+	StageRecord struct {
+		Name     string        `json:"name"`
+		Status   string        `json:"status"`
+		Duration int64         `json:"duration"`
+		Output   []string      `json:"output,omitempty"`
+		Stages   []StageRecord `json:"stages,omitempty"`
+	}
+)
+
+// build.xml as written by the workflow-job plugin, stages are an addition of ours
+type (
+	buildXML struct {
+		XMLName   xml.Name   `xml:"flow-build"`
+		Plugin    string     `xml:"plugin,attr"`
+		Actions   actionsXML `xml:"actions"`
+		Number    int        `xml:"number"`
+		Timestamp int64      `xml:"timestamp"`
+		StartTime int64      `xml:"startTime"`
+		Result    string     `xml:"result"`
+		Duration  int64      `xml:"duration"`
+		Charset   string     `xml:"charset"`
+		KeepLog   bool       `xml:"keepLog"`
+		Stages    []stageXML `xml:"stages>stage"`
+	}
+
+	actionsXML struct {
+		Causes     *causeActionXML      `xml:"hudson.model.CauseAction"`
+		Parameters *parametersActionXML `xml:"hudson.model.ParametersAction"`
+		Downstream *downstreamActionXML `xml:"org.jenkinsci.plugins.workflow.support.steps.build.DownstreamBuildAction"`
+	}
+
+	downstreamActionXML struct {
+		Builds []downstreamBuildXML `xml:"downstreamBuilds>org.jenkinsci.plugins.workflow.support.steps.build.DownstreamBuildAction_-DownstreamBuild"`
+	}
+
+	downstreamBuildXML struct {
+		JobFullName string `xml:"jobFullName"`
+		BuildNumber int    `xml:"buildNumber"`
+	}
+
+	causeActionXML struct {
+		Bag struct {
+			Class   string          `xml:"class,attr"`
+			Entries []causeEntryXML `xml:"entry"`
+		} `xml:"causeBag"`
+	}
+
+	causeEntryXML struct {
+		Cause causeXML `xml:",any"`
+		Count int      `xml:"int"`
+	}
+
+	causeXML struct {
+		XMLName         xml.Name
+		UserId          string `xml:"userId,omitempty"`
+		OriginRunNumber int    `xml:"originRunNumber,omitempty"`
+		OriginStage     string `xml:"originStage,omitempty"`
+		UpstreamProject string `xml:"upstreamProject,omitempty"`
+		UpstreamBuild   int    `xml:"upstreamBuild,omitempty"`
+	}
+
+	parametersActionXML struct {
+		Parameters struct {
+			Values []parameterXML `xml:",any"`
+		} `xml:"parameters"`
+	}
+
+	parameterXML struct {
+		XMLName xml.Name
+		Name    string  `xml:"name"`
+		Value   *string `xml:"value"`
+	}
+
+	stageXML struct {
+		Name     string     `xml:"name"`
+		Status   string     `xml:"status"`
+		Duration int64      `xml:"duration"`
+		Output   []string   `xml:"output>line"`
+		Stages   []stageXML `xml:"stages>stage"`
+	}
+)
+
+var (
+	// causeClasses maps cause types onto the classes Jenkins stores them as
+	causeClasses = map[string]string{
+		UserCause:     "hudson.model.Cause_-UserIdCause",
+		RestartCause:  "org.jenkinsci.plugins.pipeline.modeldefinition.causes.RestartDeclarativePipelineCause",
+		TimerCause:    "hudson.triggers.TimerTrigger_-TimerTriggerCause",
+		SCMCause:      "hudson.triggers.SCMTrigger_-SCMTriggerCause",
+		UpstreamCause: "hudson.model.Cause_-UpstreamCause",
+	}
+
+	// parameterClasses maps parameter types onto the classes Jenkins stores their values as,
+	// choices are stored as strings
+	parameterClasses = map[string]string{
+		"string":       "hudson.model.StringParameterValue",
+		"text":         "hudson.model.TextParameterValue",
+		"booleanParam": "hudson.model.BooleanParameterValue",
+		"password":     "hudson.model.PasswordParameterValue",
+	}
+)
+
+// BuildDir returns the directory the log and the record of the build are kept in
+func BuildDir(jobName string, number int) string {
+	return filepath.Join(JobDir(jobName), "builds", strconv.Itoa(number))
+}
+
+// WriteBuildRecord writes the build.xml of a finished build
+func WriteBuildRecord(jobName string, record BuildRecord) error {
+	dir := BuildDir(jobName, record.Number)
+	if err := os.MkdirAll(dir, 0740); err != nil {
+		return err
+	}
+	data, err := xml.MarshalIndent(record.toXML(), "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte("<?xml version='1.1' encoding='UTF-8'?>\n"), data...)
+	return os.WriteFile(filepath.Join(dir, "build.xml"), data, 0644)
+}
+
+// ReadBuildRecord reads the build.xml of a build, the error wraps os.ErrNotExist for unknown or running builds
+func ReadBuildRecord(jobName string, number int) (*BuildRecord, error) {
+	data, err := os.ReadFile(filepath.Join(BuildDir(jobName, number), "build.xml"))
+	if err != nil {
+		return nil, err
+	}
+	var build buildXML
+	// Go can't parse XML 1.1 declarations, Jenkins doesn't use any 1.1 feature
+	if err := xml.Unmarshal(stripXmlVersion(data), &build); err != nil {
+		return nil, fmt.Errorf("failed to parse build.xml of %s #%d: %w", jobName, number, err)
+	}
+	return build.toRecord(), nil
+}
+
+// ListBuildRecords returns the records of the finished builds of the job, the latest first
+func ListBuildRecords(jobName string) ([]*BuildRecord, error) {
+	entries, err := os.ReadDir(filepath.Join(JobDir(jobName), "builds"))
+	if errors.Is(err, os.ErrNotExist) {
+		return []*BuildRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var numbers []int
+	for _, entry := range entries {
+		if number, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+
+	records := make([]*BuildRecord, 0, len(numbers))
+	for _, number := range numbers {
+		record, err := ReadBuildRecord(jobName, number)
+		if errors.Is(err, os.ErrNotExist) {
+			// still running, or built before build records were kept
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (record *BuildRecord) toXML() *buildXML {
+	build := &buildXML{
+		Plugin:    "workflow-job",
+		Number:    record.Number,
+		Timestamp: record.Timestamp.UnixMilli(),
+		StartTime: record.Timestamp.UnixMilli(),
+		Result:    record.Result,
+		Duration:  record.Duration,
+		Charset:   "UTF-8",
+		Stages:    toStagesXML(record.Stages),
+	}
+
+	causes := &causeActionXML{}
+	causes.Bag.Class = "linked-hash-map"
+	for _, cause := range record.Causes {
+		causes.Bag.Entries = append(causes.Bag.Entries, causeEntryXML{
+			Cause: causeXML{
+				XMLName:         xml.Name{Local: causeClasses[cause.Type]},
+				UserId:          cause.UserId,
+				OriginRunNumber: cause.OriginBuild,
+				OriginStage:     cause.OriginStage,
+				UpstreamProject: cause.UpstreamProject,
+				UpstreamBuild:   cause.UpstreamBuild,
+			},
+			Count: 1,
+		})
+	}
+	build.Actions.Causes = causes
+
+	if len(record.Parameters) > 0 {
+		parameters := &parametersActionXML{}
+		for _, param := range record.Parameters {
+			class, ok := parameterClasses[param.Type]
+			if !ok {
+				class = parameterClasses["string"]
+			}
+			parameter := parameterXML{
+				XMLName: xml.Name{Local: class},
+				Name:    param.Name,
+			}
+			if param.Type != "password" && param.Value != nil {
+				value := fmt.Sprint(param.Value)
+				parameter.Value = &value
+			}
+			parameters.Parameters.Values = append(parameters.Parameters.Values, parameter)
+		}
+		build.Actions.Parameters = parameters
+	}
+
+	if len(record.Downstream) > 0 {
+		downstream := &downstreamActionXML{}
+		for _, d := range record.Downstream {
+			downstream.Builds = append(downstream.Builds, downstreamBuildXML{JobFullName: d.JobName, BuildNumber: d.Number})
+		}
+		build.Actions.Downstream = downstream
+	}
+	return build
+}
+
+func toStagesXML(stages []StageRecord) []stageXML {
+	var result []stageXML
+	for _, stage := range stages {
+		result = append(result, stageXML{
+			Name:     stage.Name,
+			Status:   stage.Status,
+			Duration: stage.Duration,
+			Output:   stage.Output,
+			Stages:   toStagesXML(stage.Stages),
+		})
+	}
+	return result
+}
+
+func (build *buildXML) toRecord() *BuildRecord {
+	record := &BuildRecord{
+		Number:    build.Number,
+		Result:    build.Result,
+		Timestamp: time.UnixMilli(build.Timestamp).UTC(),
+		Duration:  build.Duration,
+		Causes:    []Cause{},
+		Stages:    toStageRecords(build.Stages),
+	}
+
+	if build.Actions.Causes != nil {
+		for _, entry := range build.Actions.Causes.Bag.Entries {
+			record.Causes = append(record.Causes, Cause{
+				Type:            typeOf(causeClasses, entry.Cause.XMLName.Local),
+				UserId:          entry.Cause.UserId,
+				OriginBuild:     entry.Cause.OriginRunNumber,
+				OriginStage:     entry.Cause.OriginStage,
+				UpstreamProject: entry.Cause.UpstreamProject,
+				UpstreamBuild:   entry.Cause.UpstreamBuild,
+			})
+		}
+	}
+
+	if build.Actions.Parameters != nil {
+		for _, parameter := range build.Actions.Parameters.Parameters.Values {
+			param := ParameterValue{
+				Name: parameter.Name,
+				Type: typeOf(parameterClasses, parameter.XMLName.Local),
+			}
+			if parameter.Value != nil {
+				param.Value = *parameter.Value
+				if param.Type == "booleanParam" {
+					param.Value, _ = strconv.ParseBool(*parameter.Value)
+				}
+			}
+			record.Parameters = append(record.Parameters, param)
+		}
+	}
+
+	if build.Actions.Downstream != nil {
+		for _, d := range build.Actions.Downstream.Builds {
+			record.Downstream = append(record.Downstream, DownstreamBuild{JobName: d.JobFullName, Number: d.BuildNumber})
+		}
+	}
+	return record
+}
+
+func toStageRecords(stages []stageXML) []StageRecord {
+	var result []StageRecord
+	for _, stage := range stages {
+		result = append(result, StageRecord{
+			Name:     stage.Name,
+			Status:   stage.Status,
+			Duration: stage.Duration,
+			Output:   stage.Output,
+			Stages:   toStageRecords(stage.Stages),
+		})
+	}
+	return result
+}
+
+// typeOf finds the type of a Jenkins class name, unknown classes are kept as they are
+func typeOf(classes map[string]string, class string) string {
+	for t, c := range classes {
+		if c == class {
+			return t
+		}
+	}
+	return class
+}
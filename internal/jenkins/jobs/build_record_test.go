@@ -0,0 +1,97 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildRecords(t *testing.T) {
+	t.Setenv("JENKINS_HOME", t.TempDir())
+
+	timestamp := time.Date(2024, 12, 23, 12, 0, 0, 0, time.UTC)
+	records := []BuildRecord{
+		{
+			Number:    1,
+			Result:    "FAILURE",
+			Timestamp: timestamp,
+			Duration:  3000,
+			Causes:    []Cause{{Type: UserCause, UserId: "alice"}},
+			Parameters: []ParameterValue{
+				{Name: "TARGET", Type: "string", Value: "staging"},
+				{Name: "DRY_RUN", Type: "booleanParam", Value: true},
+				{Name: "TOKEN", Type: "password", Value: "secret"},
+			},
+			Stages: []StageRecord{
+				{Name: "Build", Status: "success", Duration: 1000, Output: []string{"make", "built <app>"}},
+				{Name: "Test", Status: "failed", Duration: 2000, Stages: []StageRecord{
+					{Name: "Unit", Status: "failed", Duration: 2000},
+				}},
+			},
+		},
+		{
+			Number:    2,
+			Result:    "SUCCESS",
+			Timestamp: timestamp.Add(time.Hour),
+			Duration:  2000,
+			Causes:    []Cause{{Type: RestartCause, OriginBuild: 1, OriginStage: "Test"}},
+		},
+		{
+			Number:    4,
+			Result:    "SUCCESS",
+			Timestamp: timestamp.Add(2 * time.Hour),
+			Duration:  1000,
+			Causes:    []Cause{{Type: UpstreamCause, UpstreamProject: "/jobs/lib", UpstreamBuild: 12}},
+			Downstream: []DownstreamBuild{
+				{JobName: "/jobs/components/jobs/api", Number: 7},
+				{JobName: "/jobs/components/jobs/web", Number: 2},
+			},
+		},
+	}
+	for _, record := range records {
+		if err := WriteBuildRecord("/jobs/my-job", record); err != nil {
+			t.Fatalf("Failed to write build record: %v", err)
+		}
+	}
+	// a running build has a log but no record yet
+	if err := os.MkdirAll(BuildDir("/jobs/my-job", 3), 0740); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(BuildDir("/jobs/my-job", 1), "build.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"<flow-build plugin=\"workflow-job\">",
+		"<hudson.model.Cause_-UserIdCause>",
+		"<hudson.model.BooleanParameterValue>",
+		"<result>FAILURE</result>",
+		"<timestamp>1734955200000</timestamp>",
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected build.xml to contain %s:\n%s", expected, data)
+		}
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("Password parameter stored in build.xml:\n%s", data)
+	}
+
+	history, err := ListBuildRecords("/jobs/my-job")
+	if err != nil {
+		t.Fatalf("Failed to list build records: %v", err)
+	}
+	records[0].Parameters[2].Value = nil
+	want := []*BuildRecord{&records[2], &records[1], &records[0]}
+	if diff := cmp.Diff(history, want); diff != "" {
+		t.Errorf("Unexpected build history (-got +want):\n%s", diff)
+	}
+
+	if _, err := ReadBuildRecord("/jobs/my-job", 3); !os.IsNotExist(err) {
+		t.Errorf("Expected no record of a running build, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package jobs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// buildsMutex serializes the updates made by this process, the file lock covers the other processes
+	buildsMutex sync.Mutex
+)
+
+// JobDir returns the directory of the job, e.g. $JENKINS_HOME/jobs/my-job for /jobs/my-job
+func JobDir(jobName string) string {
+	return filepath.Join(os.Getenv("JENKINS_HOME"), jobName)
+}
+
+// NextBuildNumber allocates the number of the next build of the job. The counter is kept
+// in the nextBuildNumber file of the job directory, like Jenkins does.
+func NextBuildNumber(jobName string) (int, error) {
+	var number int
+	err := updateFile(filepath.Join(JobDir(jobName), "nextBuildNumber"), func(data string) (string, error) {
+		number = 1
+		if value := strings.TrimSpace(data); value != "" {
+			var err error
+			if number, err = strconv.Atoi(value); err != nil {
+				return "", fmt.Errorf("invalid build number %q: %w", value, err)
+			}
+		}
+		return strconv.Itoa(number+1) + "\n", nil
+	})
+	return number, err
+}
+
+// UpdatePermalinks records a finished build in builds/permalinks of the job, where Jenkins keeps
+// lastSuccessfulBuild, lastFailedBuild and the other links. Result is one of SUCCESS, UNSTABLE,
+// FAILURE and ABORTED. Links already pointing to a later build are left alone.
+func UpdatePermalinks(jobName string, buildNumber int, result string) error {
+	links := []string{"lastCompletedBuild"}
+	switch result {
+	case "SUCCESS":
+		links = append(links, "lastSuccessfulBuild", "lastStableBuild")
+	case "UNSTABLE":
+		links = append(links, "lastSuccessfulBuild", "lastUnstableBuild", "lastUnsuccessfulBuild")
+	case "FAILURE":
+		links = append(links, "lastFailedBuild", "lastUnsuccessfulBuild")
+	default:
+		links = append(links, "lastUnsuccessfulBuild")
+	}
+
+	buildsDir := filepath.Join(JobDir(jobName), "builds")
+	if err := os.MkdirAll(buildsDir, 0740); err != nil {
+		return err
+	}
+	return updateFile(filepath.Join(buildsDir, "permalinks"), func(data string) (string, error) {
+		permalinks := ReadPermalinks(data)
+		for _, link := range links {
+			if permalinks[link] < buildNumber {
+				permalinks[link] = buildNumber
+			}
+		}
+
+		names := make([]string, 0, len(permalinks))
+		for name := range permalinks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var content strings.Builder
+		for _, name := range names {
+			fmt.Fprintf(&content, "%s %d\n", name, permalinks[name])
+		}
+		return content.String(), nil
+	})
+}
+
+// ReadPermalinks parses the content of a permalinks file, e.g. "lastSuccessfulBuild 12"
+func ReadPermalinks(data string) map[string]int {
+	permalinks := make(map[string]int)
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if number, err := strconv.Atoi(fields[1]); err == nil {
+			permalinks[fields[0]] = number
+		}
+	}
+	return permalinks
+}
+
+// updateFile replaces the content of the file with the one returned by update while holding a lock on it
+func updateFile(path string, update func(data string) (string, error)) error {
+	buildsMutex.Lock()
+	defer buildsMutex.Unlock()
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := lockFile(file); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	defer unlockFile(file)
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	content, err := update(string(data))
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = file.WriteAt([]byte(content), 0)
+	return err
+}
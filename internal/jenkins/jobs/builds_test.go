@@ -0,0 +1,109 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNextBuildNumber(t *testing.T) {
+	t.Setenv("JENKINS_HOME", t.TempDir())
+	jobDir := JobDir("/jobs/my-job")
+	if err := os.MkdirAll(jobDir, 0740); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	numbers := make(chan int, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			number, err := NextBuildNumber("/jobs/my-job")
+			if err != nil {
+				t.Errorf("Failed to allocate build number: %v", err)
+			}
+			numbers <- number
+		}()
+	}
+	wg.Wait()
+	close(numbers)
+
+	seen := make(map[int]bool)
+	for number := range numbers {
+		if seen[number] || number < 1 || number > 20 {
+			t.Errorf("Unexpected build number %d", number)
+		}
+		seen[number] = true
+	}
+
+	data, err := os.ReadFile(filepath.Join(jobDir, "nextBuildNumber"))
+	if err != nil || string(data) != "21\n" {
+		t.Errorf("Expected nextBuildNumber to be 21, got %q, %v", data, err)
+	}
+}
+
+func TestUpdatePermalinks(t *testing.T) {
+	t.Setenv("JENKINS_HOME", t.TempDir())
+
+	for _, build := range []struct {
+		number int
+		result string
+	}{
+		{1, "SUCCESS"},
+		{3, "FAILURE"},
+		// finished after a later build
+		{2, "UNSTABLE"},
+	} {
+		if err := UpdatePermalinks("/jobs/my-job", build.number, build.result); err != nil {
+			t.Fatalf("Failed to update permalinks: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(JobDir("/jobs/my-job"), "builds", "permalinks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{
+		"lastCompletedBuild":    3,
+		"lastFailedBuild":       3,
+		"lastStableBuild":       1,
+		"lastSuccessfulBuild":   2,
+		"lastUnstableBuild":     2,
+		"lastUnsuccessfulBuild": 3,
+	}
+	if diff := cmp.Diff(ReadPermalinks(string(data)), want); diff != "" {
+		t.Errorf("Unexpected permalinks (-got +want):\n%s", diff)
+	}
+}
+
+func TestUpdatePollingBaseline(t *testing.T) {
+	t.Setenv("JENKINS_HOME", t.TempDir())
+	if err := os.MkdirAll(JobDir("/jobs/my-job"), 0740); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, poll := range []struct {
+		heads   map[string]string
+		changed bool
+	}{
+		// no baseline yet
+		{map[string]string{"git@github.com:org/repo.git#main": "aaa"}, true},
+		{map[string]string{"git@github.com:org/repo.git#main": "aaa"}, false},
+		{map[string]string{"git@github.com:org/repo.git#main": "bbb"}, true},
+		// another repository is checked out too
+		{map[string]string{"git@github.com:org/repo.git#main": "bbb", "git@github.com:org/lib.git#main": "ccc"}, true},
+		{map[string]string{"git@github.com:org/repo.git#main": "bbb", "git@github.com:org/lib.git#main": "ccc"}, false},
+	} {
+		changed, err := UpdatePollingBaseline("/jobs/my-job", poll.heads)
+		if err != nil {
+			t.Fatalf("Failed to update polling baseline: %v", err)
+		}
+		if changed != poll.changed {
+			t.Errorf("Expected changed to be %v for %v", poll.changed, poll.heads)
+		}
+	}
+}
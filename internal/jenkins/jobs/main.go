@@ -21,6 +21,9 @@ type Job struct {
 
 type JobDatabase struct {
 	Root *Job
+
+	// loadListeners are called with the root of the jobs each time they're loaded
+	loadListeners []func(root *Job)
 }
 
 type JobDefinition struct {
@@ -80,17 +83,51 @@ func (jdb *JobDatabase) LoadJobs() (*Job, error) {
 		IsDir: true,
 		Children: jobs,
 	}
-	
+
+	for _, listener := range jdb.loadListeners {
+		listener(jdb.Root)
+	}
 	return jdb.Root, nil
 }
 
+// OnLoad registers a listener called each time LoadJobs loads the jobs, e.g. to register their triggers
+func (jdb *JobDatabase) OnLoad(listener func(root *Job)) {
+	jdb.loadListeners = append(jdb.loadListeners, listener)
+}
+
+// FindJobs returns the loaded job or folder with the full name, e.g. /jobs/folder/jobs/job, or nil if there's none
 func (jdb *JobDatabase) FindJobs(jobPath string) *Job {
-	node := jdb._findSubtree(jobPath, jdb.Root)
-	if node.Name == jobPath {
-		return node
+	return jdb._findJob(jobPath, jdb.Root)
+}
+
+// ReadJob reads the job with the full name, e.g. /jobs/folder/jobs/job, from its config.xml
+// rather than from the loaded jobs
+func ReadJob(jobName string) (*Job, error) {
+	data, err := os.ReadFile(filepath.Join(JobDir(jobName), "config.xml"))
+	if err != nil {
+		return nil, err
 	}
-	
-	return nil
+	job, err := parseRootBased(stripXmlVersion(data), filepath.Dir(JobDir(jobName)), filepath.Base(jobName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config.xml of %s: %w", jobName, err)
+	}
+	job.Name = jobName
+	return job, nil
+}
+
+// FullName turns the name of a job relative to the jobs root, e.g. folder/job, into the name
+// it's loaded with, e.g. /jobs/folder/jobs/job
+func FullName(name string) string {
+	if strings.HasPrefix(name, "/jobs/") {
+		return name
+	}
+	return "/jobs/" + strings.ReplaceAll(strings.Trim(name, "/"), "/", "/jobs/")
+}
+
+// ShortName turns the name a job is loaded with, e.g. /jobs/folder/jobs/job, into its name
+// relative to the jobs root, e.g. folder/job
+func ShortName(name string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(name, "/jobs/"), "/jobs/", "/")
 }
 
 func (jdb *JobDatabase) _listJobs(prefix string, root *Job) []*Job {
@@ -118,6 +155,23 @@ func (jdb *JobDatabase) _findSubtree(prefix string, root *Job) *Job {
 	return nil
 }
 
+func (jdb *JobDatabase) _findJob(name string, root *Job) *Job {
+	if root.Name == name {
+		return root
+	}
+	// folders are named after their jobs directory, e.g. /jobs/folder/jobs
+	if root.IsDir && root.Name != "/jobs/" && !strings.HasPrefix(name, root.Name+"/") {
+		return nil
+	}
+
+	for _, child := range root.Children {
+		if node := jdb._findJob(name, child); node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
 func (jdb *JobDatabase) _loadJobs(jobsDir string) ([]*Job, error) {
 	// List to store job details
 	var jobs []*Job
@@ -0,0 +1,32 @@
+package jobs
+
+import "testing"
+
+func TestFindJobs(t *testing.T) {
+	jdb := &JobDatabase{Root: &Job{
+		Name:  "/jobs/",
+		IsDir: true,
+		Children: []*Job{
+			{Name: "/jobs/app-tests"},
+			{Name: "/jobs/folder/jobs", IsDir: true, Children: []*Job{{Name: "/jobs/folder/jobs/app"}}},
+			{Name: "/jobs/app"},
+		},
+	}}
+
+	for name, want := range map[string]string{
+		"/jobs/app":              "/jobs/app",
+		"/jobs/folder/jobs/app":  "/jobs/folder/jobs/app",
+		"/jobs/folder/jobs":      "/jobs/folder/jobs",
+		"/jobs/unknown":          "",
+		"/jobs/folder/jobs/none": "",
+		"app":                    "",
+	} {
+		got := ""
+		if job := jdb.FindJobs(name); job != nil {
+			got = job.Name
+		}
+		if got != want {
+			t.Errorf("FindJobs(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
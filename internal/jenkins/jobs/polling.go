@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// UpdatePollingBaseline records the heads the SCM polling of the job found, by repository and branch,
+// and reports whether any of them moved since the last poll. The first poll always reports a change.
+// The heads are kept in the scm-polling-baseline file of the job directory.
+func UpdatePollingBaseline(jobName string, heads map[string]string) (bool, error) {
+	changed := false
+	err := updateFile(filepath.Join(JobDir(jobName), "scm-polling-baseline"), func(data string) (string, error) {
+		baseline := make(map[string]string)
+		for _, line := range strings.Split(data, "\n") {
+			if repo, head, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+				baseline[repo] = head
+			}
+		}
+		if len(baseline) == 0 {
+			changed = true
+		}
+
+		repos := make([]string, 0, len(heads))
+		for repo, head := range heads {
+			if baseline[repo] != head {
+				changed = true
+			}
+			repos = append(repos, repo)
+		}
+		sort.Strings(repos)
+		var content strings.Builder
+		for _, repo := range repos {
+			fmt.Fprintf(&content, "%s %s\n", repo, heads[repo])
+		}
+		return content.String(), nil
+	})
+	return changed, err
+}
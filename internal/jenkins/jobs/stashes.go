@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// StashDir returns the directory the stash step keeps the stashes of the build in, as <name>.tar.gz
+func StashDir(jobName string, number int) string {
+	return filepath.Join(BuildDir(jobName, number), "stashes")
+}
+
+// CopyStashes copies the stashes of a build to another build of the job, e.g. when the build is
+// restarted from a stage after the one which stashed the files
+func CopyStashes(jobName string, from int, to int) error {
+	entries, err := os.ReadDir(StashDir(jobName, from))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dir := StashDir(jobName, to)
+	if err := os.MkdirAll(dir, 0740); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := copyFile(filepath.Join(StashDir(jobName, from), entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyStashes(t *testing.T) {
+	t.Setenv("JENKINS_HOME", t.TempDir())
+	if err := os.MkdirAll(StashDir("/jobs/my-job", 1), 0740); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(StashDir("/jobs/my-job", 1), "app.tar.gz"), []byte("archive"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CopyStashes("/jobs/my-job", 1, 2); err != nil {
+		t.Fatalf("Failed to copy stashes: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(StashDir("/jobs/my-job", 2), "app.tar.gz"))
+	if err != nil || string(data) != "archive" {
+		t.Errorf("Expected the stash to be copied, got %q, %v", data, err)
+	}
+
+	// builds which didn't stash anything have nothing to copy
+	if err := CopyStashes("/jobs/my-job", 2, 3); err != nil {
+		t.Errorf("Failed to copy stashes: %v", err)
+	}
+	if err := CopyStashes("/jobs/my-job", 5, 6); err != nil {
+		t.Errorf("Expected no error without stashes, got %v", err)
+	}
+}
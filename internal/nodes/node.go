@@ -0,0 +1,162 @@
+package nodes
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+type (
+	// Node is an agent running a worker, stages with a label expression matching its labels run on it
+	Node struct {
+		Name   string   `json:"name"`
+		Labels []string `json:"labels"`
+		// Executors is how many stages the node runs at once
+		Executors int `json:"executors"`
+	}
+
+	// nodeXML is the part of JENKINS_HOME/nodes/<name>/config.xml kept of an agent
+	nodeXML struct {
+		Name         string `xml:"name"`
+		NumExecutors int    `xml:"numExecutors"`
+		// Label lists the labels separated by spaces
+		Label string `xml:"label"`
+	}
+)
+
+var xmlDeclaration = regexp.MustCompile(`^\s*<\?xml[^>]*\?>`)
+
+// LoadConfigs reads the agents configured in JENKINS_HOME/nodes/*/config.xml
+func LoadConfigs() ([]Node, error) {
+	nodesDir := filepath.Join(os.Getenv("JENKINS_HOME"), "nodes")
+	entries, err := os.ReadDir(nodesDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []Node
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		node, err := loadConfig(entry.Name())
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func loadConfig(name string) (Node, error) {
+	data, err := os.ReadFile(filepath.Join(os.Getenv("JENKINS_HOME"), "nodes", name, "config.xml"))
+	if err != nil {
+		return Node{}, err
+	}
+	// Jenkins writes XML 1.1 declarations which encoding/xml refuses
+	var config nodeXML
+	if err := xml.Unmarshal(xmlDeclaration.ReplaceAll(data, nil), &config); err != nil {
+		return Node{}, fmt.Errorf("failed to parse config.xml of node %s: %w", name, err)
+	}
+	if config.Name == "" {
+		config.Name = name
+	}
+	return Node{Name: config.Name, Labels: strings.Fields(config.Label), Executors: config.NumExecutors}, nil
+}
+
+// Configure returns the node a worker runs as. The name defaults to the host name, the labels and
+// executors which aren't given are read from the config.xml of the node, the executors default to the CPUs.
+func Configure(name string, labels []string, executors int) (Node, error) {
+	if name == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return Node{}, err
+		}
+		name = hostname
+	}
+
+	node, err := loadConfig(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Node{}, err
+	}
+	node.Name = name
+	if len(labels) > 0 {
+		node.Labels = labels
+	}
+	if executors > 0 {
+		node.Executors = executors
+	}
+	if node.Executors <= 0 {
+		node.Executors = runtime.NumCPU()
+	}
+	return node, nil
+}
+
+// matches reports whether the node can run the stages with the label expression, a node is labelled with its name too
+func (node Node) matches(label *workflow.LabelExpression) bool {
+	return label.Matches(append([]string{node.Name}, node.Labels...))
+}
+
+// TaskQueues returns the task queues the node polls besides the default one: the one of each of its labels and
+// those of the label expressions of the jobs it matches
+func TaskQueues(node Node, root *jobs.Job) []string {
+	queues := make(map[string]bool)
+	add := func(expression string) {
+		label, err := workflow.ParseLabelExpression(expression)
+		if err != nil || !node.matches(label) {
+			return
+		}
+		if taskQueue, err := workflow.LabelTaskQueue(expression); err == nil {
+			queues[taskQueue] = true
+		}
+	}
+
+	for _, label := range append([]string{node.Name}, node.Labels...) {
+		// a quoted label is a single one, whatever it contains
+		add(fmt.Sprintf("%q", label))
+	}
+	var parser workflow.DslParser
+	walkJobs(root, func(job *jobs.Job) {
+		pipeline, err := parser.ParseFile(job.Name, job.Script)
+		if err != nil {
+			return
+		}
+		for _, expression := range pipeline.Labels() {
+			add(expression)
+		}
+	})
+
+	taskQueues := make([]string, 0, len(queues))
+	for taskQueue := range queues {
+		taskQueues = append(taskQueues, taskQueue)
+	}
+	sort.Strings(taskQueues)
+	return taskQueues
+}
+
+func walkJobs(job *jobs.Job, visit func(job *jobs.Job)) {
+	if job == nil {
+		return
+	}
+	if !job.IsDir && job.Script != "" {
+		visit(job)
+	}
+	for _, child := range job.Children {
+		walkJobs(child, visit)
+	}
+}
@@ -0,0 +1,123 @@
+package nodes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+const agentConfig = `<?xml version='1.1' encoding='UTF-8'?>
+<slave>
+  <name>builder-1</name>
+  <description>Linux builder</description>
+  <remoteFS>/home/jenkins</remoteFS>
+  <numExecutors>4</numExecutors>
+  <mode>NORMAL</mode>
+  <label>linux docker</label>
+</slave>
+`
+
+func TestConfigure(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("JENKINS_HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, "nodes", "builder-1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "nodes", "builder-1", "config.xml"), []byte(agentConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := LoadConfigs()
+	if err != nil {
+		t.Fatalf("Failed to load node configs: %v", err)
+	}
+	want := []Node{{Name: "builder-1", Labels: []string{"linux", "docker"}, Executors: 4}}
+	if diff := cmp.Diff(configs, want); diff != "" {
+		t.Errorf("Nodes are not equal (-got +want):\n%s", diff)
+	}
+
+	node, err := Configure("builder-1", nil, 0)
+	if err != nil {
+		t.Fatalf("Failed to configure node: %v", err)
+	}
+	if diff := cmp.Diff(node, want[0]); diff != "" {
+		t.Errorf("Node is not equal (-got +want):\n%s", diff)
+	}
+
+	// the worker config wins over config.xml
+	node, err = Configure("builder-1", []string{"arm64"}, 1)
+	if err != nil {
+		t.Fatalf("Failed to configure node: %v", err)
+	}
+	if diff := cmp.Diff(node, Node{Name: "builder-1", Labels: []string{"arm64"}, Executors: 1}); diff != "" {
+		t.Errorf("Node is not equal (-got +want):\n%s", diff)
+	}
+
+	node, err = Configure("builder-2", []string{"windows"}, 0)
+	if err != nil {
+		t.Fatalf("Failed to configure node: %v", err)
+	}
+	if node.Executors <= 0 {
+		t.Errorf("Node without executors configured should get one per CPU, got %d", node.Executors)
+	}
+}
+
+func TestTaskQueues(t *testing.T) {
+	root := &jobs.Job{
+		Name:  "/jobs/",
+		IsDir: true,
+		Children: []*jobs.Job{
+			{Name: "/jobs/image", Script: `pipeline { agent { label 'linux && docker' } stages { stage('Build') { steps { sh 'make' } } } }`},
+			{Name: "/jobs/installer", Script: `pipeline { agent { label 'windows' } stages { stage('Build') { steps { bat 'make' } } } }`},
+			{
+				Name:  "/jobs/folder",
+				IsDir: true,
+				Children: []*jobs.Job{
+					{Name: "/jobs/folder/jobs/arm", Script: `pipeline { agent none stages { stage('Build') { agent { label 'linux && !x86' } steps { sh 'make' } } } }`},
+				},
+			},
+		},
+	}
+
+	node := Node{Name: "builder-1", Labels: []string{"linux", "docker", "x86"}, Executors: 2}
+	want := []string{
+		"JobQueue@builder-1",
+		"JobQueue@docker",
+		"JobQueue@linux",
+		"JobQueue@linux && docker",
+		"JobQueue@x86",
+	}
+	if diff := cmp.Diff(TaskQueues(node, root), want); diff != "" {
+		t.Errorf("Task queues are not equal (-got +want):\n%s", diff)
+	}
+}
+
+func TestLeastBusy(t *testing.T) {
+	statuses := []Status{
+		{Node: Node{Name: "builder-1", Labels: []string{"linux"}, Executors: 2}, Busy: 2, Online: true},
+		{Node: Node{Name: "builder-2", Labels: []string{"linux", "docker"}, Executors: 4}, Busy: 1, Online: true},
+		{Node: Node{Name: "builder-3", Labels: []string{"linux"}, Executors: 8}, Online: false},
+		{Node: Node{Name: "builder-4", Labels: []string{"windows"}, Executors: 1}, Online: true},
+	}
+
+	for expression, want := range map[string]string{
+		"linux":            "builder-2",
+		"linux && !docker": "builder-1",
+		"builder-4":        "builder-4",
+		"macos":            "",
+	} {
+		label, err := workflow.ParseLabelExpression(expression)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", expression, err)
+		}
+		node, _ := leastBusy(statuses, label)
+		if node.Name != want {
+			t.Errorf("Expected %s to run on %q, got %q", expression, want, node.Name)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"go.temporal.io/api/serviceerror"
+	temporalClient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/workflow"
+
+	wf "github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+const (
+	// TaskQueue is served by the API, which shows the nodes
+	TaskQueue = wf.NodesTaskQueue
+
+	// HeartbeatInterval is how often a worker reports the status of its node
+	HeartbeatInterval = 10 * time.Second
+
+	// offlineAfter is how long a node stays online without a heartbeat
+	offlineAfter = 3 * HeartbeatInterval
+	// forgetAfter is how long a node which isn't configured in JENKINS_HOME is listed without a heartbeat
+	forgetAfter = 24 * time.Hour
+	// maxHeartbeats keeps the history of the registry short, it continues as new once it's received them
+	maxHeartbeats = 1000
+
+	registryWorkflowID = "nodes"
+	heartbeatSignal    = "heartbeat"
+	nodesQuery         = "nodes"
+)
+
+// Status is a node as shown by GET /api/v1/nodes
+type Status struct {
+	Node
+	Busy     int       `json:"busyExecutors"`
+	Online   bool      `json:"online"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// RegistryWorkflow keeps the last status each node reported, it's started by the first heartbeat
+func RegistryWorkflow(ctx workflow.Context, nodes map[string]Status) error {
+	if nodes == nil {
+		nodes = make(map[string]Status)
+	}
+	err := workflow.SetQueryHandler(ctx, nodesQuery, func() (map[string]Status, error) {
+		return nodes, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	heartbeats := workflow.GetSignalChannel(ctx, heartbeatSignal)
+	record := func(status Status) {
+		status.LastSeen = workflow.Now(ctx)
+		nodes[status.Name] = status
+	}
+	for i := 0; i < maxHeartbeats; i++ {
+		var status Status
+		heartbeats.Receive(ctx, &status)
+		record(status)
+	}
+
+	// the heartbeats received meanwhile would be lost with this run
+	for {
+		var status Status
+		if !heartbeats.ReceiveAsync(&status) {
+			break
+		}
+		record(status)
+	}
+	for name, status := range nodes {
+		if workflow.Now(ctx).Sub(status.LastSeen) > forgetAfter {
+			delete(nodes, name)
+		}
+	}
+	return workflow.NewContinueAsNewError(ctx, RegistryWorkflow, nodes)
+}
+
+// Advertise reports the status of the node to the registry until the context is done.
+// busy returns the number of busy executors, e.g. workflow.BusyExecutors.
+func Advertise(ctx context.Context, wfClient temporalClient.Client, node Node, busy func() int) {
+	options := temporalClient.StartWorkflowOptions{
+		ID:        registryWorkflowID,
+		TaskQueue: TaskQueue,
+	}
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		status := Status{Node: node, Busy: busy()}
+		_, err := wfClient.SignalWithStartWorkflow(ctx, registryWorkflowID, heartbeatSignal, status, options, RegistryWorkflow, map[string]Status{})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to report the status of node %s: %v", node.Name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// List returns the configured nodes and the ones which reported their status, sorted by name.
+// Nodes without a recent heartbeat are offline.
+func List(ctx context.Context, wfClient temporalClient.Client) ([]Status, error) {
+	reported := make(map[string]Status)
+	response, err := wfClient.QueryWorkflow(ctx, registryWorkflowID, "", nodesQuery)
+	var notFound *serviceerror.NotFound
+	switch {
+	case errors.As(err, &notFound):
+		// no worker has reported yet
+	case err != nil:
+		return nil, err
+	default:
+		if err := response.Get(&reported); err != nil {
+			return nil, err
+		}
+	}
+
+	configs, err := LoadConfigs()
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range configs {
+		if _, ok := reported[node.Name]; !ok {
+			reported[node.Name] = Status{Node: node}
+		}
+	}
+
+	statuses := make([]Status, 0, len(reported))
+	for _, status := range reported {
+		status.Online = !status.LastSeen.IsZero() && time.Since(status.LastSeen) <= offlineAfter
+		if !status.Online {
+			status.Busy = 0
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses, nil
+}
@@ -0,0 +1,51 @@
+package nodes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestRegistryWorkflow(t *testing.T) {
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(RegistryWorkflow)
+
+	linux := Node{Name: "builder-1", Labels: []string{"linux"}, Executors: 2}
+	windows := Node{Name: "builder-2", Labels: []string{"windows"}, Executors: 1}
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(heartbeatSignal, Status{Node: linux})
+		env.SignalWorkflow(heartbeatSignal, Status{Node: windows, Busy: 1})
+	}, time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(heartbeatSignal, Status{Node: linux, Busy: 2})
+	}, HeartbeatInterval)
+
+	var got map[string]Status
+	env.RegisterDelayedCallback(func() {
+		response, err := env.QueryWorkflow(nodesQuery)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if err := response.Get(&got); err != nil {
+			t.Fatalf("Failed to decode nodes: %v", err)
+		}
+		env.CancelWorkflow()
+	}, 2*HeartbeatInterval)
+
+	env.ExecuteWorkflow(RegistryWorkflow, map[string]Status{})
+
+	want := map[string]Status{
+		"builder-1": {Node: linux, Busy: 2},
+		"builder-2": {Node: windows, Busy: 1},
+	}
+	if diff := cmp.Diff(got, want, cmpopts.IgnoreFields(Status{}, "LastSeen")); diff != "" {
+		t.Errorf("Nodes are not equal (-got +want):\n%s", diff)
+	}
+	if !got["builder-1"].LastSeen.After(got["builder-2"].LastSeen) {
+		t.Errorf("Last heartbeat of builder-1 at %v should be after the one of builder-2 at %v", got["builder-1"].LastSeen, got["builder-2"].LastSeen)
+	}
+}
@@ -0,0 +1,70 @@
+package nodes
+
+import (
+	"context"
+	"fmt"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	temporalClient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
+
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+type (
+	// Activities run on TaskQueue
+	Activities struct {
+		WfClient temporalClient.Client
+	}
+)
+
+// LabelTaskQueueActivity returns the task queue a stage with the label expression is dispatched to. The workers
+// only poll the queues of the expressions their jobs had when they started, the stages with other expressions,
+// e.g. ${params.OS} or the ones of new jobs, go to the queue of the least busy online node matching them.
+func (a *Activities) LabelTaskQueueActivity(ctx context.Context, expression string) (string, error) {
+	label, err := workflow.ParseLabelExpression(expression)
+	if err != nil {
+		return "", temporal.NewNonRetryableApplicationError(err.Error(), "label", nil)
+	}
+	taskQueue, _ := workflow.LabelTaskQueue(expression)
+	described, err := a.WfClient.DescribeTaskQueue(ctx, taskQueue, enumspb.TASK_QUEUE_TYPE_ACTIVITY)
+	if err != nil {
+		return "", err
+	}
+	if len(described.GetPollers()) > 0 {
+		return taskQueue, nil
+	}
+
+	statuses, err := List(ctx, a.WfClient)
+	if err != nil {
+		return "", err
+	}
+	node, ok := leastBusy(statuses, label)
+	if !ok {
+		return "", temporal.NewNonRetryableApplicationError(fmt.Sprintf("no node matches label %s", expression), "label", nil)
+	}
+	return NodeTaskQueue(node)
+}
+
+// NodeTaskQueue is the task queue only the node polls, it's the one of its name
+func NodeTaskQueue(node Node) (string, error) {
+	return workflow.LabelTaskQueue(fmt.Sprintf("%q", node.Name))
+}
+
+// leastBusy returns the online node matching the label with the fewest busy executors for its executors
+func leastBusy(statuses []Status, label *workflow.LabelExpression) (Node, bool) {
+	var best *Status
+	for i, status := range statuses {
+		if !status.Online || !status.Node.matches(label) {
+			continue
+		}
+		// Busy/Executors < best.Busy/best.Executors
+		if best == nil || status.Busy*best.Executors < best.Busy*status.Executors {
+			best = &statuses[i]
+		}
+	}
+	if best == nil {
+		return Node{}, false
+	}
+	return best.Node, true
+}
@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	temporal "go.temporal.io/sdk/client"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+// StartJob returns the StartFunc of a build of the job. The build number is allocated when the build first tries
+// to start, so the builds are numbered in the order they leave the queue. A build retried while another one holds
+// the job keeps its number and its stored passwords. props are passed on to GroovyDSLWorkflow.
+func StartJob(wfClient temporal.Client, jobName string, pipeline *workflow.Pipeline, props map[string]interface{}) StartFunc {
+	return func(item *Item) (temporal.WorkflowRun, error) {
+		if item.buildNumber == 0 {
+			buildNumber, err := jobs.NextBuildNumber(jobName)
+			if err != nil {
+				return nil, err
+			}
+			// the passwords are kept out of the workflow history
+			params, err := pipeline.Parameters.StorePasswords(item.Params)
+			if err != nil {
+				return nil, err
+			}
+			item.buildNumber, item.storedParams = buildNumber, params
+		}
+		jobId := strconv.Itoa(item.buildNumber)
+
+		properties := make(map[string]interface{}, len(props)+4)
+		for name, value := range props {
+			properties[name] = value
+		}
+		properties["jobName"] = jobName
+		properties["jobId"] = jobId
+		properties["buildNumber"] = jobId
+		properties["params"] = item.storedParams
+
+		// builds are numbered per job, the number is the build id, e.g. /jobs/my-job/12
+		workflowOptions := temporal.StartWorkflowOptions{
+			ID:        jobName + "/" + jobId,
+			TaskQueue: workflow.DefaultTaskQueue,
+		}
+		run, err := workflow.ExecuteBuild(context.Background(), wfClient, workflowOptions, jobName, pipeline, properties)
+		if err != nil && !errors.Is(err, workflow.ErrJobRunning) {
+			// the build won't start, nothing else deletes its passwords
+			if err := pipeline.Parameters.DeletePasswords(item.storedParams); err != nil {
+				log.Printf("Unable to delete the passwords of %s #%s: %v", jobName, jobId, err)
+			}
+		}
+		return run, err
+	}
+}
+
+// JobItem returns the queue item of a build of the job. disableConcurrentBuilds() holds it back while the queue runs
+// a build of the job, ExecuteBuild refuses to start it while a build started some other way runs.
+func JobItem(wfClient temporal.Client, jobName string, pipeline *workflow.Pipeline, params map[string]any, props map[string]interface{}) *Item {
+	item := &Item{
+		JobName:   jobName,
+		Params:    params,
+		Passwords: pipeline.Parameters.PasswordNames(),
+		Start:     StartJob(wfClient, jobName, pipeline, props),
+	}
+	if pipeline.Options.DisableConcurrentBuilds() {
+		item.MaxConcurrent = 1
+	}
+	return item
+}
@@ -0,0 +1,90 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/api/serviceerror"
+	temporal "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/mocks"
+
+	"github.com/yegor86/tumbler-doll/internal/cryptography"
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+func TestRetriedStartKeepsNumberAndPasswords(t *testing.T) {
+	t.Setenv("JENKINS_HOME", t.TempDir())
+	// there are no credentials.xml, the keys are seeded anyway
+	_ = cryptography.GetInstance().LoadOrSeedCrypto()
+	if err := os.MkdirAll(jobs.JobDir("/jobs/deploy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var dslParser workflow.DslParser
+	pipeline, err := dslParser.Parse(`pipeline { agent none options { disableConcurrentBuilds() } parameters { password(name: 'TOKEN', defaultValue: '') } stages { stage('Deploy') { steps { echo 'deploy' } } } }`)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var started []map[string]interface{}
+	record := func(args mock.Arguments) {
+		started = append(started, args.Get(5).(map[string]interface{}))
+	}
+	wfClient := &mocks.Client{}
+	// another build holds the lock of the job first
+	wfClient.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, "/jobs/deploy/1", mock.Anything, mock.Anything).Return(
+		nil, serviceerror.NewWorkflowExecutionAlreadyStarted("workflow execution already started", "", "run")).Run(record).Once()
+	wfClient.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, "/jobs/deploy/1", mock.Anything, mock.Anything).Return(
+		&mocks.WorkflowRun{}, nil).Run(record).Once()
+
+	item := JobItem(wfClient, "/jobs/deploy", pipeline, map[string]any{"TOKEN": "s3cr3t"}, nil)
+	if _, err := item.Start(item); !errors.Is(err, workflow.ErrJobRunning) {
+		t.Fatalf("Expected ErrJobRunning, got %v", err)
+	}
+	if _, err := item.Start(item); err != nil {
+		t.Fatalf("Failed to start the build: %v", err)
+	}
+	wfClient.AssertExpectations(t)
+
+	if started[0]["buildNumber"] != "1" || started[1]["buildNumber"] != "1" {
+		t.Errorf("Expected the retry to keep build number 1, got %v and %v", started[0]["buildNumber"], started[1]["buildNumber"])
+	}
+	first, _ := started[0]["params"].(map[string]any)
+	second, _ := started[1]["params"].(map[string]any)
+	if first["TOKEN"] != second["TOKEN"] {
+		t.Errorf("Expected the retry to keep the stored password, got %v and %v", first["TOKEN"], second["TOKEN"])
+	}
+	if secrets, _ := os.ReadDir(filepath.Join(os.Getenv("JENKINS_HOME"), "secrets", "values")); len(secrets) != 1 {
+		t.Errorf("Expected the password to be stored once, got %d secrets", len(secrets))
+	}
+}
+
+func TestFailedStartDeletesPasswords(t *testing.T) {
+	t.Setenv("JENKINS_HOME", t.TempDir())
+	_ = cryptography.GetInstance().LoadOrSeedCrypto()
+	if err := os.MkdirAll(jobs.JobDir("/jobs/deploy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var dslParser workflow.DslParser
+	pipeline, err := dslParser.Parse(`pipeline { agent none parameters { password(name: 'TOKEN', defaultValue: '') } stages { stage('Deploy') { steps { echo 'deploy' } } } }`)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	wfClient := &mocks.Client{}
+	wfClient.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		temporal.WorkflowRun(nil), errors.New("temporal is unavailable"))
+
+	item := JobItem(wfClient, "/jobs/deploy", pipeline, map[string]any{"TOKEN": "s3cr3t"}, nil)
+	if _, err := item.Start(item); err == nil {
+		t.Fatalf("Expected the build not to start")
+	}
+	if secrets, _ := os.ReadDir(filepath.Join(os.Getenv("JENKINS_HOME"), "secrets", "values")); len(secrets) != 0 {
+		t.Errorf("Expected the password of the failed build to be deleted, got %d secrets", len(secrets))
+	}
+}
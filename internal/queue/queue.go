@@ -0,0 +1,360 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	temporal "go.temporal.io/sdk/client"
+
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+const (
+	// leftItemsRetention is how long started and cancelled items can still be looked up, e.g. to find the build of a queued item
+	leftItemsRetention = 5 * time.Minute
+	// busyRetryInterval is how long an item waits before trying again when a build started outside of the queue holds its job
+	busyRetryInterval = 10 * time.Second
+)
+
+type (
+	// Options configure a queue, zero limits mean no limit
+	Options struct {
+		// QuietPeriod is how long an item waits for duplicates before it can start
+		QuietPeriod time.Duration
+		// MaxBuilds caps the builds running at once
+		MaxBuilds int
+		// MaxBuildsPerJob caps the builds of a job running at once
+		MaxBuildsPerJob int
+	}
+
+	// StartFunc starts the build of a queued item
+	StartFunc func(item *Item) (temporal.WorkflowRun, error)
+
+	// Item is a build waiting to start
+	Item struct {
+		Id      int64          `json:"id"`
+		JobName string         `json:"jobName"`
+		Params  map[string]any `json:"params,omitempty"`
+		// Passwords names the password parameters, their values are masked in the JSON of the item
+		Passwords []string `json:"-"`
+		Priority  int      `json:"priority"`
+		// MaxConcurrent caps the running builds of the job, e.g. 1 with disableConcurrentBuilds(), 0 means the queue limit
+		MaxConcurrent int `json:"-"`
+		// Triggers counts the requests collapsed into the item during the quiet period
+		Triggers     int       `json:"triggers"`
+		InQueueSince time.Time `json:"inQueueSince"`
+		ReadyAt      time.Time `json:"readyAt"`
+		// Why tells why the item is still waiting
+		Why       string `json:"why,omitempty"`
+		Cancelled bool   `json:"cancelled,omitempty"`
+		// Error is why the build of the item failed to start
+		Error      string    `json:"error,omitempty"`
+		WorkflowID string    `json:"workflowId,omitempty"`
+		RunId      string    `json:"runId,omitempty"`
+		Start      StartFunc `json:"-"`
+
+		leftAt time.Time
+		// buildNumber and storedParams are allocated by the first attempt of StartJob, the retries reuse them
+		buildNumber  int
+		storedParams map[string]any
+	}
+
+	// Queue holds builds back until their quiet period is over and the concurrency limits allow them to run.
+	// Items of the same job with the same parameters are collapsed while they wait.
+	Queue struct {
+		options Options
+
+		mutex   sync.Mutex
+		nextId  int64
+		waiting []*Item
+		left    map[int64]*Item
+		running map[string]int
+		total   int
+		wakeup  chan struct{}
+		// ctx bounds the wait for running builds, it's the one passed to Run
+		ctx context.Context
+	}
+)
+
+// New returns an empty queue, call Run to start dispatching its items
+func New(options Options) *Queue {
+	return &Queue{
+		options: options,
+		nextId:  1,
+		left:    make(map[int64]*Item),
+		running: make(map[string]int),
+		wakeup:  make(chan struct{}, 1),
+		ctx:     context.Background(),
+	}
+}
+
+// Schedule adds the item to the queue. If an item of the same job with the same parameters is already
+// waiting, the request is collapsed into it and that item is returned instead. Without a quiet period
+// the item starts right away when the limits allow it, the returned item has the workflow id then.
+func (q *Queue) Schedule(item *Item) *Item {
+	id := q.add(item)
+	q.dispatch()
+	// the next item to become ready may have changed
+	q.wake()
+	item, _ = q.Get(id)
+	return item
+}
+
+func (q *Queue) add(item *Item) int64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, waiting := range q.waiting {
+		if waiting.JobName == item.JobName && reflect.DeepEqual(waiting.Params, item.Params) {
+			waiting.Triggers++
+			if item.Priority > waiting.Priority {
+				waiting.Priority = item.Priority
+			}
+			return waiting.Id
+		}
+	}
+
+	now := time.Now()
+	item.Id = q.nextId
+	q.nextId++
+	item.Triggers = 1
+	item.InQueueSince = now
+	item.ReadyAt = now.Add(q.options.QuietPeriod)
+	item.Why = "In the quiet period"
+	q.waiting = append(q.waiting, item)
+	return item.Id
+}
+
+// Items returns the waiting items in the order they'd start in
+func (q *Queue) Items() []*Item {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.sort()
+	items := make([]*Item, 0, len(q.waiting))
+	for _, item := range q.waiting {
+		items = append(items, item.copy())
+	}
+	return items
+}
+
+// QuietPeriod is how long the items wait for duplicates, builds started outside of the queue wait as long
+func (q *Queue) QuietPeriod() time.Duration {
+	return q.options.QuietPeriod
+}
+
+// Get returns a waiting item, or an item that left the queue recently
+func (q *Queue) Get(id int64) (*Item, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, item := range q.waiting {
+		if item.Id == id {
+			return item.copy(), true
+		}
+	}
+	if item, ok := q.left[id]; ok {
+		return item.copy(), true
+	}
+	return nil, false
+}
+
+// Cancel removes a waiting item from the queue, it reports false if the item isn't waiting
+func (q *Queue) Cancel(id int64) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i, item := range q.waiting {
+		if item.Id == id {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			item.Cancelled = true
+			item.Why = ""
+			q.leave(item)
+			return true
+		}
+	}
+	return false
+}
+
+// Run starts the items as they become ready until the context is done
+func (q *Queue) Run(ctx context.Context) {
+	q.mutex.Lock()
+	q.ctx = ctx
+	q.mutex.Unlock()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		next := q.dispatch()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wakeup:
+		case <-timer.C:
+		}
+	}
+}
+
+// dispatch starts the ready items the limits allow and returns when the next item becomes ready.
+// The builds are started without holding the lock, starting one takes a call to Temporal.
+func (q *Queue) dispatch() time.Time {
+	ready, next := q.takeReady()
+	for _, item := range ready {
+		q.start(item)
+	}
+	return next
+}
+
+// takeReady takes the ready items the limits allow off the waiting list and holds their slots
+func (q *Queue) takeReady() ([]*Item, time.Time) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	var ready []*Item
+	var next time.Time
+	q.sort()
+	for i := 0; i < len(q.waiting); {
+		item := q.waiting[i]
+		if now.Before(item.ReadyAt) {
+			if next.IsZero() || item.ReadyAt.Before(next) {
+				next = item.ReadyAt
+			}
+			i++
+			continue
+		}
+		if why := q.blocked(item); why != "" {
+			item.Why = why
+			i++
+			continue
+		}
+
+		q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+		item.Why = ""
+		q.leave(item)
+		q.running[item.JobName]++
+		q.total++
+		ready = append(ready, item)
+	}
+
+	for id, item := range q.left {
+		if now.Sub(item.leftAt) > leftItemsRetention {
+			delete(q.left, id)
+		}
+	}
+	return ready, next
+}
+
+// blocked tells why the limits don't let the item start, it's empty if they do
+func (q *Queue) blocked(item *Item) string {
+	maxPerJob := q.options.MaxBuildsPerJob
+	if item.MaxConcurrent > 0 && (maxPerJob == 0 || item.MaxConcurrent < maxPerJob) {
+		maxPerJob = item.MaxConcurrent
+	}
+	if maxPerJob > 0 && q.running[item.JobName] >= maxPerJob {
+		return "Build of " + item.JobName + " is already in progress"
+	}
+	if q.options.MaxBuilds > 0 && q.total >= q.options.MaxBuilds {
+		return "Waiting for next available executor"
+	}
+	return ""
+}
+
+// start runs the build of an item taken by takeReady and holds its slot until the build completes
+func (q *Queue) start(item *Item) {
+	run, err := item.Start(item)
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if err != nil {
+		q.running[item.JobName]--
+		q.total--
+	}
+	if errors.Is(err, workflow.ErrJobRunning) {
+		// e.g. a restarted build, or one started before the queue was
+		delete(q.left, item.Id)
+		item.Why = "Build of " + item.JobName + " is already in progress"
+		item.ReadyAt = time.Now().Add(busyRetryInterval)
+		q.waiting = append(q.waiting, item)
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to start queued build of %s: %v", item.JobName, err)
+		item.Error = err.Error()
+		return
+	}
+	item.WorkflowID = run.GetID()
+	item.RunId = run.GetRunID()
+
+	ctx := q.ctx
+	go func() {
+		// the build itself triggers the jobs downstream of it, the queue only waits to free its slot
+		run.Get(ctx, nil)
+
+		q.mutex.Lock()
+		q.running[item.JobName]--
+		q.total--
+		q.mutex.Unlock()
+		q.wake()
+	}()
+}
+
+func (q *Queue) leave(item *Item) {
+	item.leftAt = time.Now()
+	q.left[item.Id] = item
+}
+
+// sort orders the waiting items by priority, then by the time they were queued at
+func (q *Queue) sort() {
+	sort.SliceStable(q.waiting, func(i, j int) bool {
+		if q.waiting[i].Priority != q.waiting[j].Priority {
+			return q.waiting[i].Priority > q.waiting[j].Priority
+		}
+		return q.waiting[i].InQueueSince.Before(q.waiting[j].InQueueSince)
+	})
+}
+
+func (q *Queue) wake() {
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (item *Item) copy() *Item {
+	c := *item
+	return &c
+}
+
+// MarshalJSON masks the values of the password parameters, the queue is listed by the API
+func (item Item) MarshalJSON() ([]byte, error) {
+	type plain Item
+	masked := plain(item)
+	if len(item.Passwords) > 0 && len(item.Params) > 0 {
+		masked.Params = make(map[string]any, len(item.Params))
+		for name, value := range item.Params {
+			if slices.Contains(item.Passwords, name) {
+				value = "********"
+			}
+			masked.Params[name] = value
+		}
+	}
+	return json.Marshal(masked)
+}
@@ -0,0 +1,228 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	temporal "go.temporal.io/sdk/client"
+
+	"github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+// build is a running build that completes when done is closed
+type build struct {
+	temporal.WorkflowRun
+	id   string
+	done chan struct{}
+}
+
+func (b *build) GetID() string    { return b.id }
+func (b *build) GetRunID() string { return "run-" + b.id }
+func (b *build) Get(ctx context.Context, valuePtr interface{}) error {
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// starter records the builds started by the queue
+type starter struct {
+	mutex   sync.Mutex
+	started chan string
+	builds  map[string]*build
+}
+
+func newStarter() *starter {
+	return &starter{started: make(chan string, 10), builds: make(map[string]*build)}
+}
+
+func (s *starter) item(jobName string, params map[string]any, priority int) *Item {
+	return &Item{
+		JobName:  jobName,
+		Params:   params,
+		Priority: priority,
+		Start: func(item *Item) (temporal.WorkflowRun, error) {
+			id := fmt.Sprintf("%s/%d", item.JobName, item.Id)
+			b := &build{id: id, done: make(chan struct{})}
+			s.mutex.Lock()
+			s.builds[id] = b
+			s.mutex.Unlock()
+			s.started <- id
+			return b, nil
+		},
+	}
+}
+
+// complete completes a started build
+func (s *starter) complete(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	close(s.builds[id].done)
+}
+
+func (s *starter) expect(t *testing.T, want ...string) {
+	t.Helper()
+	var got []string
+	for range want {
+		select {
+		case id := <-s.started:
+			got = append(got, id)
+		case <-time.After(time.Second):
+		}
+	}
+	select {
+	case id := <-s.started:
+		got = append(got, id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected builds started (-got +want):\n%s", diff)
+	}
+}
+
+func TestQuietPeriodCollapsesDuplicates(t *testing.T) {
+	q := New(Options{QuietPeriod: 100 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	s := newStarter()
+	first := q.Schedule(s.item("/jobs/app", map[string]any{"TARGET": "staging"}, 0))
+	second := q.Schedule(s.item("/jobs/app", map[string]any{"TARGET": "staging"}, 0))
+	other := q.Schedule(s.item("/jobs/app", map[string]any{"TARGET": "production"}, 0))
+
+	if second.Id != first.Id || second.Triggers != 2 {
+		t.Errorf("Expected the duplicate to be collapsed into item %d, got %+v", first.Id, second)
+	}
+	if other.Id == first.Id {
+		t.Errorf("Expected builds with other parameters to be queued separately")
+	}
+	if items := q.Items(); len(items) != 2 || items[0].Why != "In the quiet period" {
+		t.Errorf("Unexpected queue %+v", items)
+	}
+
+	s.expect(t, "/jobs/app/1", "/jobs/app/2")
+	item, ok := q.Get(first.Id)
+	if !ok || item.WorkflowID != "/jobs/app/1" {
+		t.Errorf("Expected item %d to have started /jobs/app/1, got %+v", first.Id, item)
+	}
+}
+
+func TestConcurrencyLimits(t *testing.T) {
+	q := New(Options{MaxBuilds: 2})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	s := newStarter()
+	item := s.item("/jobs/deploy", nil, 0)
+	item.MaxConcurrent = 1
+	started := q.Schedule(item)
+	if started.WorkflowID != "/jobs/deploy/1" {
+		t.Errorf("Expected the build to start right away, got %+v", started)
+	}
+	s.expect(t, "/jobs/deploy/1")
+
+	// disableConcurrentBuilds() holds the second build back
+	item = s.item("/jobs/deploy", map[string]any{"TARGET": "production"}, 0)
+	item.MaxConcurrent = 1
+	waiting := q.Schedule(item)
+	q.Schedule(s.item("/jobs/test", nil, 0))
+	s.expect(t, "/jobs/test/3")
+	if waiting, _ = q.Get(waiting.Id); waiting.WorkflowID != "" || waiting.Why != "Build of /jobs/deploy is already in progress" {
+		t.Errorf("Expected the build to wait for the running one, got %+v", waiting)
+	}
+
+	// the global limit is reached, the higher priority item goes first once a build completes
+	low := q.Schedule(s.item("/jobs/lint", nil, 0))
+	q.Schedule(s.item("/jobs/release", nil, 10))
+	if low, _ = q.Get(low.Id); low.Why != "Waiting for next available executor" {
+		t.Errorf("Expected the build to wait for an executor, got %+v", low)
+	}
+	s.complete("/jobs/test/3")
+	s.expect(t, "/jobs/release/5")
+
+	s.complete("/jobs/deploy/1")
+	s.expect(t, "/jobs/deploy/2")
+
+	if !q.Cancel(low.Id) {
+		t.Errorf("Expected item %d to be cancelled", low.Id)
+	}
+	if q.Cancel(low.Id) {
+		t.Errorf("Expected a cancelled item not to be cancelled again")
+	}
+	s.complete("/jobs/release/5")
+	s.expect(t)
+	if items := q.Items(); len(items) != 0 {
+		t.Errorf("Expected the queue to be empty, got %+v", items)
+	}
+}
+
+func TestBuildStartedOutsideOfTheQueue(t *testing.T) {
+	q := New(Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	// e.g. a restarted build of a job with disableConcurrentBuilds() holds the lock of the job
+	item := &Item{
+		JobName: "/jobs/deploy",
+		Start: func(item *Item) (temporal.WorkflowRun, error) {
+			return nil, workflow.ErrJobRunning
+		},
+	}
+	waiting := q.Schedule(item)
+	if waiting.WorkflowID != "" || waiting.Error != "" || waiting.Why != "Build of /jobs/deploy is already in progress" {
+		t.Errorf("Expected the build to wait for the running one, got %+v", waiting)
+	}
+	if items := q.Items(); len(items) != 1 || !items[0].ReadyAt.After(time.Now()) {
+		t.Errorf("Expected the item to be retried later, got %+v", items)
+	}
+}
+
+func TestStartOutsideOfTheLock(t *testing.T) {
+	q := New(Options{})
+
+	// starting a build takes a call to Temporal, the queue stays available meanwhile
+	listed := make(chan []*Item, 1)
+	item := &Item{
+		JobName: "/jobs/app",
+		Start: func(item *Item) (temporal.WorkflowRun, error) {
+			listed <- q.Items()
+			return &build{id: "/jobs/app/1", done: make(chan struct{})}, nil
+		},
+	}
+	started := q.Schedule(item)
+	if started.WorkflowID != "/jobs/app/1" {
+		t.Errorf("Expected the build to start, got %+v", started)
+	}
+	if items := <-listed; len(items) != 0 {
+		t.Errorf("Expected the starting item to have left the queue, got %+v", items)
+	}
+}
+
+func TestPasswordsAreMasked(t *testing.T) {
+	item := &Item{
+		JobName:   "/jobs/deploy",
+		Params:    map[string]any{"TARGET": "production", "TOKEN": "s3cr3t"},
+		Passwords: []string{"TOKEN"},
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		t.Fatalf("Failed to encode item: %v", err)
+	}
+	if strings.Contains(string(data), "s3cr3t") || !strings.Contains(string(data), `"TARGET":"production"`) {
+		t.Errorf("Expected the password to be masked, got %s", data)
+	}
+	if item.Params["TOKEN"] != "s3cr3t" {
+		t.Errorf("Expected the item to keep the password, got %v", item.Params)
+	}
+}
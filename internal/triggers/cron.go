@@ -0,0 +1,131 @@
+package triggers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// cronField is the range of values of a field of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+	// hashMax bounds the hashed values, e.g. days of month stop at 28 so that H runs every month
+	hashMax int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59, hashMax: 59},
+	{name: "hour", min: 0, max: 23, hashMax: 23},
+	{name: "day of month", min: 1, max: 31, hashMax: 28},
+	{name: "month", min: 1, max: 12, hashMax: 12},
+	{name: "day of week", min: 0, max: 7, hashMax: 6},
+}
+
+// cronAliases are the shortcuts Jenkins accepts instead of the five fields
+var cronAliases = map[string]string{
+	"@yearly":   "H H H H *",
+	"@annually": "H H H H *",
+	"@monthly":  "H H H * *",
+	"@weekly":   "H H * * H",
+	"@daily":    "H H * * *",
+	"@midnight": "H H(0-2) * * *",
+	"@hourly":   "H * * * *",
+}
+
+// ExpandCron turns a Jenkins cron spec into standard cron expressions, one per line of the spec.
+// The H symbol stands for a value derived from the seed, typically the job name, so that the jobs
+// scheduled with the same spec don't all start at once: H, H/15, H(0-7) and H(0-7)/2 are accepted.
+// Blank lines and comments starting with # are skipped.
+func ExpandCron(spec string, seed string) ([]string, error) {
+	random := rand.New(rand.NewSource(hashOf(seed)))
+
+	var expressions []string
+	for _, line := range strings.Split(spec, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if alias, ok := cronAliases[line]; ok {
+			line = alias
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != len(cronFields) {
+			return nil, fmt.Errorf("invalid cron spec %q: expected %d fields, got %d", line, len(cronFields), len(fields))
+		}
+		for i, field := range fields {
+			parts := strings.Split(field, ",")
+			for j, part := range parts {
+				expanded, err := cronFields[i].expand(part, random)
+				if err != nil {
+					return nil, fmt.Errorf("invalid cron spec %q: %w", line, err)
+				}
+				parts[j] = expanded
+			}
+			fields[i] = strings.Join(parts, ",")
+		}
+		expressions = append(expressions, strings.Join(fields, " "))
+	}
+	if len(expressions) == 0 {
+		return nil, fmt.Errorf("empty cron spec")
+	}
+	return expressions, nil
+}
+
+// expand replaces the H symbol of a part of the field, other parts are kept as they are
+func (field cronField) expand(part string, random *rand.Rand) (string, error) {
+	if !strings.HasPrefix(part, "H") {
+		return part, nil
+	}
+
+	low, high := field.min, field.hashMax
+	rest := part[1:]
+	if strings.HasPrefix(rest, "(") {
+		end := strings.Index(rest, ")")
+		if end < 0 {
+			return "", fmt.Errorf("unclosed range in %s field: %s", field.name, part)
+		}
+		var err error
+		if low, high, err = field.parseRange(rest[1:end]); err != nil {
+			return "", err
+		}
+		rest = rest[end+1:]
+	}
+
+	switch {
+	case rest == "":
+		return strconv.Itoa(low + random.Intn(high-low+1)), nil
+	case strings.HasPrefix(rest, "/"):
+		step, err := strconv.Atoi(rest[1:])
+		if err != nil || step <= 0 {
+			return "", fmt.Errorf("invalid step in %s field: %s", field.name, part)
+		}
+		// the offset keeps the runs within the range, e.g. H/15 is one of 0-59/15 ... 14-59/15
+		offset := random.Intn(min(step, high-low+1))
+		return fmt.Sprintf("%d-%d/%d", low+offset, high, step), nil
+	}
+	return "", fmt.Errorf("invalid %s field: %s", field.name, part)
+}
+
+// parseRange reads a-b, it must be within the range of the field
+func (field cronField) parseRange(r string) (int, int, error) {
+	bounds := strings.Split(r, "-")
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("invalid range in %s field: %s", field.name, r)
+	}
+	low, errLow := strconv.Atoi(bounds[0])
+	high, errHigh := strconv.Atoi(bounds[1])
+	if errLow != nil || errHigh != nil || low > high || low < field.min || high > field.max {
+		return 0, 0, fmt.Errorf("invalid range in %s field: %s", field.name, r)
+	}
+	return low, high, nil
+}
+
+func hashOf(seed string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+	return int64(h.Sum64())
+}
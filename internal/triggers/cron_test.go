@@ -0,0 +1,81 @@
+package triggers
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExpandCron(t *testing.T) {
+	for _, tt := range []struct {
+		spec string
+		want []string
+	}{
+		{"0 2 * * 1-5", []string{"0 2 * * 1-5"}},
+		{"# nightly\n\n0 2 * * *\n30 14 * * *", []string{"0 2 * * *", "30 14 * * *"}},
+	} {
+		got, err := ExpandCron(tt.spec, "/jobs/nightly")
+		if err != nil {
+			t.Fatalf("Failed to expand %q: %v", tt.spec, err)
+		}
+		if diff := cmp.Diff(got, tt.want); diff != "" {
+			t.Errorf("Unexpected expressions for %q (-got +want):\n%s", tt.spec, diff)
+		}
+	}
+}
+
+func TestExpandCronHash(t *testing.T) {
+	expand := func(spec string, seed string) []string {
+		expressions, err := ExpandCron(spec, seed)
+		if err != nil {
+			t.Fatalf("Failed to expand %q: %v", spec, err)
+		}
+		return strings.Fields(expressions[0])
+	}
+	inRange := func(field string, low int, high int) bool {
+		value, err := strconv.Atoi(field)
+		return err == nil && value >= low && value <= high
+	}
+
+	fields := expand("H H(0-5) H * H", "/jobs/nightly")
+	if !inRange(fields[0], 0, 59) || !inRange(fields[1], 0, 5) || !inRange(fields[2], 1, 28) || fields[3] != "*" || !inRange(fields[4], 0, 6) {
+		t.Errorf("Unexpected hashed fields %v", fields)
+	}
+	if diff := cmp.Diff(expand("H H(0-5) H * H", "/jobs/nightly"), fields); diff != "" {
+		t.Errorf("Hashed values must be stable (-got +want):\n%s", diff)
+	}
+
+	// the jobs scheduled with the same spec start at different minutes
+	minutes := make(map[string]bool)
+	for _, seed := range []string{"/jobs/a", "/jobs/b", "/jobs/c", "/jobs/d", "/jobs/e"} {
+		minutes[expand("H 2 * * *", seed)[0]] = true
+	}
+	if len(minutes) < 2 {
+		t.Errorf("Expected the minutes to be spread, got %v", minutes)
+	}
+
+	step := expand("H/15 * * * *", "/jobs/nightly")[0]
+	start, rest, _ := strings.Cut(step, "-")
+	if !inRange(start, 0, 14) || rest != "59/15" {
+		t.Errorf("Unexpected H/15 expansion %s", step)
+	}
+	step = expand("H(10-20)/5 * * * *", "/jobs/nightly")[0]
+	start, rest, _ = strings.Cut(step, "-")
+	if !inRange(start, 10, 14) || rest != "20/5" {
+		t.Errorf("Unexpected H(10-20)/5 expansion %s", step)
+	}
+
+	if fields := expand("@daily", "/jobs/nightly"); !inRange(fields[0], 0, 59) || !inRange(fields[1], 0, 23) || fields[2] != "*" {
+		t.Errorf("Unexpected @daily expansion %v", fields)
+	}
+}
+
+func TestExpandCronErrors(t *testing.T) {
+	for _, spec := range []string{"", "H 2 * *", "H(0-70) * * * *", "H/0 * * * *", "H(1-2 * * * *", "Hx * * * *"} {
+		if _, err := ExpandCron(spec, "/jobs/nightly"); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
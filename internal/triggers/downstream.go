@@ -0,0 +1,34 @@
+package triggers
+
+import (
+	"context"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+	wf "github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+// PrepareDownstreamBuildActivity finds the job started by the build step, e.g. folder/other, parses its pipeline,
+// resolves the parameter values and allocates the number of the downstream build. The build step starts
+// the build itself, after the quiet period of the queue.
+func (a *Activities) PrepareDownstreamBuildActivity(ctx context.Context, jobPath string, values map[string]any) (*wf.DownstreamJob, error) {
+	jobName := jobs.FullName(jobPath)
+	pipeline, params, err := a.Dispatcher.resolve(jobName, values)
+	if err != nil {
+		return nil, err
+	}
+	// the passwords are kept out of the workflow history
+	if params, err = pipeline.Parameters.StorePasswords(params); err != nil {
+		return nil, err
+	}
+	number, err := jobs.NextBuildNumber(jobName)
+	if err != nil {
+		return nil, err
+	}
+	return &wf.DownstreamJob{
+		JobName:     jobName,
+		Number:      number,
+		Pipeline:    *pipeline,
+		Params:      params,
+		QuietPeriod: a.Dispatcher.queue.QuietPeriod(),
+	}, nil
+}
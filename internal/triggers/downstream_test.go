@@ -0,0 +1,25 @@
+package triggers
+
+import (
+	"errors"
+	"testing"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+
+	"github.com/yegor86/tumbler-doll/internal/queue"
+)
+
+func TestPrepareUnknownDownstreamJob(t *testing.T) {
+	activities := &Activities{Dispatcher: NewDispatcher(nil, queue.New(queue.Options{}), "")}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestActivityEnvironment()
+	env.RegisterActivity(activities)
+
+	_, err := env.ExecuteActivity(activities.PrepareDownstreamBuildActivity, "components/missing", map[string]any{})
+	var applicationErr *temporal.ApplicationError
+	if !errors.As(err, &applicationErr) || !applicationErr.NonRetryable() {
+		t.Fatalf("Expected a non-retryable error for an unknown job, got %v", err)
+	}
+}
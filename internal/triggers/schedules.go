@@ -0,0 +1,173 @@
+package triggers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	temporalClient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+	wf "github.com/yegor86/tumbler-doll/internal/workflow"
+)
+
+// schedulePrefix marks the schedules registered for triggers, the job name and the cause follow,
+// e.g. trigger:/jobs/nightly/timer
+const schedulePrefix = "trigger:"
+
+// Sync registers the triggers of the jobs: a Temporal schedule per job for its cron triggers and another one
+// for its pollSCM triggers. The schedules of jobs which no longer have such triggers are deleted.
+// It's meant to be registered with JobDatabase.OnLoad.
+func (d *Dispatcher) Sync(ctx context.Context, root *jobs.Job) error {
+	schedules := make(map[string]temporalClient.ScheduleOptions)
+	downstream := make(map[string][]downstreamJob)
+
+	var parser wf.DslParser
+	walkJobs(root, func(job *jobs.Job) {
+		pipeline, err := parser.ParseFile(job.Name, job.Script)
+		if err != nil {
+			log.Printf("Skipping triggers of %s: %v", job.Name, err)
+			return
+		}
+
+		var cronSpecs, pollSpecs []string
+		for _, trigger := range pipeline.Triggers {
+			switch {
+			case trigger.Cron != nil:
+				cronSpecs = append(cronSpecs, trigger.Cron.Literal())
+			case trigger.PollSCM != nil:
+				pollSpecs = append(pollSpecs, trigger.PollSCM.Literal())
+			case trigger.Upstream != nil:
+				for _, name := range trigger.Upstream.Names() {
+					upstreamName := jobs.FullName(name)
+					downstream[upstreamName] = append(downstream[upstreamName], downstreamJob{
+						jobName:   job.Name,
+						threshold: trigger.Upstream.ThresholdResult(),
+					})
+				}
+			}
+		}
+
+		if len(cronSpecs) > 0 {
+			request := Request{JobName: job.Name, Cause: jobs.TimerCause}
+			if options, err := scheduleOptions(request, cronSpecs, d.timeZone); err != nil {
+				log.Printf("Skipping cron trigger of %s: %v", job.Name, err)
+			} else {
+				schedules[options.ID] = options
+			}
+		}
+		if len(pollSpecs) > 0 {
+			request := Request{JobName: job.Name, Cause: jobs.SCMCause, Checkouts: polledCheckouts(pipeline)}
+			if len(request.Checkouts) == 0 {
+				log.Printf("Skipping pollSCM trigger of %s: the pipeline has no git step to poll", job.Name)
+			} else if options, err := scheduleOptions(request, pollSpecs, d.timeZone); err != nil {
+				log.Printf("Skipping pollSCM trigger of %s: %v", job.Name, err)
+			} else {
+				schedules[options.ID] = options
+			}
+		}
+	})
+
+	d.mutex.Lock()
+	d.downstream = downstream
+	d.mutex.Unlock()
+
+	return d.syncSchedules(ctx, schedules)
+}
+
+// syncSchedules creates or updates the schedules and deletes the other trigger schedules
+func (d *Dispatcher) syncSchedules(ctx context.Context, schedules map[string]temporalClient.ScheduleOptions) error {
+	scheduleClient := d.wfClient.ScheduleClient()
+	var errs []error
+
+	for id, options := range schedules {
+		_, err := scheduleClient.Create(ctx, options)
+		if errors.Is(err, temporal.ErrScheduleAlreadyRunning) {
+			err = scheduleClient.GetHandle(ctx, id).Update(ctx, temporalClient.ScheduleUpdateOptions{
+				DoUpdate: func(input temporalClient.ScheduleUpdateInput) (*temporalClient.ScheduleUpdate, error) {
+					schedule := input.Description.Schedule
+					schedule.Spec = &options.Spec
+					schedule.Action = options.Action
+					return &temporalClient.ScheduleUpdate{Schedule: &schedule}, nil
+				},
+			})
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	existing, err := scheduleClient.List(ctx, temporalClient.ScheduleListOptions{})
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for existing.HasNext() {
+		entry, err := existing.Next()
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if _, ok := schedules[entry.ID]; ok || !strings.HasPrefix(entry.ID, schedulePrefix) {
+			continue
+		}
+		if err := scheduleClient.GetHandle(ctx, entry.ID).Delete(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// scheduleOptions returns the schedule which starts TriggerWorkflow with the request at the times of the specs,
+// read in the time zone. Temporal reads them in UTC when it's empty.
+func scheduleOptions(request Request, specs []string, timeZone string) (temporalClient.ScheduleOptions, error) {
+	var expressions []string
+	for _, spec := range specs {
+		// the job name spreads the H values
+		expanded, err := ExpandCron(spec, request.JobName)
+		if err != nil {
+			return temporalClient.ScheduleOptions{}, err
+		}
+		expressions = append(expressions, expanded...)
+	}
+
+	id := schedulePrefix + request.JobName + "/" + request.Cause
+	return temporalClient.ScheduleOptions{
+		ID:   id,
+		Spec: temporalClient.ScheduleSpec{CronExpressions: expressions, TimeZoneName: timeZone},
+		Action: &temporalClient.ScheduleWorkflowAction{
+			ID:        id,
+			Workflow:  TriggerWorkflow,
+			Args:      []interface{}{request},
+			TaskQueue: TaskQueue,
+		},
+		// a build still waiting for its trigger isn't worth a second one
+		Overlap: enumspb.SCHEDULE_OVERLAP_POLICY_SKIP,
+	}, nil
+}
+
+// polledCheckouts returns the git steps of the pipeline which can be polled, the ones with values known
+// only at runtime are left out
+func polledCheckouts(pipeline *wf.Pipeline) []map[string]interface{} {
+	var checkouts []map[string]interface{}
+	for _, checkout := range pipeline.Checkouts() {
+		url, _ := checkout["url"].(string)
+		branch, _ := checkout["branch"].(string)
+		if url == "" || branch == "" || strings.Contains(url+branch, "${") {
+			continue
+		}
+		checkouts = append(checkouts, checkout)
+	}
+	return checkouts
+}
+
+func walkJobs(job *jobs.Job, visit func(job *jobs.Job)) {
+	if !job.IsDir && job.Script != "" {
+		visit(job)
+	}
+	for _, child := range job.Children {
+		walkJobs(child, visit)
+	}
+}
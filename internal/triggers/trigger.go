@@ -0,0 +1,184 @@
+package triggers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	temporalClient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+	"github.com/yegor86/tumbler-doll/internal/queue"
+	wf "github.com/yegor86/tumbler-doll/internal/workflow"
+	"github.com/yegor86/tumbler-doll/plugins"
+	"github.com/yegor86/tumbler-doll/plugins/scm"
+)
+
+// TaskQueue is served by the API, where the build queue lives. The polling itself runs on the job workers,
+// which have the SCM plugin.
+const TaskQueue = wf.TriggerTaskQueue
+
+// triggerErrType is the application error type of the builds which can't be triggered, retrying doesn't help them
+const triggerErrType = "trigger"
+
+type (
+	// Request is passed by the schedule of a trigger to TriggerWorkflow
+	Request struct {
+		JobName string
+		// Cause is jobs.TimerCause or jobs.SCMCause
+		Cause string
+		// Checkouts are the parameters of the git steps polled for changes
+		Checkouts []map[string]interface{}
+	}
+
+	// Dispatcher enqueues the builds of triggered jobs and keeps track of their triggers
+	Dispatcher struct {
+		wfClient temporalClient.Client
+		queue    *queue.Queue
+		// timeZone is the IANA name of the time zone the cron and pollSCM specs are read in, UTC when empty
+		timeZone string
+
+		mutex sync.RWMutex
+		// downstream lists the jobs with an upstream trigger by the name of the upstream job
+		downstream map[string][]downstreamJob
+	}
+
+	downstreamJob struct {
+		jobName   string
+		threshold wf.Result
+	}
+
+	// Activities run on TaskQueue
+	Activities struct {
+		Dispatcher *Dispatcher
+	}
+)
+
+// NewDispatcher returns a dispatcher which enqueues the triggered builds in the build queue.
+// The cron and pollSCM specs are read in the time zone, e.g. Europe/Berlin, or in UTC when it's empty.
+func NewDispatcher(wfClient temporalClient.Client, buildQueue *queue.Queue, timeZone string) *Dispatcher {
+	return &Dispatcher{
+		wfClient:   wfClient,
+		queue:      buildQueue,
+		timeZone:   timeZone,
+		downstream: make(map[string][]downstreamJob),
+	}
+}
+
+// TriggerWorkflow is started by the schedules of the cron and pollSCM triggers. It enqueues a build of the job,
+// polling triggers only do so when a polled branch moved since the last poll.
+func TriggerWorkflow(ctx workflow.Context, request Request) error {
+	logger := workflow.GetLogger(ctx)
+
+	if request.Cause == jobs.SCMCause {
+		pollCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+			TaskQueue:           wf.DefaultTaskQueue,
+			StartToCloseTimeout: 5 * time.Minute,
+			// the next poll is as good as a retry
+			RetryPolicy: &temporal.RetryPolicy{MaximumAttempts: 1},
+		})
+		var changed bool
+		err := workflow.ExecuteActivity(pollCtx, "PollSCMActivity", request.JobName, request.Checkouts).Get(ctx, &changed)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			logger.Info("No changes", "job", request.JobName)
+			return nil
+		}
+	}
+
+	enqueueCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+	})
+	return workflow.ExecuteActivity(enqueueCtx, "EnqueueBuildActivity", request).Get(ctx, nil)
+}
+
+// PollSCMActivity asks the SCM plugin for the heads of the polled branches and reports whether any of them moved
+func PollSCMActivity(ctx context.Context, jobName string, checkouts []map[string]interface{}) (bool, error) {
+	scmPlugin, ok := plugins.GetInstance().FindPlugin("scm").(*scm.ScmPlugin)
+	if !ok {
+		return false, fmt.Errorf("scm plugin is not registered")
+	}
+
+	heads := make(map[string]string, len(checkouts))
+	for _, checkout := range checkouts {
+		head, err := scmPlugin.RemoteHead(checkout)
+		if err != nil {
+			return false, err
+		}
+		heads[fmt.Sprintf("%v#%v", checkout["url"], checkout["branch"])] = head
+	}
+	return jobs.UpdatePollingBaseline(jobName, heads)
+}
+
+// EnqueueBuildActivity enqueues a build of the triggered job and returns the id of its queue item
+func (a *Activities) EnqueueBuildActivity(ctx context.Context, request Request) (int64, error) {
+	return a.Dispatcher.enqueue(request.JobName, map[string]interface{}{"triggeredBy": request.Cause})
+}
+
+// BuildCompletedActivity is run by every job build when it finishes, it triggers the jobs downstream of it
+func (a *Activities) BuildCompletedActivity(ctx context.Context, jobName string, number int, result wf.Result) error {
+	a.Dispatcher.BuildCompleted(jobName, number, result)
+	return nil
+}
+
+// BuildCompleted enqueues the builds of the jobs with an upstream trigger on the job of the completed build
+func (d *Dispatcher) BuildCompleted(jobName string, number int, result wf.Result) {
+	d.mutex.RLock()
+	downstream := d.downstream[jobName]
+	d.mutex.RUnlock()
+
+	for _, job := range downstream {
+		if !result.IsBetterOrEqualTo(job.threshold) {
+			continue
+		}
+		props := map[string]interface{}{
+			"triggeredBy":     jobs.UpstreamCause,
+			"upstreamProject": jobName,
+			"upstreamBuild":   strconv.Itoa(number),
+		}
+		if _, err := d.enqueue(job.jobName, props); err != nil {
+			log.Printf("Unable to trigger %s after %s #%d: %v", job.jobName, jobName, number, err)
+		}
+	}
+}
+
+// enqueue schedules a build of the job with the default values of its parameters
+func (d *Dispatcher) enqueue(jobName string, props map[string]interface{}) (int64, error) {
+	pipeline, params, err := d.resolve(jobName, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	item := d.queue.Schedule(queue.JobItem(d.wfClient, jobName, pipeline, params, props))
+	if item.Error != "" {
+		return item.Id, fmt.Errorf("unable to start build of %s: %s", jobName, item.Error)
+	}
+	return item.Id, nil
+}
+
+// resolve parses the pipeline of the job and resolves the parameter values, the default values of the parameters
+// fill in the ones which aren't given
+func (d *Dispatcher) resolve(jobName string, values map[string]any) (*wf.Pipeline, map[string]any, error) {
+	job := jobs.GetInstance().FindJobs(jobName)
+	if job == nil || job.IsDir {
+		return nil, nil, temporal.NewNonRetryableApplicationError(fmt.Sprintf("job %s not found", jobName), triggerErrType, nil)
+	}
+
+	var parser wf.DslParser
+	pipeline, err := parser.ParseFile(jobName, job.Script)
+	if err != nil {
+		return nil, nil, temporal.NewNonRetryableApplicationError(fmt.Sprintf("invalid pipeline of %s", jobName), triggerErrType, err)
+	}
+	params, err := pipeline.Parameters.Resolve(values)
+	if err != nil {
+		return nil, nil, temporal.NewNonRetryableApplicationError(fmt.Sprintf("invalid parameters for %s", jobName), triggerErrType, err)
+	}
+	return pipeline, params, nil
+}
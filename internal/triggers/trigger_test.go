@@ -0,0 +1,61 @@
+package triggers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/testsuite"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+)
+
+func TestTriggerWorkflow(t *testing.T) {
+	checkouts := []map[string]interface{}{{"url": "git@github.com:org/repo.git", "branch": "main"}}
+
+	for _, tt := range []struct {
+		name     string
+		request  Request
+		changed  bool
+		enqueued bool
+	}{
+		{"cron", Request{JobName: "/jobs/nightly", Cause: jobs.TimerCause}, false, true},
+		{"head moved", Request{JobName: "/jobs/ci", Cause: jobs.SCMCause, Checkouts: checkouts}, true, true},
+		{"no changes", Request{JobName: "/jobs/ci", Cause: jobs.SCMCause, Checkouts: checkouts}, false, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var testSuite testsuite.WorkflowTestSuite
+			env := testSuite.NewTestWorkflowEnvironment()
+			env.RegisterActivity(PollSCMActivity)
+			env.RegisterActivity(&Activities{})
+
+			polls := 0
+			env.OnActivity("PollSCMActivity", mock.Anything, tt.request.JobName, mock.Anything).Return(
+				func(ctx context.Context, jobName string, checkouts []map[string]interface{}) (bool, error) {
+					polls++
+					return tt.changed, nil
+				})
+			var enqueued []Request
+			env.OnActivity("EnqueueBuildActivity", mock.Anything, mock.Anything).Return(
+				func(ctx context.Context, request Request) (int64, error) {
+					enqueued = append(enqueued, request)
+					return 1, nil
+				})
+
+			env.ExecuteWorkflow(TriggerWorkflow, tt.request)
+			if err := env.GetWorkflowError(); err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+
+			if tt.request.Cause == jobs.SCMCause && polls != 1 {
+				t.Errorf("Expected the SCM to be polled once, got %d polls", polls)
+			}
+			if tt.request.Cause == jobs.TimerCause && polls != 0 {
+				t.Errorf("Expected cron triggers not to poll, got %d polls", polls)
+			}
+			if (len(enqueued) == 1) != tt.enqueued {
+				t.Errorf("Expected enqueued to be %v, got %v", tt.enqueued, enqueued)
+			}
+		})
+	}
+}
@@ -4,20 +4,70 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/yegor86/tumbler-doll/internal/cryptography"
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
 	"github.com/yegor86/tumbler-doll/plugins"
 	"github.com/yegor86/tumbler-doll/plugins/docker"
 	"go.temporal.io/sdk/activity"
 	"go.temporal.io/sdk/temporal"
 )
 
+// heartbeatInterval is how often StageActivity reports that it's alive
+const heartbeatInterval = 5 * time.Second
+
+// busyExecutors counts the stages running on the worker
+var busyExecutors atomic.Int32
+
 type StageActivities struct {
+	// NodeTaskQueue is the task queue only the node of the worker polls
+	NodeTaskQueue string
+}
+
+// StageContext holds what the steps of a stage are interpolated against
+type StageContext struct {
+	Variables map[string]string
+	Params    map[string]any
+	// Credentials maps environment variable names onto credentials ids
+	Credentials map[string]string
+	// Passwords maps the names of the password parameters onto their values encrypted with the secret key
+	Passwords map[string]string
+	// JobName and BuildNumber are the job build the stage belongs to, JobName is empty for uploaded scripts
+	JobName     string
+	BuildNumber int
 }
 
-func (a *StageActivities) StageActivity(ctx context.Context, steps []*Step, agent Agent) ([]string, error) {
+func (a *StageActivities) StageActivity(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
 	var results []string
 
+	busyExecutors.Add(1)
+	defer busyExecutors.Add(-1)
+
+	variables, err := bindCredentials(stageContext.Variables, stageContext.Credentials)
+	if err != nil {
+		return results, temporal.NewNonRetryableApplicationError(err.Error(), "credentials", nil)
+	}
+	params, err := bindPasswords(variables, stageContext.Params, stageContext.Passwords)
+	if err != nil {
+		return results, temporal.NewNonRetryableApplicationError(err.Error(), "credentials", nil)
+	}
+	workspace, err := buildWorkspace(stageContext.JobName, stageContext.BuildNumber)
+	if err != nil {
+		return results, temporal.NewNonRetryableApplicationError(err.Error(), "workspace", nil)
+	}
+	variables["WORKSPACE"] = workspace
+	sc := &scope{env: variables, params: params}
+
+	stopHeartbeat := heartbeat(ctx)
+	defer stopHeartbeat()
+
 	// Get workflow information
 	info := activity.GetInfo(ctx)
 	ctx = context.WithValue(ctx, "workflowExecutionId", info.WorkflowExecution.ID)
@@ -25,27 +75,42 @@ func (a *StageActivities) StageActivity(ctx context.Context, steps []*Step, agen
 	pluginManager := plugins.GetInstance()
 	
 	dockerPlugin, found := pluginManager.FindPlugin("docker").(*docker.DockerPlugin)
-	if agent.Docker != nil && agent.Docker.Image != "" && found {
-		ctx = context.WithValue(ctx, "imageName", string(agent.Docker.Image))
-		err := dockerPlugin.Pull(ctx)
-		if err != nil {
-			log.Printf("Docker pull image failed: %v\n", err)
-			return results, err
-		}
-		containerId, err := dockerPlugin.RunContainer(ctx)
+	if (agent.Docker != nil && agent.Docker.Image != "" || agent.Dockerfile != nil) && found {
+		containerId, reused, err := agentContainer(ctx, dockerPlugin, agent, sc)
 		if err != nil {
-			log.Printf("Docker run container failed: %v\n", err)
 			return results, err
 		}
 		ctx = context.WithValue(ctx, "containerId", containerId)
 		
-		defer dockerPlugin.StopContainer(ctx, containerId)
+		// the container has to be stopped even if the step was cancelled, unless the next stages reuse it
+		if !reused {
+			defer dockerPlugin.StopContainer(context.WithoutCancel(ctx), containerId)
+		}
 	}
 
+	env := toEnvList(variables)
+	unstable := false
 	for _, step := range steps {
-		command, params := step.ToCommand()
+		command, params, err := step.resolve(sc)
+		if err != nil {
+			return results, temporal.NewNonRetryableApplicationError(err.Error(), commandErrType, nil)
+		}
+		if step.runsInWorkflow() {
+			// script blocks, input, build, stash and unstash steps are handled by the workflow, see executeSteps
+			return results, temporal.NewNonRetryableApplicationError(fmt.Sprintf("step '%s' can't run in StageActivity", step.Name()), commandErrType, nil)
+		}
+		if command == "error" {
+			return results, temporal.NewNonRetryableApplicationError(stepMessage(params), commandErrType, nil)
+		} else if command == "unstable" {
+			// unstable marks the stage as unstable without stopping it
+			results = append(results, stepMessage(params))
+			unstable = true
+			continue
+		}
 		params["workflowExecutionId"] = info.WorkflowExecution.ID
 		params["containerId"] = ctx.Value("containerId")
+		params["env"] = env
+		params["workspace"] = workspace
 
 		pluginName, methodFunc, ok := pluginManager.GetPluginInfo(command)
 		if !ok {
@@ -54,21 +119,25 @@ func (a *StageActivities) StageActivity(ctx context.Context, steps []*Step, agen
 				"plugin",
 				fmt.Errorf("plugin is not registered for the command %s", command),
 			)
-			return nil, err
+			return results, err
 		}
 
 		capitalizedCommand := strings.ToUpper(methodFunc[:1]) + strings.ToLower(methodFunc[1:])
 		output, err := pluginManager.Execute(
+			ctx,
 			pluginName,
 			capitalizedCommand,
 			params)
 
-		if err != nil {
+		if ctx.Err() != nil {
+			// the build was aborted
+			return results, ctx.Err()
+		} else if err != nil {
 			log.Printf("Command execution failed: %s", err)
 			results = append(results, err.Error())
-			return results, temporal.NewNonRetryableApplicationError(
+			return results, temporal.NewApplicationErrorWithCause(
 				"command execution failed",
-				"plugin",
+				commandErrType,
 				err,
 			)
 		} else if invokeResult, ok := output.(string); ok {
@@ -78,5 +147,149 @@ func (a *StageActivities) StageActivity(ctx context.Context, steps []*Step, agen
 		}
 	}
 
+	if unstable {
+		return results, temporal.NewNonRetryableApplicationError("stage is unstable", unstableErrType, nil, results)
+	}
 	return results, nil
 }
+
+// NodeTaskQueueActivity returns the task queue only the node running it polls, see reuseNode.
+// A worker which isn't a node, e.g. in tests, has the task queue the activity ran on.
+func (a *StageActivities) NodeTaskQueueActivity(ctx context.Context) (string, error) {
+	if a.NodeTaskQueue == "" {
+		return activity.GetInfo(ctx).TaskQueue, nil
+	}
+	return a.NodeTaskQueue, nil
+}
+
+// RemoveContainersActivity removes the containers kept for the stages of the build with reuseNode
+func (a *StageActivities) RemoveContainersActivity(ctx context.Context, workflowId string) error {
+	dockerPlugin, found := plugins.GetInstance().FindPlugin("docker").(*docker.DockerPlugin)
+	if !found {
+		return nil
+	}
+	return dockerPlugin.RemoveContainers(ctx, map[string]string{buildLabel: workflowId})
+}
+
+// RecordBuildActivity writes the build.xml of a finished build and updates the permalinks of the job
+func (a *StageActivities) RecordBuildActivity(ctx context.Context, jobName string, record jobs.BuildRecord) error {
+	if err := jobs.WriteBuildRecord(jobName, record); err != nil {
+		return err
+	}
+	return jobs.UpdatePermalinks(jobName, record.Number, record.Result)
+}
+
+// BusyExecutors returns how many stages the worker is running, an executor of the node is busy with each of them
+func BusyExecutors() int {
+	return int(busyExecutors.Load())
+}
+
+// heartbeat records heartbeats until the returned function is called
+func heartbeat(ctx context.Context) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				activity.RecordHeartbeat(ctx)
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// bindCredentials returns a copy of variables with the credentials bound to their environment variables.
+// Secret text is bound as is, username with password is bound as NAME=user:password, NAME_USR and NAME_PSW.
+func bindCredentials(variables map[string]string, bindings map[string]string) (map[string]string, error) {
+	bound := make(map[string]string, len(variables)+len(bindings))
+	for name, value := range variables {
+		bound[name] = value
+	}
+	for name, credentialsId := range bindings {
+		credentials := cryptography.GetInstance().GetCredentialsById(credentialsId)
+		if credentials == nil {
+			return nil, fmt.Errorf("credentials '%s' not found", credentialsId)
+		}
+		if secret, ok := credentials.Tags["secret"]; ok {
+			bound[name] = secret
+			continue
+		}
+		username, hasUsername := credentials.Tags["username"]
+		password, hasPassword := credentials.Tags["password"]
+		if !hasUsername || !hasPassword {
+			return nil, fmt.Errorf("credentials '%s' can't be bound to an environment variable", credentialsId)
+		}
+		bound[name] = username + ":" + password
+		bound[name+"_USR"] = username
+		bound[name+"_PSW"] = password
+	}
+	return bound, nil
+}
+
+// bindPasswords binds the values of the password parameters to their environment variables and returns
+// a copy of params with the values, see readPasswords
+func bindPasswords(variables map[string]string, params map[string]any, passwords map[string]string) (map[string]any, error) {
+	bound := make(map[string]any, len(params))
+	for name, value := range params {
+		bound[name] = value
+	}
+	for name, encrypted := range passwords {
+		value, err := cryptography.GetInstance().DecryptSecret(encrypted)
+		if err != nil {
+			return nil, fmt.Errorf("value of parameter %s can't be decrypted: %w", name, err)
+		}
+		variables[name] = value
+		bound[name] = value
+	}
+	return bound, nil
+}
+
+// buildWorkspace creates the workspace of the build, $WORKSPACE/<job>/<build>, the steps run there.
+// The path comes from the job and the build number the build was started with, not from JOB_NAME and
+// BUILD_NUMBER which the environment directive can override. Stages run outside of a job build,
+// e.g. in tests, share $WORKSPACE.
+func buildWorkspace(jobName string, buildNumber int) (string, error) {
+	workspace := os.Getenv("WORKSPACE")
+	if jobName == "" || buildNumber <= 0 {
+		return workspace, nil
+	}
+	if !filepath.IsAbs(workspace) {
+		return "", fmt.Errorf("WORKSPACE must be an absolute path, got %q", workspace)
+	}
+	name := jobs.ShortName(jobName)
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid job name %q", jobName)
+		}
+	}
+	workspace = filepath.Join(workspace, filepath.FromSlash(name), strconv.Itoa(buildNumber))
+	if err := os.MkdirAll(workspace, 0755); err != nil {
+		return "", fmt.Errorf("failed to create workspace %s: %w", workspace, err)
+	}
+	return workspace, nil
+}
+
+// stepMessage returns the message of an error or unstable step, given as error 'x' or error(message: 'x')
+func stepMessage(params map[string]interface{}) string {
+	if message, ok := params["text"].(string); ok {
+		return message
+	}
+	message, _ := params["message"].(string)
+	return message
+}
+
+// toEnvList converts variables into a sorted list of KEY=VALUE pairs
+func toEnvList(variables map[string]string) []string {
+	env := make([]string, 0, len(variables))
+	for name, value := range variables {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
@@ -0,0 +1,240 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/yegor86/tumbler-doll/internal/cryptography"
+	"github.com/yegor86/tumbler-doll/plugins/docker"
+	"github.com/yegor86/tumbler-doll/plugins/docker/shared"
+)
+
+// Labels of the containers kept across the stages of a build with reuseNode
+const (
+	buildLabel = "tumbler-doll.build"
+	agentLabel = "tumbler-doll.agent"
+)
+
+// agentContainer starts the container of the docker or dockerfile agent, or finds the one a previous stage
+// of the build kept with reuseNode. It reports whether the container is kept for the next stages.
+func agentContainer(ctx context.Context, dockerPlugin *docker.DockerPlugin, agent Agent, sc *scope) (string, bool, error) {
+	if agent.Dockerfile != nil {
+		imageName, err := buildAgentImage(ctx, dockerPlugin, agent.Dockerfile, sc)
+		if err != nil {
+			return "", false, err
+		}
+		var options shared.RunOptions
+		mountWorkspace(&options, sc)
+		containerId, err := dockerPlugin.RunContainer(context.WithValue(ctx, "imageName", imageName), options)
+		if err != nil {
+			log.Printf("Docker run container failed: %v\n", err)
+		}
+		return containerId, false, err
+	}
+
+	imageName, options, err := agent.Docker.resolve(sc)
+	if err != nil {
+		return "", false, temporal.NewNonRetryableApplicationError(err.Error(), commandErrType, nil)
+	}
+	// the container runs in the engine of the agent, the docker plugin falls back on the one of the node
+	engine, err := interpolate(string(agent.Docker.Engine), sc)
+	if err != nil {
+		return "", false, temporal.NewNonRetryableApplicationError(err.Error(), commandErrType, nil)
+	}
+	ctx = context.WithValue(ctx, "containerEngine", engine)
+	mountWorkspace(&options, sc)
+	reuse := bool(agent.Docker.ReuseNode)
+	if reuse {
+		options.Labels = map[string]string{
+			buildLabel: activity.GetInfo(ctx).WorkflowExecution.ID,
+			agentLabel: imageName + " " + agent.Docker.Args.Literal(),
+		}
+		containerId, err := dockerPlugin.FindContainer(ctx, options.Labels)
+		if err != nil || containerId != "" {
+			return containerId, true, err
+		}
+	}
+
+	if err := pullAgentImage(ctx, dockerPlugin, agent.Docker, imageName, sc); err != nil {
+		return "", false, err
+	}
+	containerId, err := dockerPlugin.RunContainer(context.WithValue(ctx, "imageName", imageName), options)
+	if err != nil {
+		log.Printf("Docker run container failed: %v\n", err)
+	}
+	return containerId, reuse, err
+}
+
+// mountWorkspace bind-mounts the workspace of the build into the agent container at the same path,
+// the container starts there unless the args of the agent give another working directory
+func mountWorkspace(options *shared.RunOptions, sc *scope) {
+	workspace := sc.env["WORKSPACE"]
+	if workspace == "" {
+		return
+	}
+	options.Binds = append(options.Binds, workspace+":"+workspace)
+	if options.Workdir == "" {
+		options.Workdir = workspace
+	}
+}
+
+// resolve returns the name of the image in its registry and the settings of the container given by the args
+func (d *Docker) resolve(sc *scope) (string, shared.RunOptions, error) {
+	var options shared.RunOptions
+	imageName, err := interpolate(string(d.Image), sc)
+	if err != nil {
+		return "", options, err
+	}
+	registryUrl, err := interpolate(string(d.RegistryUrl), sc)
+	if err != nil {
+		return "", options, err
+	}
+	args, err := interpolate(string(d.Args), sc)
+	if err != nil {
+		return "", options, err
+	}
+	if err := options.ParseArgs(args); err != nil {
+		return "", options, err
+	}
+	return shared.RegistryImage(registryUrl, imageName), options, nil
+}
+
+// pullAgentImage pulls the image when there's no such image yet or when it's always pulled,
+// with the credentials of the registry if there are some
+func pullAgentImage(ctx context.Context, dockerPlugin *docker.DockerPlugin, d *Docker, imageName string, sc *scope) error {
+	if !d.AlwaysPull {
+		if exists, err := dockerPlugin.ImageExists(ctx, imageName); err == nil && exists {
+			return nil
+		}
+	}
+
+	auth, err := d.registryAuth(sc)
+	if err != nil {
+		return temporal.NewNonRetryableApplicationError(err.Error(), "credentials", nil)
+	}
+	if err := dockerPlugin.Pull(context.WithValue(ctx, "imageName", imageName), auth); err != nil {
+		log.Printf("Docker pull image failed: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// registryAuth returns the account of registryCredentialsId, images are pulled anonymously without one
+func (d *Docker) registryAuth(sc *scope) (*shared.RegistryAuth, error) {
+	credentialsId, err := interpolate(string(d.RegistryCredentialsId), sc)
+	if err != nil || credentialsId == "" {
+		return nil, err
+	}
+	registryUrl, err := interpolate(string(d.RegistryUrl), sc)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := cryptography.GetInstance().GetCredentialsById(credentialsId)
+	if credentials == nil {
+		return nil, fmt.Errorf("credentials '%s' not found", credentialsId)
+	}
+	username, hasUsername := credentials.Tags["username"]
+	password, hasPassword := credentials.Tags["password"]
+	if !hasUsername || !hasPassword {
+		return nil, fmt.Errorf("credentials '%s' aren't a username with password", credentialsId)
+	}
+	return &shared.RegistryAuth{ServerAddress: shared.RegistryHost(registryUrl), Username: username, Password: password}, nil
+}
+
+// buildAgentImage builds the image of the dockerfile agent and returns its name
+func buildAgentImage(ctx context.Context, dockerPlugin *docker.DockerPlugin, dockerfile *Dockerfile, sc *scope) (string, error) {
+	options, args, err := dockerfile.buildOptions(sc)
+	if err != nil {
+		return "", temporal.NewNonRetryableApplicationError(err.Error(), commandErrType, nil)
+	}
+	imageName, err := dockerPlugin.BuildImage(ctx, options, args)
+	if err != nil {
+		log.Printf("Docker build failed: %v\n", err)
+		return "", temporal.NewApplicationErrorWithCause("docker build failed", commandErrType, err)
+	}
+	return imageName, nil
+}
+
+// buildOptions returns what the Dockerfile is built with and its additional build arguments.
+// The dir is relative to the workspace of the build and the filename to the dir, they default to . and Dockerfile.
+func (dockerfile *Dockerfile) buildOptions(sc *scope) (shared.BuildOptions, string, error) {
+	var values [3]string
+	for i, value := range []QuotedString{dockerfile.Dir, dockerfile.Filename, dockerfile.AdditionalBuildArgs} {
+		interpolated, err := interpolate(string(value), sc)
+		if err != nil {
+			return shared.BuildOptions{}, "", err
+		}
+		values[i] = interpolated
+	}
+	dir, filename, args := values[0], values[1], values[2]
+	if dir == "" {
+		dir = "."
+	}
+	if filename == "" {
+		filename = "Dockerfile"
+	}
+	if !filepath.IsAbs(dir) {
+		workspace, ok := sc.env["WORKSPACE"]
+		if !ok {
+			workspace = os.Getenv("WORKSPACE")
+		}
+		dir = filepath.Join(workspace, dir)
+	}
+	return shared.BuildOptions{ContextDir: dir, Dockerfile: filename}, args, nil
+}
+
+// reuseNode pins the stages which keep their container for the next stages to a node: the first of them
+// on a task queue asks the node it runs on for the task queue only that node polls, the stages on the queue
+// run there from then on. The containers are removed there once the build is over.
+func reuseNode(ctx workflow.Context, agent *Agent) (workflow.Context, error) {
+	if agent == nil || agent.Docker == nil || !agent.Docker.ReuseNode {
+		return ctx, nil
+	}
+	nodeTaskQueues, ok := ctx.Value("reusedContainers").(map[string]string)
+	if !ok {
+		return ctx, nil
+	}
+	taskQueue := workflow.GetActivityOptions(ctx).TaskQueue
+	if _, ok := nodeTaskQueues[taskQueue]; !ok {
+		var nodeTaskQueue string
+		if err := workflow.ExecuteActivity(ctx, "NodeTaskQueueActivity").Get(ctx, &nodeTaskQueue); err != nil {
+			return ctx, err
+		}
+		// a parallel branch may have pinned the queue meanwhile
+		if _, ok := nodeTaskQueues[taskQueue]; !ok {
+			nodeTaskQueues[taskQueue] = nodeTaskQueue
+		}
+	}
+	return workflow.WithTaskQueue(ctx, nodeTaskQueues[taskQueue]), nil
+}
+
+// removeReusedContainers removes the containers kept by the stages with reuseNode, a failure only leaves them behind
+func removeReusedContainers(ctx workflow.Context) {
+	nodeTaskQueues, _ := ctx.Value("reusedContainers").(map[string]string)
+	queues := make([]string, 0, len(nodeTaskQueues))
+	for _, nodeTaskQueue := range nodeTaskQueues {
+		if !slices.Contains(queues, nodeTaskQueue) {
+			queues = append(queues, nodeTaskQueue)
+		}
+	}
+	// the order of the activities must not change when the workflow is replayed
+	sort.Strings(queues)
+
+	workflowId := workflow.GetInfo(ctx).WorkflowExecution.ID
+	for _, taskQueue := range queues {
+		err := workflow.ExecuteActivity(workflow.WithTaskQueue(ctx, taskQueue), "RemoveContainersActivity", workflowId).Get(ctx, nil)
+		if err != nil {
+			workflow.GetLogger(ctx).Error("Failed to remove containers", "taskQueue", taskQueue, "error", err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package workflow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/testsuite"
+
+	"github.com/yegor86/tumbler-doll/plugins/docker/shared"
+)
+
+func TestReuseNode(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('Build') {
+				agent {
+					docker {
+						image 'maven:3.9'
+						label 'linux'
+						reuseNode true
+					}
+				}
+				steps {
+					sh 'mvn package'
+				}
+			}
+			stage('Test') {
+				agent {
+					docker { image 'maven:3.9'; reuseNode true }
+				}
+				steps {
+					sh 'mvn verify'
+				}
+			}
+			stage('Package') {
+				agent {
+					docker { image 'maven:3.9'; label 'linux'; reuseNode true }
+				}
+				steps {
+					sh 'mvn install'
+				}
+			}
+			stage('Docs') {
+				agent { docker 'sphinx' }
+				steps {
+					sh 'make docs'
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+	registerAPIActivities(env)
+	env.SetStartWorkflowOptions(client.StartWorkflowOptions{TaskQueue: DefaultTaskQueue})
+
+	var mutex sync.Mutex
+	var stages []string
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			_, params := steps[0].ToCommand()
+			stages = append(stages, activity.GetInfo(ctx).TaskQueue+" "+params["text"].(string))
+			return []string{}, nil
+		})
+	// several nodes poll the queues, the first stage reusing a container on a queue pins it to its node
+	nodeTaskQueues := map[string]string{"JobQueue": "JobQueue@builder-1", "JobQueue@linux": "JobQueue@builder-2"}
+	env.OnActivity("NodeTaskQueueActivity", mock.Anything).Return(
+		func(ctx context.Context) (string, error) {
+			return nodeTaskQueues[activity.GetInfo(ctx).TaskQueue], nil
+		}).Twice()
+
+	var removed []string
+	env.OnActivity("RemoveContainersActivity", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, workflowId string) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			removed = append(removed, activity.GetInfo(ctx).TaskQueue+" "+workflowId)
+			return nil
+		})
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	env.AssertExpectations(t)
+
+	wantStages := []string{
+		"JobQueue@builder-2 mvn package",
+		"JobQueue@builder-1 mvn verify",
+		"JobQueue@builder-2 mvn install",
+		"JobQueue make docs",
+	}
+	if diff := cmp.Diff(stages, wantStages); diff != "" {
+		t.Errorf("Stages ran on unexpected task queues (-got +want):\n%s", diff)
+	}
+
+	// the containers are removed on the nodes which kept them
+	sort.Strings(removed)
+	want := []string{"JobQueue@builder-1 default-test-workflow-id", "JobQueue@builder-2 default-test-workflow-id"}
+	if diff := cmp.Diff(removed, want); diff != "" {
+		t.Errorf("Containers removed are not equal (-got +want):\n%s", diff)
+	}
+}
+
+func TestBuildWorkspace(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("WORKSPACE", root)
+
+	workspace, err := buildWorkspace("/jobs/folder/jobs/my-job", 7)
+	if err != nil {
+		t.Fatalf("Failed to create workspace: %v", err)
+	}
+	if want := filepath.Join(root, "folder", "my-job", "7"); workspace != want {
+		t.Errorf("Workspace is %s, want %s", workspace, want)
+	}
+	if info, err := os.Stat(workspace); err != nil || !info.IsDir() {
+		t.Errorf("Workspace %s wasn't created: %v", workspace, err)
+	}
+
+	var options shared.RunOptions
+	mountWorkspace(&options, &scope{env: map[string]string{"WORKSPACE": workspace}})
+	want := shared.RunOptions{Binds: []string{workspace + ":" + workspace}, Workdir: workspace}
+	if diff := cmp.Diff(options, want); diff != "" {
+		t.Errorf("Run options are not equal (-got +want):\n%s", diff)
+	}
+
+	// a working directory given by the args of the agent is kept
+	options = shared.RunOptions{Workdir: "/src"}
+	mountWorkspace(&options, &scope{env: map[string]string{"WORKSPACE": workspace}})
+	if options.Workdir != "/src" {
+		t.Errorf("Working directory is %s, want /src", options.Workdir)
+	}
+
+	if workspace, err := buildWorkspace("", 0); err != nil || workspace != root {
+		t.Errorf("Workspace outside of a job build is %s (%v), want %s", workspace, err, root)
+	}
+
+	// JOB_NAME can be overridden by the pipeline, the job name can't, but a workspace never escapes $WORKSPACE
+	if _, err := buildWorkspace("/jobs/../../etc", 7); err == nil {
+		t.Errorf("Expected a job name with .. to be rejected")
+	}
+	t.Setenv("WORKSPACE", "workspace")
+	if _, err := buildWorkspace("/jobs/folder/jobs/my-job", 7); err == nil {
+		t.Errorf("Expected a relative WORKSPACE to be rejected")
+	}
+}
@@ -0,0 +1,120 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/testsuite"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+)
+
+func TestBuildNumber(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		environment {
+			VERSION = "1.0.${BUILD_NUMBER}"
+		}
+		parameters {
+			string(name: 'TARGET', defaultValue: 'staging')
+			password(name: 'TOKEN', defaultValue: '')
+		}
+		stages {
+			stage('Build') {
+				steps {
+					echo "Build ${JOB_NAME} #${BUILD_ID} of ${VERSION}"
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+	registerAPIActivities(env)
+
+	// the controller has the secret of the password, the stage gets its encrypted value
+	env.OnActivity("ReadSecretsActivity", mock.Anything, map[string]string{"TOKEN": "secret"}).Return(
+		map[string]string{"TOKEN": "encrypted"}, nil).Once()
+	var calls []string
+	var passwords map[string]string
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			passwords = stageContext.Passwords
+			_, params, err := steps[0].resolve(&scope{env: stageContext.Variables})
+			if err != nil {
+				return nil, err
+			}
+			calls = append(calls, params["text"].(string))
+			return []string{params["text"].(string)}, nil
+		})
+	var record jobs.BuildRecord
+	env.OnActivity("RecordBuildActivity", mock.Anything, "/jobs/folder/jobs/my-job", mock.Anything).Return(
+		func(ctx context.Context, jobName string, r jobs.BuildRecord) error {
+			record = r
+			return nil
+		}).Once()
+	var completed string
+	env.OnActivity("BuildCompletedActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, jobName string, number int, result Result) error {
+			completed = fmt.Sprintf("%s %s #%d %s", activity.GetInfo(ctx).TaskQueue, jobName, number, result)
+			return nil
+		}).Once()
+	var deleted string
+	env.OnActivity("DeleteSecretsActivity", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, ids []string) error {
+			deleted = fmt.Sprintf("%s %v", activity.GetInfo(ctx).TaskQueue, ids)
+			return nil
+		}).Once()
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{
+		"jobName":     "/jobs/folder/jobs/my-job",
+		"buildNumber": "7",
+		"params":      map[string]any{"TARGET": "production", "TOKEN": "secret"},
+	})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	if diff := cmp.Diff(calls, []string{"Build folder/my-job #7 of 1.0.7"}); diff != "" {
+		t.Errorf("Unexpected steps (-got +want):\n%s", diff)
+	}
+	if diff := cmp.Diff(passwords, map[string]string{"TOKEN": "encrypted"}); diff != "" {
+		t.Errorf("Unexpected passwords of the stage (-got +want):\n%s", diff)
+	}
+
+	want := jobs.BuildRecord{
+		Number:    7,
+		Result:    "SUCCESS",
+		Timestamp: record.Timestamp,
+		Causes:    []jobs.Cause{{Type: jobs.UserCause}},
+		Parameters: []jobs.ParameterValue{
+			{Name: "TARGET", Type: "string", Value: "production"},
+			{Name: "TOKEN", Type: "password"},
+		},
+		Stages: []jobs.StageRecord{{Name: "Build", Status: "success", Output: []string{"Build folder/my-job #7 of 1.0.7"}}},
+	}
+	if diff := cmp.Diff(record, want); diff != "" {
+		t.Errorf("Unexpected build record (-got +want):\n%s", diff)
+	}
+	if completed != "TriggerQueue /jobs/folder/jobs/my-job #7 SUCCESS" {
+		t.Errorf("Expected the downstream jobs to be triggered, got %q", completed)
+	}
+	if deleted != "ControllerQueue [secret]" {
+		t.Errorf("Expected the password to be deleted, got %q", deleted)
+	}
+}
@@ -0,0 +1,92 @@
+package workflow
+
+import (
+	"context"
+
+	temporalClient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Signals accepted by a running build
+const (
+	AbortSignal  = "abort"
+	PauseSignal  = "pause"
+	ResumeSignal = "resume"
+)
+
+// abortedErrType is the application error type returned by aborted builds
+const abortedErrType = "aborted"
+
+// control tracks the signals received by a build
+type control struct {
+	paused  bool
+	aborted bool
+	state   *BuildState
+	// responses are the input responses not consumed yet, by input id
+	responses map[string][]InputResponse
+}
+
+// handleSignals listens to the control signals for the whole build. Abort cancels the context
+// the stages run in, which cancels in-flight activities; pause holds the next activities back.
+// Input responses are queued for the stage waiting for them.
+func handleSignals(ctx workflow.Context, state *BuildState, cancel workflow.CancelFunc) *control {
+	c := &control{state: state, responses: make(map[string][]InputResponse)}
+	abortCh := workflow.GetSignalChannel(ctx, AbortSignal)
+	pauseCh := workflow.GetSignalChannel(ctx, PauseSignal)
+	resumeCh := workflow.GetSignalChannel(ctx, ResumeSignal)
+	inputCh := workflow.GetSignalChannel(ctx, InputSignal)
+
+	workflow.Go(ctx, func(ctx workflow.Context) {
+		selector := workflow.NewSelector(ctx)
+		selector.AddReceive(abortCh, func(ch workflow.ReceiveChannel, more bool) {
+			ch.Receive(ctx, nil)
+			workflow.GetLogger(ctx).Info("Build aborted")
+			c.aborted = true
+			cancel()
+		})
+		selector.AddReceive(pauseCh, func(ch workflow.ReceiveChannel, more bool) {
+			ch.Receive(ctx, nil)
+			if !c.paused && !state.IsDone() {
+				c.paused = true
+				state.Status = StatusPaused
+			}
+		})
+		selector.AddReceive(resumeCh, func(ch workflow.ReceiveChannel, more bool) {
+			ch.Receive(ctx, nil)
+			if c.paused && !state.IsDone() {
+				c.paused = false
+				state.Status = StatusRunning
+			}
+		})
+		selector.AddReceive(inputCh, func(ch workflow.ReceiveChannel, more bool) {
+			var response InputResponse
+			ch.Receive(ctx, &response)
+			c.responses[response.Id] = append(c.responses[response.Id], response)
+		})
+		for {
+			selector.Select(ctx)
+		}
+	})
+	return c
+}
+
+// awaitResumed blocks while the build is paused, it fails if the build is aborted meanwhile
+func awaitResumed(ctx workflow.Context) error {
+	c, ok := ctx.Value("control").(*control)
+	if !ok {
+		return nil
+	}
+	return workflow.Await(ctx, func() bool {
+		return !c.paused
+	})
+}
+
+// SignalBuild sends a control signal, e.g. AbortSignal, to a running build
+func SignalBuild(wfClient temporalClient.Client, workflowId string, signal string) error {
+	return wfClient.SignalWorkflow(context.Background(), workflowId, "", signal, nil)
+}
+
+// RespondToInput sends the response to an input the build is waiting for
+func RespondToInput(wfClient temporalClient.Client, workflowId string, response InputResponse) error {
+	return wfClient.SignalWorkflow(context.Background(), workflowId, "", InputSignal, response)
+}
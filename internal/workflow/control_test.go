@@ -0,0 +1,160 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestAbortSignal(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('Build') {
+				steps {
+					sh 'make'
+				}
+			}
+			stage('Test') {
+				steps {
+					sh 'make check'
+				}
+			}
+		}
+		post {
+			aborted {
+				echo 'Build aborted'
+			}
+			failure {
+				echo 'Build failed'
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+
+	// a runaway build
+	isMake := func(steps []*Step) bool {
+		_, params := steps[0].ToCommand()
+		return params["text"] == "make"
+	}
+	env.OnActivity("StageActivity", mock.Anything, mock.MatchedBy(isMake), mock.Anything, mock.Anything).
+		Return([]string{"make"}, nil).After(time.Hour)
+
+	var calls []string
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			_, params := steps[0].ToCommand()
+			calls = append(calls, params["text"].(string))
+			return []string{params["text"].(string)}, nil
+		})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(AbortSignal, nil)
+	}, time.Minute)
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{})
+
+	var appErr *temporal.ApplicationError
+	if err := env.GetWorkflowError(); !errors.As(err, &appErr) || appErr.Type() != abortedErrType {
+		t.Fatalf("Expected the build to be aborted, got %v", err)
+	}
+	if diff := cmp.Diff(calls, []string{"Build aborted"}); diff != "" {
+		t.Errorf("Unexpected steps (-got +want):\n%s", diff)
+	}
+
+	encoded, err := env.QueryWorkflow("state")
+	if err != nil {
+		t.Fatalf("Failed to query state: %v", err)
+	}
+	var state BuildState
+	if err := encoded.Get(&state); err != nil {
+		t.Fatalf("Failed to decode state: %v", err)
+	}
+	if state.Status != StatusAborted || state.Stages[0].Status != StatusAborted || state.Stages[1].Status != StatusPending {
+		t.Errorf("Unexpected state %+v", state)
+	}
+}
+
+func TestPauseAndResumeSignals(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('Build') {
+				steps {
+					sh 'make'
+				}
+			}
+			stage('Deploy') {
+				steps {
+					sh 'make deploy'
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+
+	started := make(map[string]time.Time)
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			_, params := steps[0].ToCommand()
+			started[params["text"].(string)] = env.Now()
+			return []string{params["text"].(string)}, nil
+		}).After(time.Minute)
+
+	start := env.Now()
+	var paused BuildState
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(PauseSignal, nil)
+	}, time.Second)
+	env.RegisterDelayedCallback(func() {
+		encoded, err := env.QueryWorkflow("state")
+		if err != nil {
+			t.Fatalf("Failed to query state: %v", err)
+		}
+		encoded.Get(&paused)
+		env.SignalWorkflow(ResumeSignal, nil)
+	}, time.Hour)
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if paused.Status != StatusPaused {
+		t.Errorf("Expected the build to be paused, got %s", paused.Status)
+	}
+	// the running step completes, the next one waits for resume
+	if started["make deploy"].Sub(start) < time.Hour {
+		t.Errorf("Deploy started before resume at %v", started["make deploy"].Sub(start))
+	}
+}
@@ -0,0 +1,82 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/yegor86/tumbler-doll/internal/cryptography"
+)
+
+type (
+	// ControllerActivities run on ControllerTaskQueue, the API keeps the secrets of the builds it starts
+	ControllerActivities struct{}
+)
+
+// ReadSecretsActivity reads the secrets of the password parameters of a build, they stay encrypted.
+// ids maps the names of the parameters onto the ids of their secrets, see Parameters.StorePasswords.
+func (a *ControllerActivities) ReadSecretsActivity(ctx context.Context, ids map[string]string) (map[string]string, error) {
+	encrypted := make(map[string]string, len(ids))
+	for name, id := range ids {
+		value, err := cryptography.GetInstance().ReadSecret(id)
+		if err != nil {
+			return nil, temporal.NewNonRetryableApplicationError(fmt.Sprintf("value of parameter %s not found", name), "credentials", err)
+		}
+		encrypted[name] = value
+	}
+	return encrypted, nil
+}
+
+// DeleteSecretsActivity deletes the secrets of the password parameters of a completed build
+func (a *ControllerActivities) DeleteSecretsActivity(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		if err := cryptography.GetInstance().DeleteSecret(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPasswords reads the encrypted values of the password parameters from the controller. The stages
+// run on nodes which don't have its JENKINS_HOME, they get the values with the activity input and decrypt them.
+func readPasswords(ctx workflow.Context) (map[string]string, error) {
+	passwords, _ := ctx.Value("passwords").(map[string]string)
+	if len(passwords) == 0 {
+		return nil, nil
+	}
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		TaskQueue:           ControllerTaskQueue,
+		StartToCloseTimeout: time.Minute,
+	})
+	var encrypted map[string]string
+	err := workflow.ExecuteActivity(ctx, "ReadSecretsActivity", passwords).Get(ctx, &encrypted)
+	return encrypted, err
+}
+
+// deletePasswords deletes the secrets of the password parameters once the build doesn't need them anymore,
+// see Parameters.StorePasswords
+func deletePasswords(ctx workflow.Context) {
+	passwords, _ := ctx.Value("passwords").(map[string]string)
+	if len(passwords) == 0 {
+		return
+	}
+	ids := make([]string, 0, len(passwords))
+	for _, id := range passwords {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		TaskQueue:           ControllerTaskQueue,
+		StartToCloseTimeout: time.Minute,
+		// keeps retrying while the API is down, but doesn't hold the build forever
+		ScheduleToCloseTimeout: 10 * time.Minute,
+	})
+	if err := workflow.ExecuteActivity(ctx, "DeleteSecretsActivity", ids).Get(ctx, nil); err != nil {
+		workflow.GetLogger(ctx).Warn("Failed to delete the passwords of the build", "error", err)
+	}
+}
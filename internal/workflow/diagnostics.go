@@ -0,0 +1,89 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// Diagnostic describes a problem found in a Jenkinsfile, positioned at the offending token
+type Diagnostic struct {
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Token    string `json:"token,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Diagnostics is the error returned when a Jenkinsfile is invalid, it may carry several problems
+type Diagnostics []Diagnostic
+
+var expectedPattern = regexp.MustCompile(`\(expected (.+)\)$`)
+
+func (d Diagnostic) Error() string {
+	position := d.File
+	if d.Line != 0 {
+		position += fmt.Sprintf(":%d:%d", d.Line, d.Column)
+	}
+	if position == "" {
+		return d.Message
+	}
+	return strings.TrimPrefix(position, ":") + ": " + d.Message
+}
+
+func (d Diagnostics) Error() string {
+	messages := make([]string, len(d))
+	for i, diagnostic := range d {
+		messages[i] = diagnostic.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// toDiagnostics converts a participle error on the source into diagnostics with the position of the error
+func toDiagnostics(fileName string, source string, err error) Diagnostics {
+	var diagnostics Diagnostics
+	if errors.As(err, &diagnostics) {
+		return diagnostics
+	}
+
+	diagnostic := Diagnostic{File: fileName, Message: err.Error()}
+	var parseErr participle.Error
+	if errors.As(err, &parseErr) {
+		pos := parseErr.Position()
+		diagnostic.Line = pos.Line
+		diagnostic.Column = pos.Column
+		diagnostic.Message = parseErr.Message()
+	}
+
+	var lexerErr *lexer.Error
+	if errors.As(err, &lexerErr) && lexerErr.Pos.Offset < len(source) {
+		// the lexer reports the rest of the file, only the rest of the line is worth showing
+		text := source[lexerErr.Pos.Offset:]
+		if end := strings.IndexByte(text, '\n'); end >= 0 {
+			text = text[:end]
+		}
+		diagnostic.Token = text
+		diagnostic.Message = "invalid input text"
+		if strings.HasPrefix(text, "'") || strings.HasPrefix(text, `"`) {
+			diagnostic.Message = "unterminated string"
+		}
+	}
+
+	var tokenErr *participle.UnexpectedTokenError
+	if errors.As(err, &tokenErr) {
+		diagnostic.Token = tokenErr.Unexpected.Value
+		if tokenErr.Unexpected.Type == lexer.EOF {
+			diagnostic.Token = "<EOF>"
+		}
+		diagnostic.Expected = tokenErr.Expect
+		if match := expectedPattern.FindStringSubmatch(tokenErr.Message()); match != nil {
+			diagnostic.Expected = match[1]
+		}
+	}
+	return Diagnostics{diagnostic}
+}
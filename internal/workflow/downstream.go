@@ -0,0 +1,209 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+)
+
+// lockRetryInterval is how long the build step waits before starting the build of a job with
+// disableConcurrentBuilds() again while another build holds its lock
+const lockRetryInterval = 30 * time.Second
+
+// DownstreamJob is what PrepareDownstreamBuildActivity finds out about the job started by the build step
+type DownstreamJob struct {
+	JobName  string
+	Number   int
+	Pipeline Pipeline
+	Params   map[string]any
+	// QuietPeriod is the one of the build queue, the step waits for it before starting the build
+	QuietPeriod time.Duration
+}
+
+// buildFromStep converts the build step called from a script, e.g. build job: 'other', wait: 'false', into a build step.
+// Parameters can't be passed from a script.
+func buildFromStep(step *Step) *BuildStep {
+	if step.Build != nil {
+		return step.Build
+	}
+	if step.SingleKV != nil {
+		return &BuildStep{Job: step.SingleKV.Value}
+	}
+	build := &BuildStep{}
+	for _, p := range step.MultiKV.Params {
+		value := Boolean(p.Value.Literal() == "true")
+		switch p.Key {
+		case "job":
+			build.Job = p.Value
+		case "wait":
+			build.Wait = &value
+		case "propagate":
+			build.Propagate = &value
+		}
+	}
+	return build
+}
+
+// waits reports whether the step waits for the downstream build to complete, it does by default
+func (build *BuildStep) waits() bool {
+	return build.Wait == nil || bool(*build.Wait)
+}
+
+// propagates reports whether the result of the downstream build becomes the result of the step, it does by default
+func (build *BuildStep) propagates() bool {
+	return build.Propagate == nil || bool(*build.Propagate)
+}
+
+// params lists the arguments of the step, like ToCommand does for other steps
+func (build *BuildStep) params() map[string]interface{} {
+	return map[string]interface{}{
+		"job":       build.Job.Literal(),
+		"wait":      strconv.FormatBool(build.waits()),
+		"propagate": strconv.FormatBool(build.propagates()),
+	}
+}
+
+// values returns the parameter values passed to the downstream job, strings are interpolated within the scope
+func (build *BuildStep) values(sc *scope) (map[string]any, error) {
+	values := make(map[string]any, len(build.Parameters))
+	for _, param := range build.Parameters {
+		value := param.arg("value")
+		switch {
+		case value == nil:
+			continue
+		case value.Bool != nil:
+			values[param.Name()] = bool(*value.Bool)
+		case value.Int != nil:
+			values[param.Name()] = strconv.Itoa(*value.Int)
+		case value.String != nil:
+			s, err := interpolate(string(*value.String), sc)
+			if err != nil {
+				return nil, err
+			}
+			values[param.Name()] = s
+		}
+	}
+	return values, nil
+}
+
+// executeBuild runs the build step
+func executeBuild(ctx workflow.Context, step *Step, variables map[string]string) ([]string, error) {
+	return buildFromStep(step).execute(ctx, variables)
+}
+
+// execute starts the downstream job as a child workflow, after the quiet period of the build queue. Unless
+// told not to, it waits for the child and the stage gets its result: an unstable or failed downstream build
+// makes the stage unstable or failed. Aborting the upstream build aborts the downstream one it waits for.
+func (build *BuildStep) execute(ctx workflow.Context, variables map[string]string) ([]string, error) {
+	if err := awaitResumed(ctx); err != nil {
+		return nil, err
+	}
+	if state, ok := ctx.Value("currentStage").(*StageState); ok {
+		state.CurrentStep = "build"
+	}
+
+	params, _ := ctx.Value("params").(map[string]any)
+	sc := &scope{env: variables, params: params}
+	jobPath, err := interpolate(string(build.Job), sc)
+	if err != nil {
+		return nil, err
+	}
+	values, err := build.values(sc)
+	if err != nil {
+		return nil, err
+	}
+
+	// the API has the jobs
+	prepareCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		TaskQueue:           TriggerTaskQueue,
+		StartToCloseTimeout: time.Minute,
+	})
+	var downstream DownstreamJob
+	err = workflow.ExecuteActivity(prepareCtx, "PrepareDownstreamBuildActivity", jobPath, values).Get(ctx, &downstream)
+	if err != nil {
+		return nil, err
+	}
+	output := []string{"Scheduling project: " + jobPath}
+	if downstream.QuietPeriod > 0 {
+		if err := workflow.Sleep(ctx, downstream.QuietPeriod); err != nil {
+			return output, err
+		}
+	}
+
+	buildId := strconv.Itoa(downstream.Number)
+	properties := map[string]interface{}{
+		"jobName":     downstream.JobName,
+		"jobId":       buildId,
+		"buildNumber": buildId,
+		"params":      downstream.Params,
+		"triggeredBy": jobs.UpstreamCause,
+	}
+	if upstream, ok := ctx.Value("properties").(map[string]interface{}); ok {
+		properties["upstreamProject"] = upstream["jobName"]
+		properties["upstreamBuild"] = upstream["buildNumber"]
+	}
+
+	child, err := startDownstream(ctx, &downstream, properties, !build.waits())
+	if err != nil {
+		return output, err
+	}
+	output = append(output, fmt.Sprintf("Starting building: %s #%s", downstream.JobName, buildId))
+	if c, ok := ctx.Value("control").(*control); ok {
+		c.state.Downstream = append(c.state.Downstream, jobs.DownstreamBuild{JobName: downstream.JobName, Number: downstream.Number})
+	}
+	if !build.waits() {
+		return output, nil
+	}
+
+	result := resultOf(child.Get(ctx, nil))
+	output = append(output, fmt.Sprintf("%s #%s completed: %s", downstream.JobName, buildId, result))
+	if result == Success || !build.propagates() {
+		return output, nil
+	}
+
+	message := fmt.Sprintf("%s #%s completed with status %s", downstream.JobName, buildId, result)
+	switch result {
+	case Unstable:
+		return output, temporal.NewNonRetryableApplicationError(message, unstableErrType, nil)
+	case Aborted:
+		return output, temporal.NewNonRetryableApplicationError(message, abortedErrType, nil)
+	}
+	return output, temporal.NewNonRetryableApplicationError(message, "downstream", nil)
+}
+
+// startDownstream starts the downstream build as a child workflow whose id is the build id, e.g. /jobs/other/12.
+// Like ExecuteBuild, the build of a job with disableConcurrentBuilds() runs as the child of JobLockWorkflow,
+// the step waits while another build of the job holds the lock. An abandoned child outlives this build.
+func startDownstream(ctx workflow.Context, downstream *DownstreamJob, properties map[string]interface{}, abandon bool) (workflow.ChildWorkflowFuture, error) {
+	workflowId := downstream.JobName + "/" + strconv.Itoa(downstream.Number)
+	options := workflow.ChildWorkflowOptions{WorkflowID: workflowId}
+	if abandon {
+		options.ParentClosePolicy = enumspb.PARENT_CLOSE_POLICY_ABANDON
+	}
+	if !downstream.Pipeline.Options.DisableConcurrentBuilds() {
+		child := workflow.ExecuteChildWorkflow(workflow.WithChildOptions(ctx, options), "GroovyDSLWorkflow", downstream.Pipeline, properties)
+		return child, child.GetChildWorkflowExecution().Get(ctx, nil)
+	}
+
+	options.WorkflowID = lockPrefix + downstream.JobName
+	options.WorkflowIDReusePolicy = enumspb.WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE
+	for {
+		child := workflow.ExecuteChildWorkflow(workflow.WithChildOptions(ctx, options), "JobLockWorkflow", workflowId, downstream.Pipeline, properties)
+		err := child.GetChildWorkflowExecution().Get(ctx, nil)
+		var running *temporal.ChildWorkflowExecutionAlreadyStartedError
+		if !errors.As(err, &running) {
+			return child, err
+		}
+		workflow.GetLogger(ctx).Info("Waiting for the running build", "job", downstream.JobName)
+		if err := workflow.Sleep(ctx, lockRetryInterval); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+)
+
+func TestBuildStep(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('Components') {
+				steps {
+					build job: 'components/api', parameters: [string(name: 'VERSION', value: "1.${BUILD_NUMBER}"), booleanParam(name: 'DRY_RUN', value: true)]
+					build job: 'components/docs', wait: false
+					build job: 'components/web', propagate: false
+				}
+			}
+			stage('Release') {
+				steps {
+					build 'release'
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+	downstreamPipeline, err := dslParser.Parse(`pipeline { agent none stages { stage('Build') { steps { echo 'build' } } } }`)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+	// release has disableConcurrentBuilds()
+	lockedPipeline, err := dslParser.Parse(`pipeline { agent none options { disableConcurrentBuilds() } stages { stage('Release') { steps { echo 'release' } } } }`)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+	registerAPIActivities(env)
+	// the downstream builds are mocked, the upstream one runs under another name
+	env.RegisterWorkflow(GroovyDSLWorkflow)
+	env.RegisterWorkflow(JobLockWorkflow)
+	env.RegisterWorkflowWithOptions(GroovyDSLWorkflow, workflow.RegisterOptions{Name: "UpstreamWorkflow"})
+
+	numbers := map[string]int{"components/api": 4, "components/docs": 8, "components/web": 15, "release": 16}
+	var values []map[string]any
+	env.OnActivity("PrepareDownstreamBuildActivity", mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, jobPath string, v map[string]any) (*DownstreamJob, error) {
+			values = append(values, v)
+			downstream := &DownstreamJob{JobName: jobs.FullName(jobPath), Number: numbers[jobPath], Pipeline: *downstreamPipeline, Params: v}
+			if jobPath == "release" {
+				downstream.Pipeline = *lockedPipeline
+			}
+			return downstream, nil
+		})
+
+	var started []map[string]interface{}
+	env.OnWorkflow("GroovyDSLWorkflow", mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx workflow.Context, pipeline Pipeline, properties map[string]interface{}) (map[string]any, error) {
+			started = append(started, properties)
+			if properties["jobName"] == "/jobs/components/jobs/web" {
+				return nil, temporal.NewApplicationError("tests failed", "")
+			}
+			return map[string]any{}, nil
+		})
+	var locked []string
+	env.OnWorkflow("JobLockWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx workflow.Context, workflowId string, pipeline Pipeline, properties map[string]interface{}) (map[string]any, error) {
+			locked = append(locked, workflowId)
+			return nil, temporal.NewNonRetryableApplicationError("stage is unstable", unstableErrType, nil)
+		})
+
+	var record jobs.BuildRecord
+	env.OnActivity("RecordBuildActivity", mock.Anything, "/jobs/my-release", mock.Anything).Return(
+		func(ctx context.Context, jobName string, r jobs.BuildRecord) error {
+			record = r
+			return nil
+		}).Once()
+
+	env.ExecuteWorkflow("UpstreamWorkflow", *pipeline, map[string]interface{}{
+		"jobName":     "/jobs/my-release",
+		"buildNumber": "3",
+	})
+
+	// the unstable release build makes the build unstable, the failed web build isn't propagated
+	if resultOf(env.GetWorkflowError()) != Unstable {
+		t.Fatalf("Expected the build to be unstable, got %v", env.GetWorkflowError())
+	}
+
+	wantValues := []map[string]any{{"VERSION": "1.3", "DRY_RUN": true}, {}, {}, {}}
+	if diff := cmp.Diff(values, wantValues); diff != "" {
+		t.Errorf("Unexpected parameter values (-got +want):\n%s", diff)
+	}
+
+	if len(started) != 3 {
+		t.Fatalf("Expected 3 downstream builds without a lock, got %d", len(started))
+	}
+	wantProperties := map[string]interface{}{
+		"jobName":         "/jobs/components/jobs/api",
+		"jobId":           "4",
+		"buildNumber":     "4",
+		"params":          map[string]any{"VERSION": "1.3", "DRY_RUN": true},
+		"triggeredBy":     jobs.UpstreamCause,
+		"upstreamProject": "/jobs/my-release",
+		"upstreamBuild":   "3",
+	}
+	if diff := cmp.Diff(started[0], wantProperties); diff != "" {
+		t.Errorf("Unexpected downstream properties (-got +want):\n%s", diff)
+	}
+	// the release build holds the lock of its job
+	if diff := cmp.Diff(locked, []string{"/jobs/release/16"}); diff != "" {
+		t.Errorf("Unexpected locked builds (-got +want):\n%s", diff)
+	}
+
+	wantDownstream := []jobs.DownstreamBuild{
+		{JobName: "/jobs/components/jobs/api", Number: 4},
+		{JobName: "/jobs/components/jobs/docs", Number: 8},
+		{JobName: "/jobs/components/jobs/web", Number: 15},
+		{JobName: "/jobs/release", Number: 16},
+	}
+	if diff := cmp.Diff(record.Downstream, wantDownstream); diff != "" {
+		t.Errorf("Unexpected downstream builds in the record (-got +want):\n%s", diff)
+	}
+	if record.Result != string(Unstable) {
+		t.Errorf("Expected the record to be UNSTABLE, got %s", record.Result)
+	}
+}
+
+// registerAPIActivities registers the activities served by the API under their names, so that they can be mocked.
+// Stages with a label go to the task queue of their expression unless LabelTaskQueueActivity is mocked.
+func registerAPIActivities(env *testsuite.TestWorkflowEnvironment) {
+	env.RegisterActivityWithOptions(func(ctx context.Context, jobPath string, values map[string]any) (*DownstreamJob, error) {
+		return nil, nil
+	}, activity.RegisterOptions{Name: "PrepareDownstreamBuildActivity"})
+	env.RegisterActivityWithOptions(func(ctx context.Context, jobName string, number int, result Result) error {
+		return nil
+	}, activity.RegisterOptions{Name: "BuildCompletedActivity"})
+	env.RegisterActivity(&ControllerActivities{})
+	env.RegisterActivityWithOptions(func(ctx context.Context, expression string) (string, error) {
+		return LabelTaskQueue(expression)
+	}, activity.RegisterOptions{Name: "LabelTaskQueueActivity"})
+}
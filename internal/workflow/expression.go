@@ -0,0 +1,277 @@
+package workflow
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// scope holds the values visible to conditions, expressions and script blocks
+type scope struct {
+	env    map[string]string
+	params map[string]any
+	vars   map[string]any
+}
+
+// methods are the only methods script blocks and expressions are allowed to call
+var methods = map[string]func(receiver any, args []any) (any, error){
+	"size": func(receiver any, args []any) (any, error) {
+		switch v := receiver.(type) {
+		case string:
+			return len(v), nil
+		case []any:
+			return len(v), nil
+		}
+		return nil, fmt.Errorf("size() is not supported on %v", receiver)
+	},
+	"isEmpty": func(receiver any, args []any) (any, error) {
+		switch v := receiver.(type) {
+		case string:
+			return len(v) == 0, nil
+		case []any:
+			return len(v) == 0, nil
+		}
+		return nil, fmt.Errorf("isEmpty() is not supported on %v", receiver)
+	},
+	"contains": func(receiver any, args []any) (any, error) {
+		switch v := receiver.(type) {
+		case string:
+			return strings.Contains(v, toString(arg(args, 0))), nil
+		case []any:
+			for _, item := range v {
+				if reflect.DeepEqual(item, arg(args, 0)) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		return nil, fmt.Errorf("contains() is not supported on %v", receiver)
+	},
+	"startsWith": stringMethod(func(s string, args []any) any { return strings.HasPrefix(s, toString(arg(args, 0))) }),
+	"endsWith":   stringMethod(func(s string, args []any) any { return strings.HasSuffix(s, toString(arg(args, 0))) }),
+	"trim":       stringMethod(func(s string, args []any) any { return strings.TrimSpace(s) }),
+	"toUpperCase": stringMethod(func(s string, args []any) any { return strings.ToUpper(s) }),
+	"toLowerCase": stringMethod(func(s string, args []any) any { return strings.ToLower(s) }),
+	"split": stringMethod(func(s string, args []any) any {
+		var items []any
+		for _, item := range strings.Split(s, toString(arg(args, 0))) {
+			items = append(items, item)
+		}
+		return items
+	}),
+}
+
+func stringMethod(method func(s string, args []any) any) func(receiver any, args []any) (any, error) {
+	return func(receiver any, args []any) (any, error) {
+		s, ok := receiver.(string)
+		if !ok {
+			return nil, fmt.Errorf("string method called on %v", receiver)
+		}
+		return method(s, args), nil
+	}
+}
+
+func arg(args []any, i int) any {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+func (expr *Expression) evaluate(sc *scope) (any, error) {
+	if len(expr.Or) == 1 {
+		return expr.Or[0].evaluate(sc)
+	}
+	for _, and := range expr.Or {
+		value, err := and.evaluate(sc)
+		if err != nil || isTruthy(value) {
+			return err == nil, err
+		}
+	}
+	return false, nil
+}
+
+func (expr *AndExpression) evaluate(sc *scope) (any, error) {
+	if len(expr.And) == 1 {
+		return expr.And[0].evaluate(sc)
+	}
+	for _, unary := range expr.And {
+		value, err := unary.evaluate(sc)
+		if err != nil || !isTruthy(value) {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (expr *UnaryExpression) evaluate(sc *scope) (any, error) {
+	if expr.Not != nil {
+		value, err := expr.Not.evaluate(sc)
+		return !isTruthy(value), err
+	}
+	return expr.Comparison.evaluate(sc)
+}
+
+func (expr *Comparison) evaluate(sc *scope) (any, error) {
+	left, err := expr.Left.evaluate(sc)
+	if err != nil || expr.Operator == "" {
+		return left, err
+	}
+	right, err := expr.Right.evaluate(sc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch expr.Operator {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	}
+
+	var cmp int
+	switch l := left.(type) {
+	case int:
+		r, ok := right.(int)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %v with %v", left, right)
+		}
+		cmp = l - r
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %v with %v", left, right)
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		return nil, fmt.Errorf("cannot compare %v with %v", left, right)
+	}
+	switch expr.Operator {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+func (expr *Sum) evaluate(sc *scope) (any, error) {
+	sum, err := expr.Terms[0].evaluate(sc)
+	if err != nil {
+		return nil, err
+	}
+	for _, term := range expr.Terms[1:] {
+		value, err := term.evaluate(sc)
+		if err != nil {
+			return nil, err
+		}
+		l, lok := sum.(int)
+		r, rok := value.(int)
+		if lok && rok {
+			sum = l + r
+			continue
+		}
+		if list, ok := sum.([]any); ok {
+			if items, ok := value.([]any); ok {
+				sum = append(append([]any{}, list...), items...)
+			} else {
+				sum = append(append([]any{}, list...), value)
+			}
+			continue
+		}
+		sum = toString(sum) + toString(value)
+	}
+	return sum, nil
+}
+
+func (operand *Operand) evaluate(sc *scope) (any, error) {
+	switch {
+	case operand.Sub != nil:
+		return operand.Sub.evaluate(sc)
+	case operand.Bool != nil:
+		return bool(*operand.Bool), nil
+	case operand.Int != nil:
+		return *operand.Int, nil
+	case operand.String != nil:
+		return interpolate(string(*operand.String), sc)
+	case operand.List != nil:
+		items := make([]any, 0, len(operand.List.Items))
+		for _, item := range operand.List.Items {
+			value, err := item.evaluate(sc)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	}
+	return operand.Reference.evaluate(sc)
+}
+
+func (reference *Reference) evaluate(sc *scope) (any, error) {
+	if reference.Call == nil {
+		return sc.resolve(reference.Path)
+	}
+
+	name := reference.Path[len(reference.Path)-1]
+	method, ok := methods[name]
+	if !ok || len(reference.Path) < 2 {
+		return nil, fmt.Errorf("method %s is not permitted", name)
+	}
+	receiver, err := sc.resolve(reference.Path[:len(reference.Path)-1])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]any, 0, len(reference.Call.Args))
+	for _, argExpr := range reference.Call.Args {
+		value, err := argExpr.evaluate(sc)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	return method(receiver, args)
+}
+
+// resolve looks up a local variable, env.NAME, params.NAME or a bare environment variable NAME.
+// Unknown names resolve to null.
+func (sc *scope) resolve(path []string) (any, error) {
+	if len(path) == 1 && path[0] == "null" {
+		return nil, nil
+	}
+	if value, ok := sc.vars[path[0]]; ok && len(path) == 1 {
+		return value, nil
+	}
+	if len(path) == 2 && path[0] == "params" {
+		return sc.params[path[1]], nil
+	}
+	if len(path) == 2 && path[0] == "env" {
+		path = path[1:]
+	}
+	if len(path) != 1 {
+		return nil, fmt.Errorf("unknown property %s", strings.Join(path, "."))
+	}
+	if value, ok := sc.env[path[0]]; ok {
+		return value, nil
+	}
+	return nil, nil
+}
+
+// isTruthy follows Groovy truth: null, false, 0, empty strings and empty lists are false
+func isTruthy(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	}
+	return true
+}
@@ -0,0 +1,179 @@
+package workflow
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// InputSignal carries an InputResponse to a build waiting for input
+const InputSignal = "input"
+
+type (
+	// InputResponse approves or rejects a pending input
+	InputResponse struct {
+		Id         string         `json:"id"`
+		Approve    bool           `json:"approve"`
+		// Submitter is the authenticated user who responds, the API doesn't take it from the request body
+		Submitter  string         `json:"submitter"`
+		Parameters map[string]any `json:"parameters,omitempty"`
+	}
+
+	// PendingInput is an input waiting for a response, it's listed in the build state
+	PendingInput struct {
+		Id      string `json:"id"`
+		Stage   string `json:"stage"`
+		Message string `json:"message"`
+		Ok      string `json:"ok"`
+		// Submitter is a comma-separated list of the users allowed to respond, anyone may if it's empty
+		Submitter  string     `json:"submitter,omitempty"`
+		Parameters Parameters `json:"parameters,omitempty"`
+	}
+)
+
+// inputFromStep converts the input step, e.g. input message: 'Deploy?', ok: 'Deploy', into an input
+func inputFromStep(step *Step) *Input {
+	if step.SingleKV != nil {
+		return &Input{Message: step.SingleKV.Value}
+	}
+	input := &Input{}
+	for _, p := range step.MultiKV.Params {
+		value := p.Value
+		switch p.Key {
+		case "message":
+			input.Message = value
+		case "id":
+			input.Id = &value
+		case "ok":
+			input.Ok = &value
+		case "submitter":
+			input.Submitter = &value
+		}
+	}
+	return input
+}
+
+// execute waits for a response to the input. It returns the submitted parameter values and the submitter.
+// The input id defaults to the name of the stage.
+func (input *Input) execute(ctx workflow.Context, variables map[string]string) (map[string]any, string, error) {
+	params, _ := ctx.Value("params").(map[string]any)
+	sc := &scope{env: variables, params: params}
+	message, err := interpolate(string(input.Message), sc)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pending := &PendingInput{
+		Message:    message,
+		Ok:         "Proceed",
+		Parameters: input.Parameters,
+	}
+	if state, ok := ctx.Value("currentStage").(*StageState); ok {
+		state.CurrentStep = "input"
+		pending.Id = state.Name
+		pending.Stage = state.Name
+	}
+	if input.Id != nil {
+		pending.Id = input.Id.Literal()
+	}
+	if input.Ok != nil {
+		pending.Ok = input.Ok.Literal()
+	}
+	if input.Submitter != nil {
+		if pending.Submitter, err = interpolate(string(*input.Submitter), sc); err != nil {
+			return nil, "", err
+		}
+	}
+	return waitForInput(ctx, pending)
+}
+
+// executeInput runs the input step and reports who approved it
+func executeInput(ctx workflow.Context, step *Step, variables map[string]string) ([]string, string, error) {
+	_, submitter, err := inputFromStep(step).execute(ctx, variables)
+	if err != nil {
+		return nil, submitter, err
+	}
+	return []string{fmt.Sprintf("Approved by %s", submitter)}, submitter, nil
+}
+
+// waitForInput lists the input in the build state and blocks until a permitted user responds to it.
+// Rejections and timeouts abort the stage. The wait is bounded by the timeout option of the stage or pipeline.
+func waitForInput(ctx workflow.Context, pending *PendingInput) (map[string]any, string, error) {
+	c, ok := ctx.Value("control").(*control)
+	if !ok {
+		return nil, "", fmt.Errorf("input %s can't be answered", pending.Id)
+	}
+	logger := workflow.GetLogger(ctx)
+
+	c.state.Inputs = append(c.state.Inputs, pending)
+	defer func() {
+		c.state.Inputs = slices.DeleteFunc(c.state.Inputs, func(input *PendingInput) bool {
+			return input == pending
+		})
+	}()
+
+	timeout, _ := ctx.Value("inputTimeout").(time.Duration)
+	deadline := workflow.Now(ctx).Add(timeout)
+	for {
+		hasResponse := func() bool {
+			return len(c.responses[pending.Id]) > 0
+		}
+		if timeout > 0 {
+			ok, err := workflow.AwaitWithTimeout(ctx, deadline.Sub(workflow.Now(ctx)), hasResponse)
+			if err != nil {
+				return nil, "", err
+			}
+			if !ok {
+				return nil, "", temporal.NewNonRetryableApplicationError("input timed out", abortedErrType, nil)
+			}
+		} else if err := workflow.Await(ctx, hasResponse); err != nil {
+			return nil, "", err
+		}
+
+		response := c.responses[pending.Id][0]
+		c.responses[pending.Id] = c.responses[pending.Id][1:]
+		values, err := pending.Validate(response)
+		if err != nil {
+			logger.Warn("Input response ignored", "id", pending.Id, "error", err)
+			continue
+		}
+		if !response.Approve {
+			message := fmt.Sprintf("input rejected by %s", response.Submitter)
+			return nil, response.Submitter, temporal.NewNonRetryableApplicationError(message, abortedErrType, nil)
+		}
+		logger.Info("Input approved", "id", pending.Id, "submitter", response.Submitter)
+		return values, response.Submitter, nil
+	}
+}
+
+// Validate checks that the submitter may respond and resolves the submitted parameter values
+func (pending *PendingInput) Validate(response InputResponse) (map[string]any, error) {
+	if pending.Submitter != "" {
+		submitters := strings.Split(pending.Submitter, ",")
+		for i := range submitters {
+			submitters[i] = strings.TrimSpace(submitters[i])
+		}
+		if !slices.Contains(submitters, response.Submitter) {
+			return nil, fmt.Errorf("%s is not allowed to respond to input %s", response.Submitter, pending.Id)
+		}
+	}
+	if !response.Approve {
+		return nil, nil
+	}
+	return pending.Parameters.Resolve(response.Parameters)
+}
+
+// recordInputValues makes the submitted values visible as environment variables of the following stages
+func recordInputValues(ctx workflow.Context, values map[string]any, variables map[string]string) {
+	inputValues, _ := ctx.Value("inputValues").(map[string]string)
+	for name, value := range toEnv(values) {
+		variables[name] = value
+		if inputValues != nil {
+			inputValues[name] = value
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+const approvalJenkinsfile = `
+    pipeline {
+		agent none
+		stages {
+			stage('Build') {
+				steps {
+					sh 'make'
+				}
+			}
+			stage('Deploy') {
+				options {
+					timeout(time: 1, unit: 'DAYS')
+				}
+				input {
+					message "Deploy build ${BUILD}?"
+					ok 'Deploy'
+					submitter 'alice, bob'
+					parameters {
+						choice(name: 'TARGET', choices: ['staging', 'production'], description: 'Where to deploy')
+					}
+				}
+				steps {
+					sh "make deploy TARGET=${TARGET}"
+				}
+			}
+			stage('Announce') {
+				steps {
+					echo "Deployed to ${TARGET}"
+				}
+			}
+		}
+	}
+    `
+
+func runApproval(t *testing.T, responses map[time.Duration]InputResponse) (*testsuite.TestWorkflowEnvironment, []string, *BuildState) {
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(approvalJenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+
+	var calls []string
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			sc := &scope{env: stageContext.Variables, params: stageContext.Params}
+			_, params, err := steps[0].resolve(sc)
+			if err != nil {
+				return nil, err
+			}
+			calls = append(calls, params["text"].(string))
+			return []string{params["text"].(string)}, nil
+		})
+
+	waiting := &BuildState{}
+	env.RegisterDelayedCallback(func() {
+		encoded, err := env.QueryWorkflow("state")
+		if err != nil {
+			t.Fatalf("Failed to query state: %v", err)
+		}
+		encoded.Get(waiting)
+	}, time.Minute)
+	for delay, response := range responses {
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow(InputSignal, response)
+		}, delay)
+	}
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{
+		"params": map[string]any{"BUILD": "42"},
+	})
+	return env, calls, waiting
+}
+
+func TestInputApproved(t *testing.T) {
+	env, calls, waiting := runApproval(t, map[time.Duration]InputResponse{
+		// not a release manager, ignored
+		time.Hour: {Id: "Deploy", Approve: true, Submitter: "eve", Parameters: map[string]any{"TARGET": "staging"}},
+		// not one of the choices, ignored
+		2 * time.Hour: {Id: "Deploy", Approve: true, Submitter: "bob", Parameters: map[string]any{"TARGET": "qa"}},
+		3 * time.Hour: {Id: "Deploy", Approve: true, Submitter: "bob", Parameters: map[string]any{"TARGET": "production"}},
+	})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	want := []*PendingInput{{
+		Id:        "Deploy",
+		Stage:     "Deploy",
+		Message:   "Deploy build 42?",
+		Ok:        "Deploy",
+		Submitter: "alice, bob",
+	}}
+	if diff := cmp.Diff(waiting.Inputs, want, ignorePositions, cmp.FilterPath(func(p cmp.Path) bool {
+		return p.Last().String() == ".Parameters"
+	}, cmp.Ignore())); diff != "" {
+		t.Errorf("Unexpected pending inputs (-got +want):\n%s", diff)
+	}
+	if waiting.Stages[1].CurrentStep != "input" {
+		t.Errorf("Expected Deploy to wait for input, got %+v", waiting.Stages[1])
+	}
+
+	// the approved values are visible to the stage and the following ones
+	if diff := cmp.Diff(calls, []string{"make", "make deploy TARGET=production", "Deployed to production"}); diff != "" {
+		t.Errorf("Unexpected steps (-got +want):\n%s", diff)
+	}
+}
+
+func TestInputRejected(t *testing.T) {
+	env, calls, _ := runApproval(t, map[time.Duration]InputResponse{
+		time.Hour: {Id: "Deploy", Approve: false, Submitter: "alice"},
+	})
+
+	var appErr *temporal.ApplicationError
+	if err := env.GetWorkflowError(); !errors.As(err, &appErr) || appErr.Type() != abortedErrType {
+		t.Fatalf("Expected the build to be aborted, got %v", err)
+	}
+	if diff := cmp.Diff(calls, []string{"make"}); diff != "" {
+		t.Errorf("Unexpected steps (-got +want):\n%s", diff)
+	}
+}
+
+func TestInputTimeout(t *testing.T) {
+	env, calls, _ := runApproval(t, map[time.Duration]InputResponse{
+		48 * time.Hour: {Id: "Deploy", Approve: true, Submitter: "alice", Parameters: map[string]any{"TARGET": "staging"}},
+	})
+
+	var appErr *temporal.ApplicationError
+	if err := env.GetWorkflowError(); !errors.As(err, &appErr) || appErr.Type() != abortedErrType {
+		t.Fatalf("Expected the build to be aborted, got %v", err)
+	}
+	if diff := cmp.Diff(calls, []string{"make"}); diff != "" {
+		t.Errorf("Unexpected steps (-got +want):\n%s", diff)
+	}
+}
+
+func TestInputStep(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('Release') {
+				steps {
+					input message: 'Release?', ok: 'Release', id: 'release'
+					script {
+						if (params.PUBLISH) {
+							input 'Publish?'
+							echo 'Published'
+						}
+					}
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			_, params := steps[0].ToCommand()
+			return []string{params["text"].(string)}, nil
+		})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(InputSignal, InputResponse{Id: "release", Approve: true, Submitter: "alice"})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(InputSignal, InputResponse{Id: "Release", Approve: true, Submitter: "bob"})
+	}, time.Hour)
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{
+		"params": map[string]any{"PUBLISH": true},
+	})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	var results map[string]any
+	if err := env.GetWorkflowResult(&results); err != nil {
+		t.Fatalf("Failed to get workflow result: %v", err)
+	}
+	want := map[string]any{
+		"Release": []any{"Approved by alice", "Approved by bob", "Published"},
+	}
+	if diff := cmp.Diff(results, want); diff != "" {
+		t.Errorf("Unexpected results (-got +want):\n%s", diff)
+	}
+}
+
+func TestWorkflowStepsInPost(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('Build') {
+				steps {
+					echo 'build'
+				}
+			}
+		}
+		post {
+			always {
+				script {
+					echo 'from script'
+				}
+				input message: 'Clean up?', id: 'cleanup'
+				build 'cleanup'
+			}
+			always {
+				echo 'done'
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+	registerAPIActivities(env)
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			var output []string
+			for _, step := range steps {
+				if step.runsInWorkflow() {
+					t.Errorf("Step %s reached StageActivity", step.Name())
+				}
+				_, params := step.ToCommand()
+				output = append(output, params["text"].(string))
+			}
+			return output, nil
+		})
+	// the cleanup build is mocked, the build with the post conditions runs under another name
+	env.RegisterWorkflow(GroovyDSLWorkflow)
+	env.RegisterWorkflowWithOptions(GroovyDSLWorkflow, workflow.RegisterOptions{Name: "UpstreamWorkflow"})
+	env.OnActivity("PrepareDownstreamBuildActivity", mock.Anything, "cleanup", mock.Anything).Return(
+		&DownstreamJob{JobName: "/jobs/cleanup", Number: 2, Pipeline: *pipeline}, nil)
+	env.OnWorkflow("GroovyDSLWorkflow", mock.Anything, mock.Anything, mock.Anything).Return(map[string]any{}, nil)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(InputSignal, InputResponse{Id: "cleanup", Approve: true, Submitter: "alice"})
+	}, time.Minute)
+
+	env.ExecuteWorkflow("UpstreamWorkflow", *pipeline, map[string]interface{}{})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	var results map[string]any
+	if err := env.GetWorkflowResult(&results); err != nil {
+		t.Fatalf("Failed to get workflow result: %v", err)
+	}
+	want := map[string]any{
+		"Build": []any{"build"},
+		"Declarative: Post Actions": map[string]any{
+			"always": []any{
+				"from script",
+				"Approved by alice",
+				"Scheduling project: cleanup",
+				"Starting building: /jobs/cleanup #2",
+				"/jobs/cleanup #2 completed: SUCCESS",
+				"done",
+			},
+		},
+	}
+	if diff := cmp.Diff(results, want); diff != "" {
+		t.Errorf("Unexpected results (-got +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,133 @@
+package workflow
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/participle/v2"
+)
+
+var expressionParser = participle.MustBuild[Expression](
+	participle.Lexer(lexerRules),
+)
+
+// groovyEscapes maps Groovy escape sequences onto the characters they stand for
+var groovyEscapes = map[byte]string{
+	'n': "\n", 't': "\t", 'r': "\r", 'b': "\b", 'f': "\f",
+	'\\': "\\", '\'': "'", '"': "\"", '$': "$",
+}
+
+// toTemplate converts a quoted Groovy string literal into a template. Escape sequences are resolved,
+// except that '\' and '$' which must not start a placeholder are kept escaped with '\'.
+// Single-quoted strings, including ''' multi-line strings, are never interpolated.
+func toTemplate(literal string) string {
+	quote := literal[0]
+	body := literal[1 : len(literal)-1]
+	if len(literal) >= 6 && (strings.HasPrefix(literal, `"""`) || strings.HasPrefix(literal, `'''`)) {
+		body = literal[3 : len(literal)-3]
+	}
+
+	var template strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == '\\' && i+1 < len(body) {
+			i++
+			c = body[i]
+			unescaped, ok := groovyEscapes[c]
+			if !ok {
+				unescaped = "\\" + string(c)
+			}
+			template.WriteString(escapeTemplate(unescaped))
+			continue
+		}
+		if quote == '\'' {
+			template.WriteString(escapeTemplate(string(c)))
+			continue
+		}
+		template.WriteByte(c)
+	}
+	return template.String()
+}
+
+// escapeTemplate escapes a plain string so that interpolation leaves it unchanged
+func escapeTemplate(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `$`, `\$`).Replace(value)
+}
+
+// Literal returns the string with escapes resolved and without interpolating the placeholders
+func (s QuotedString) Literal() string {
+	var literal strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		literal.WriteByte(s[i])
+	}
+	return literal.String()
+}
+
+// interpolate resolves ${expression} and $name placeholders of the template within the scope
+func interpolate(template string, sc *scope) (string, error) {
+	var result strings.Builder
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		switch {
+		case c == '\\' && i+1 < len(template):
+			i++
+			result.WriteByte(template[i])
+		case c == '$' && i+1 < len(template) && template[i+1] == '{':
+			end := strings.IndexByte(template[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated placeholder in %q", template)
+			}
+			expr, err := expressionParser.ParseString("", template[i+2:i+end])
+			if err != nil {
+				return "", fmt.Errorf("invalid placeholder in %q: %w", template, err)
+			}
+			value, err := expr.evaluate(sc)
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(toString(value))
+			i += end
+		case c == '$' && i+1 < len(template) && isIdentStart(template[i+1]):
+			end := i + 1
+			for end < len(template) && (isIdentStart(template[end]) || isDigit(template[end]) ||
+				template[end] == '.' && end+1 < len(template) && isIdentStart(template[end+1])) {
+				end++
+			}
+			value, err := sc.resolve(strings.Split(template[i+1:end], "."))
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(toString(value))
+			i = end - 1
+		default:
+			result.WriteByte(c)
+		}
+	}
+	return result.String(), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// toString formats a value the way Groovy prints it
+func toString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = toString(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,161 @@
+package workflow
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yegor86/tumbler-doll/internal/cryptography"
+	"github.com/yegor86/tumbler-doll/internal/jenkins/xml"
+)
+
+func TestParseMultilineStrings(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('Build') {
+				steps {
+					sh '''
+						make clean
+						make VERSION=$VERSION
+					'''
+					sh """
+						echo "Building ${env.BRANCH_NAME}"
+					"""
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	sc := &scope{env: map[string]string{"BRANCH_NAME": "main", "VERSION": "1.0"}}
+	var got []string
+	for _, step := range pipeline.Stages[0].Steps {
+		_, params, err := step.resolve(sc)
+		if err != nil {
+			t.Fatalf("Failed to resolve step: %v", err)
+		}
+		got = append(got, params["text"].(string))
+	}
+
+	want := []string{
+		"\n\t\t\t\t\t\tmake clean\n\t\t\t\t\t\tmake VERSION=$VERSION\n\t\t\t\t\t",
+		"\n\t\t\t\t\t\techo \"Building main\"\n\t\t\t\t\t",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Multi-line strings are not resolved (-got +want):\n%s", diff)
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	sc := &scope{
+		env:    map[string]string{"FOO": "foo", "BUILD_NUMBER": "42"},
+		params: map[string]any{"TARGET": "linux", "DRY_RUN": true},
+	}
+
+	tests := []struct {
+		literal string
+		want    string
+	}{
+		{`'${env.FOO} $BUILD_NUMBER'`, "${env.FOO} $BUILD_NUMBER"},
+		{`"${env.FOO}"`, "foo"},
+		{`"build #$BUILD_NUMBER"`, "build #42"},
+		{`"make ${params.TARGET} dry=$params.DRY_RUN"`, "make linux dry=true"},
+		{`"${env.FOO + '-' + BUILD_NUMBER}"`, "foo-42"},
+		{`"\${env.FOO} costs \$5"`, "${env.FOO} costs $5"},
+		{`"$UNDEFINED"`, "null"},
+	}
+
+	for _, test := range tests {
+		got, err := interpolate(toTemplate(test.literal), sc)
+		if err != nil {
+			t.Fatalf("Failed to interpolate %s: %v", test.literal, err)
+		}
+		if got != test.want {
+			t.Errorf("interpolate(%s) = %q, want %q", test.literal, got, test.want)
+		}
+	}
+}
+
+func TestEnvironmentInterpolation(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		environment {
+			REGISTRY = 'registry.local'
+			IMAGE = "${REGISTRY}/app:${params.TAG}"
+			DEPLOY_TOKEN = credentials('deploy-token')
+		}
+		stages {
+			stage('Publish') {
+				steps {
+					sh "docker push $IMAGE"
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	variables, err := pipeline.Environment.merge(map[string]string{}, map[string]any{"TAG": "v1"})
+	if err != nil {
+		t.Fatalf("Failed to merge environment: %v", err)
+	}
+	if diff := cmp.Diff(variables, map[string]string{"REGISTRY": "registry.local", "IMAGE": "registry.local/app:v1"}); diff != "" {
+		t.Errorf("Environment is not interpolated (-got +want):\n%s", diff)
+	}
+
+	bindings := pipeline.Environment.credentials(nil)
+	if diff := cmp.Diff(bindings, map[string]string{"DEPLOY_TOKEN": "deploy-token"}); diff != "" {
+		t.Errorf("Credentials are not bound (-got +want):\n%s", diff)
+	}
+}
+
+func TestBindCredentials(t *testing.T) {
+	crypto := cryptography.GetInstance()
+	saved := crypto.Credentials
+	defer func() { crypto.Credentials = saved }()
+	crypto.Credentials = []xml.Credential{
+		{Tags: map[string]string{"id": "token", "secret": "s3cr3t"}},
+		{Tags: map[string]string{"id": "registry", "username": "admin", "password": "pa55"}},
+		{Tags: map[string]string{"id": "ssh", "username": "root", "privateKey": "key"}},
+	}
+
+	got, err := bindCredentials(
+		map[string]string{"CC": "clang"},
+		map[string]string{"TOKEN": "token", "REGISTRY": "registry"},
+	)
+	if err != nil {
+		t.Fatalf("Failed to bind credentials: %v", err)
+	}
+	want := map[string]string{
+		"CC":           "clang",
+		"TOKEN":        "s3cr3t",
+		"REGISTRY":     "admin:pa55",
+		"REGISTRY_USR": "admin",
+		"REGISTRY_PSW": "pa55",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Credentials are not bound (-got +want):\n%s", diff)
+	}
+
+	if _, err := bindCredentials(nil, map[string]string{"KEY": "ssh"}); err == nil {
+		t.Errorf("Expected an error binding ssh credentials")
+	}
+	if _, err := bindCredentials(nil, map[string]string{"KEY": "missing"}); err == nil {
+		t.Errorf("Expected an error binding missing credentials")
+	}
+}
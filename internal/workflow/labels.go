@@ -0,0 +1,317 @@
+package workflow
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultTaskQueue is polled by every worker, the workflows and the stages without a label run there
+const DefaultTaskQueue = "JobQueue"
+
+// TriggerTaskQueue is served by the API, it enqueues the builds of triggered jobs
+const TriggerTaskQueue = "TriggerQueue"
+
+// ControllerTaskQueue is served by the API, it keeps the secrets of the builds in its JENKINS_HOME
+const ControllerTaskQueue = "ControllerQueue"
+
+// NodesTaskQueue is served by the API, it knows the nodes and picks the task queue of a label expression
+const NodesTaskQueue = "NodesQueue"
+
+type (
+	// LabelExpression selects the nodes a stage can run on, e.g. linux && docker.
+	// Labels combine with !, &&, ||, -> and <->, from the tightest to the loosest, and parentheses.
+	LabelExpression struct {
+		expr labelExpr
+	}
+
+	labelExpr interface {
+		matches(labels map[string]bool) bool
+		precedence() int
+		String() string
+	}
+
+	labelAtom string
+
+	labelNot struct {
+		operand labelExpr
+	}
+
+	labelBinary struct {
+		op          string
+		left, right labelExpr
+	}
+
+	labelParser struct {
+		tokens []string
+		pos    int
+	}
+)
+
+// labelOperators are the binary operators from the loosest to the tightest
+var labelOperators = []string{"<->", "->", "||", "&&"}
+
+// ParseLabelExpression parses a label expression, labels with spaces or operators in them are quoted
+func ParseLabelExpression(expression string) (*LabelExpression, error) {
+	tokens, err := tokenizeLabel(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty label expression")
+	}
+	p := &labelParser{tokens: tokens}
+	expr, err := p.parseBinary(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label expression %q: %w", expression, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("invalid label expression %q: unexpected %s", expression, p.tokens[p.pos])
+	}
+	return &LabelExpression{expr: expr}, nil
+}
+
+// Matches reports whether a node with the labels can run the stages with the expression
+func (l *LabelExpression) Matches(labels []string) bool {
+	set := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		set[label] = true
+	}
+	return l.expr.matches(set)
+}
+
+// String returns the expression in its canonical form, equivalent expressions written differently
+// e.g. with extra spaces or parentheses, have the same one
+func (l *LabelExpression) String() string {
+	return l.expr.String()
+}
+
+// LabelTaskQueue returns the task queue the stages with the label expression are dispatched to,
+// the workers of the nodes matching the expression poll it
+func LabelTaskQueue(expression string) (string, error) {
+	label, err := ParseLabelExpression(expression)
+	if err != nil {
+		return "", err
+	}
+	return DefaultTaskQueue + "@" + label.String(), nil
+}
+
+// Labels returns the label expressions of the agents of the pipeline and its stages.
+// Expressions which are only known at runtime, e.g. ${params.OS}, are left out.
+func (pipeline *Pipeline) Labels() []string {
+	var labels []string
+	add := func(agent *Agent) {
+		if label := agent.label(); label != "" && !strings.Contains(label, "${") {
+			labels = append(labels, label)
+		}
+	}
+
+	add(pipeline.Agent)
+	var walk func(stages []*Stage)
+	walk = func(stages []*Stage) {
+		for _, stage := range stages {
+			add(stage.Agent)
+			walk(stage.Parallel)
+			walk(stage.Stages)
+			if stage.Matrix != nil {
+				add(stage.Matrix.Agent)
+				walk(stage.Matrix.Stages)
+			}
+		}
+	}
+	walk(pipeline.Stages)
+	return labels
+}
+
+// label returns the label expression of the agent, an agent without one runs on the default task queue
+func (agent *Agent) label() string {
+	switch {
+	case agent == nil:
+		return ""
+	case agent.Label != nil:
+		return strings.TrimSpace(agent.Label.Literal())
+	case agent.Dockerfile != nil:
+		return strings.TrimSpace(agent.Dockerfile.Label.Literal())
+	case agent.Docker != nil:
+		return strings.TrimSpace(agent.Docker.Label.Literal())
+	}
+	return ""
+}
+
+func tokenizeLabel(expression string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expression); {
+		rest := expression[i:]
+		switch {
+		case unicode.IsSpace(rune(rest[0])):
+			i++
+			continue
+		case strings.HasPrefix(rest, "<->"):
+			tokens = append(tokens, "<->")
+			i += 3
+			continue
+		case strings.HasPrefix(rest, "->"), strings.HasPrefix(rest, "&&"), strings.HasPrefix(rest, "||"):
+			tokens = append(tokens, rest[:2])
+			i += 2
+			continue
+		case strings.ContainsRune("!()", rune(rest[0])):
+			tokens = append(tokens, rest[:1])
+			i++
+			continue
+		case rest[0] == '"':
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed quote in label expression %q", expression)
+			}
+			// quoted labels are kept with their quotes to tell them from the operators
+			tokens = append(tokens, rest[:end+2])
+			i += end + 2
+			continue
+		}
+
+		end := i
+		for end < len(expression) && !isLabelDelimiter(expression[end:]) {
+			end++
+		}
+		if end == i {
+			return nil, fmt.Errorf("unexpected %q in label expression %q", expression[i], expression)
+		}
+		tokens = append(tokens, expression[i:end])
+		i = end
+	}
+	return tokens, nil
+}
+
+func isLabelDelimiter(s string) bool {
+	return unicode.IsSpace(rune(s[0])) || strings.ContainsRune("!()\"&|<", rune(s[0])) || strings.HasPrefix(s, "->")
+}
+
+// parseBinary parses the operators from the level given by their index in labelOperators on
+func (p *labelParser) parseBinary(level int) (labelExpr, error) {
+	if level == len(labelOperators) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == labelOperators[level] {
+		p.pos++
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &labelBinary{op: labelOperators[level], left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *labelParser) parseUnary() (labelExpr, error) {
+	token := p.peek()
+	p.pos++
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end")
+	case token == "!":
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &labelNot{operand: operand}, nil
+	case token == "(":
+		expr, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return expr, nil
+	case token == ")" || isLabelOperator(token):
+		return nil, fmt.Errorf("unexpected %s", token)
+	case strings.HasPrefix(token, `"`):
+		return labelAtom(token[1 : len(token)-1]), nil
+	}
+	return labelAtom(token), nil
+}
+
+func (p *labelParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func isLabelOperator(token string) bool {
+	for _, op := range labelOperators {
+		if token == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (atom labelAtom) matches(labels map[string]bool) bool {
+	return labels[string(atom)]
+}
+
+func (atom labelAtom) precedence() int {
+	return len(labelOperators) + 1
+}
+
+func (atom labelAtom) String() string {
+	s := string(atom)
+	if s == "" || strings.ContainsFunc(s, func(r rune) bool { return r < 0x80 && isLabelDelimiter(string(r)) }) || strings.Contains(s, "->") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func (not *labelNot) matches(labels map[string]bool) bool {
+	return !not.operand.matches(labels)
+}
+
+func (not *labelNot) precedence() int {
+	return len(labelOperators)
+}
+
+func (not *labelNot) String() string {
+	return "!" + parenthesize(not.operand, not.precedence())
+}
+
+func (binary *labelBinary) matches(labels map[string]bool) bool {
+	left, right := binary.left.matches(labels), binary.right.matches(labels)
+	switch binary.op {
+	case "&&":
+		return left && right
+	case "||":
+		return left || right
+	case "->":
+		return !left || right
+	}
+	return left == right
+}
+
+func (binary *labelBinary) precedence() int {
+	for i, op := range labelOperators {
+		if op == binary.op {
+			return i
+		}
+	}
+	return 0
+}
+
+func (binary *labelBinary) String() string {
+	// operators associate to the left, a right operand of the same precedence keeps its parentheses
+	return parenthesize(binary.left, binary.precedence()) + " " + binary.op + " " + parenthesize(binary.right, binary.precedence()+1)
+}
+
+// parenthesize wraps the expression in parentheses when it binds looser than the precedence
+func parenthesize(expr labelExpr, precedence int) string {
+	if expr.precedence() < precedence {
+		return "(" + expr.String() + ")"
+	}
+	return expr.String()
+}
@@ -0,0 +1,147 @@
+package workflow
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestParseLabelExpression(t *testing.T) {
+	tests := []struct {
+		expression string
+		canonical  string
+		matches    []string
+		mismatches []string
+	}{
+		{expression: "linux", canonical: "linux", matches: []string{"linux"}, mismatches: []string{"windows"}},
+		{expression: " linux&&docker ", canonical: "linux && docker", matches: []string{"docker", "linux"}, mismatches: []string{"linux"}},
+		{expression: "(linux && docker)", canonical: "linux && docker"},
+		{expression: "linux && docker || windows", canonical: "linux && docker || windows", matches: []string{"windows"}, mismatches: []string{"docker"}},
+		{expression: "linux && (docker || podman)", canonical: "linux && (docker || podman)", matches: []string{"linux", "podman"}, mismatches: []string{"podman"}},
+		{expression: "!windows && x86-64", canonical: "!windows && x86-64", matches: []string{"x86-64"}, mismatches: []string{"windows", "x86-64"}},
+		{expression: "!(a || b)", canonical: "!(a || b)", matches: []string{"c"}, mismatches: []string{"b"}},
+		{expression: "docker -> linux", canonical: "docker -> linux", matches: []string{"windows"}, mismatches: []string{"docker"}},
+		{expression: "a <-> b", canonical: "a <-> b", matches: []string{"a", "b"}, mismatches: []string{"a"}},
+		{expression: `"my label" && linux`, canonical: `"my label" && linux`, matches: []string{"my label", "linux"}, mismatches: []string{"my", "label", "linux"}},
+	}
+	for _, test := range tests {
+		label, err := ParseLabelExpression(test.expression)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", test.expression, err)
+			continue
+		}
+		if got := label.String(); got != test.canonical {
+			t.Errorf("Canonical form of %q is %q, want %q", test.expression, got, test.canonical)
+		}
+		if test.matches != nil && !label.Matches(test.matches) {
+			t.Errorf("%q doesn't match %v", test.expression, test.matches)
+		}
+		if test.mismatches != nil && label.Matches(test.mismatches) {
+			t.Errorf("%q matches %v", test.expression, test.mismatches)
+		}
+	}
+
+	for _, invalid := range []string{"", "linux &&", "(linux", "linux)", "&& linux", `"linux`, "linux & docker", "a b"} {
+		if _, err := ParseLabelExpression(invalid); err == nil {
+			t.Errorf("Parsing %q should fail", invalid)
+		}
+	}
+}
+
+func TestLabelTaskQueue(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent { label 'linux' }
+		stages {
+			stage('Build') {
+				steps {
+					sh 'make'
+				}
+			}
+			stage('Image') {
+				agent { label 'linux&&docker' }
+				stages {
+					stage('Push') {
+						steps {
+							sh 'docker push'
+						}
+					}
+				}
+			}
+			stage('Test') {
+				agent { label '${params.OS}' }
+				steps {
+					sh 'make test'
+				}
+			}
+			stage('Docs') {
+				agent { docker 'sphinx' }
+				steps {
+					sh 'make docs'
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+	if diff := cmp.Diff(pipeline.Labels(), []string{"linux", "linux&&docker"}); diff != "" {
+		t.Errorf("Labels are not equal (-got +want):\n%s", diff)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+	registerAPIActivities(env)
+	env.RegisterWorkflow(GroovyDSLWorkflow)
+	env.SetStartWorkflowOptions(client.StartWorkflowOptions{TaskQueue: DefaultTaskQueue})
+
+	var mutex sync.Mutex
+	taskQueues := make(map[string]string)
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			taskQueues[steps[0].SingleKV.Value.Literal()] = activity.GetInfo(ctx).TaskQueue
+			return []string{}, nil
+		})
+	env.OnActivity("RecordBuildActivity", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	// no worker polls the queue of the expression only known at runtime, the API picks a node matching it
+	env.OnActivity("LabelTaskQueueActivity", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, expression string) (string, error) {
+			if expression == "windows" {
+				return "JobQueue@builder-2", nil
+			}
+			return LabelTaskQueue(expression)
+		})
+
+	properties := map[string]interface{}{
+		"jobName": "/jobs/my-job",
+		"params":  map[string]any{"OS": "windows"},
+	}
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, properties)
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	want := map[string]string{
+		"make":        "JobQueue@linux",
+		"docker push": "JobQueue@linux && docker",
+		"make test":   "JobQueue@builder-2",
+		"make docs":   "JobQueue",
+	}
+	if diff := cmp.Diff(taskQueues, want); diff != "" {
+		t.Errorf("Task queues are not equal (-got +want):\n%s", diff)
+	}
+}
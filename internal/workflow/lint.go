@@ -0,0 +1,197 @@
+package workflow
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+
+	"github.com/yegor86/tumbler-doll/plugins/docker/shared"
+)
+
+// builtinSteps are handled by the workflow or StageActivity itself rather than by a plugin
+var builtinSteps = map[string]bool{
+	"error":    true,
+	"unstable": true,
+	"input":    true,
+	"build":    true,
+	"stash":    true,
+	"unstash":  true,
+}
+
+// requiredParams lists the parameters a step can't run without
+var requiredParams = map[string][]string{
+	"git":   {"url", "branch"},
+	"build": {"job"},
+}
+
+// linter collects the problems the grammar can't catch
+type linter struct {
+	fileName    string
+	isStep      func(string) bool
+	stages      map[string]lexer.Position
+	diagnostics Diagnostics
+}
+
+// Validate parses the script and runs the semantic checks on it.
+// isStep reports whether a step is provided by a plugin, e.g. via PluginManager.GetPluginInfo.
+func (p *DslParser) Validate(fileName string, dslFile string, isStep func(string) bool) Diagnostics {
+	pipeline, err := p.ParseFile(fileName, dslFile)
+	if err != nil {
+		return toDiagnostics(fileName, dslFile, err)
+	}
+	return pipeline.Lint(fileName, isStep)
+}
+
+// Lint checks step names and parameters, stage names and the structure of the stages
+func (pipeline *Pipeline) Lint(fileName string, isStep func(string) bool) Diagnostics {
+	l := &linter{
+		fileName:    fileName,
+		isStep:      isStep,
+		stages:      make(map[string]lexer.Position),
+		diagnostics: Diagnostics{},
+	}
+	l.lintAgent(pipeline.Agent)
+	for _, stage := range pipeline.Stages {
+		l.lintStage(stage)
+	}
+	if pipeline.Post != nil {
+		l.lintPost(pipeline.Post)
+	}
+	return l.diagnostics
+}
+
+func (l *linter) report(pos lexer.Position, token string, format string, args ...any) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		File:    l.fileName,
+		Line:    pos.Line,
+		Column:  pos.Column,
+		Token:   token,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) lintStage(stage *Stage) {
+	name := stage.Name.Literal()
+	if first, ok := l.stages[name]; ok {
+		l.report(stage.Pos, name, "duplicate stage name '%s', first defined at line %d", name, first.Line)
+	} else {
+		l.stages[name] = stage.Pos
+	}
+
+	var bodies []string
+	if len(stage.Steps) > 0 {
+		bodies = append(bodies, "steps")
+	}
+	if len(stage.Parallel) > 0 {
+		bodies = append(bodies, "parallel")
+	}
+	if len(stage.Stages) > 0 {
+		bodies = append(bodies, "stages")
+	}
+	if stage.Matrix != nil {
+		bodies = append(bodies, "matrix")
+	}
+	if len(bodies) > 1 {
+		l.report(stage.Pos, name, "stage '%s' can't combine %s", name, strings.Join(bodies, " and "))
+	} else if len(bodies) == 0 {
+		l.report(stage.Pos, name, "stage '%s' has neither steps, parallel, stages nor matrix", name)
+	}
+
+	l.lintAgent(stage.Agent)
+	for _, step := range stage.Steps {
+		l.lintStep(step)
+	}
+	for _, parallelStage := range stage.Parallel {
+		l.lintStage(parallelStage)
+	}
+	for _, nestedStage := range stage.Stages {
+		l.lintStage(nestedStage)
+	}
+	if stage.Matrix != nil {
+		l.lintAgent(stage.Matrix.Agent)
+		for _, nestedStage := range stage.Matrix.Stages {
+			l.lintStage(nestedStage)
+		}
+	}
+	if stage.Post != nil {
+		l.lintPost(stage.Post)
+	}
+}
+
+// lintAgent checks the label expression and the container engine, unless they're only known at runtime
+func (l *linter) lintAgent(agent *Agent) {
+	if agent != nil && agent.Docker != nil {
+		engine := agent.Docker.Engine.Literal()
+		if engine != "" && !strings.Contains(engine, "${") && !slices.Contains(shared.Engines, engine) {
+			l.report(agent.Pos, engine, "unsupported container engine '%s', expected one of %s", engine, strings.Join(shared.Engines, ", "))
+		}
+	}
+
+	label := agent.label()
+	if label == "" || strings.Contains(label, "${") {
+		return
+	}
+	if _, err := ParseLabelExpression(label); err != nil {
+		l.report(agent.Pos, label, "%v", err)
+	}
+}
+
+func (l *linter) lintPost(post *Post) {
+	for _, condition := range post.Conditions {
+		for _, step := range condition.Steps {
+			l.lintStep(step)
+		}
+	}
+}
+
+func (l *linter) lintStep(step *Step) {
+	if step.Script != nil {
+		l.lintStatements(step.Script.Statements)
+		return
+	}
+
+	command, params := step.ToCommand()
+	if !l.knownStep(step.Pos, command) {
+		return
+	}
+	var missing []string
+	for _, param := range requiredParams[command] {
+		if _, ok := params[param]; !ok {
+			missing = append(missing, param)
+		}
+	}
+	if len(missing) > 0 {
+		l.report(step.Pos, command, "step '%s' is missing required parameters: %s", command, strings.Join(missing, ", "))
+	}
+}
+
+// lintStatements checks the steps called from a script block, their arguments are only known at runtime
+func (l *linter) lintStatements(statements []*Statement) {
+	for _, statement := range statements {
+		switch {
+		case statement.Call != nil:
+			l.knownStep(statement.Call.Pos, statement.Call.Command)
+		case statement.If != nil:
+			for ifStatement := statement.If; ifStatement != nil; {
+				l.lintStatements(ifStatement.Then)
+				if ifStatement.Else == nil {
+					break
+				}
+				l.lintStatements(ifStatement.Else.Statements)
+				ifStatement = ifStatement.Else.If
+			}
+		case statement.For != nil:
+			l.lintStatements(statement.For.Body)
+		}
+	}
+}
+
+func (l *linter) knownStep(pos lexer.Position, command string) bool {
+	if builtinSteps[command] || l.isStep(command) {
+		return true
+	}
+	l.report(pos, command, "unknown step '%s'", command)
+	return false
+}
@@ -0,0 +1,84 @@
+package workflow
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLint(t *testing.T) {
+
+	jenkinsfile := `pipeline {
+    agent none
+    stages {
+        stage('Build') {
+            steps {
+                git url: 'https://example.com/repo.git'
+                make 'all'
+            }
+            parallel {
+                stage('Linux') { steps { sh 'make linux' } }
+            }
+        }
+        stage('Build') {
+            steps {
+                script {
+                    if (params.DEPLOY) { deploy 'staging' } else { echo 'skipped' }
+                }
+            }
+        }
+        stage('Empty') {
+            when { branch 'main' }
+        }
+        stage('Deploy') {
+            agent { label 'linux &&' }
+            steps { sh 'make deploy' }
+        }
+        stage('Package') {
+            agent { docker { image 'alpine'; engine 'rkt' } }
+            steps { sh 'make package' }
+        }
+    }
+    post {
+        always {
+            error 'done'
+        }
+    }
+}`
+
+	isStep := func(step string) bool {
+		return step == "git" || step == "sh" || step == "echo"
+	}
+
+	dslParser := DslParser{}
+	got := dslParser.Validate("Jenkinsfile", jenkinsfile, isStep)
+
+	want := Diagnostics{
+		{File: "Jenkinsfile", Line: 4, Column: 9, Token: "Build", Message: "stage 'Build' can't combine steps and parallel"},
+		{File: "Jenkinsfile", Line: 6, Column: 17, Token: "git", Message: "step 'git' is missing required parameters: branch"},
+		{File: "Jenkinsfile", Line: 7, Column: 17, Token: "make", Message: "unknown step 'make'"},
+		{File: "Jenkinsfile", Line: 13, Column: 9, Token: "Build", Message: "duplicate stage name 'Build', first defined at line 4"},
+		{File: "Jenkinsfile", Line: 16, Column: 42, Token: "deploy", Message: "unknown step 'deploy'"},
+		{File: "Jenkinsfile", Line: 20, Column: 9, Token: "Empty", Message: "stage 'Empty' has neither steps, parallel, stages nor matrix"},
+		{File: "Jenkinsfile", Line: 24, Column: 19, Token: "linux &&", Message: "invalid label expression \"linux &&\": unexpected end"},
+		{File: "Jenkinsfile", Line: 28, Column: 19, Token: "rkt", Message: "unsupported container engine 'rkt', expected one of docker, podman, containerd"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Diagnostics are not equal (-got +want):\n%s", diff)
+	}
+
+	valid := `pipeline {
+    agent none
+    stages {
+        stage('Build') {
+            steps {
+                git url: 'https://example.com/repo.git', branch: 'main'
+                sh 'make'
+            }
+        }
+    }
+}`
+	if got := dslParser.Validate("Jenkinsfile", valid, isStep); len(got) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", got)
+	}
+}
@@ -0,0 +1,67 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+
+	"go.temporal.io/api/enums/v1"
+	temporalClient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// lockPrefix marks the workflows which keep the builds of a job with disableConcurrentBuilds() from overlapping,
+// the job name follows, e.g. lock:/jobs/deploy
+const lockPrefix = "lock:"
+
+// ErrJobRunning is returned when a build of a job with disableConcurrentBuilds() starts while another one runs
+var ErrJobRunning = errors.New("a build of the job is already in progress")
+
+type (
+	// lockedRun is a build started by JobLockWorkflow, it has the id of the build and the outcome of the lock
+	lockedRun struct {
+		temporalClient.WorkflowRun
+		id string
+	}
+)
+
+// ExecuteBuild starts a build with the id and the task queue of the options. The builds of a job with
+// disableConcurrentBuilds() run as the child of JobLockWorkflow, whose id is derived from the job name.
+// Temporal doesn't start a workflow while another one with the same id runs, so a second build fails
+// with ErrJobRunning however it's started.
+func ExecuteBuild(ctx context.Context, wfClient temporalClient.Client, options temporalClient.StartWorkflowOptions, jobName string, pipeline *Pipeline, properties map[string]interface{}) (temporalClient.WorkflowRun, error) {
+	if !pipeline.Options.DisableConcurrentBuilds() {
+		return wfClient.ExecuteWorkflow(ctx, options, GroovyDSLWorkflow, *pipeline, properties)
+	}
+
+	lockOptions := options
+	lockOptions.ID = lockPrefix + jobName
+	lockOptions.WorkflowIDConflictPolicy = enums.WORKFLOW_ID_CONFLICT_POLICY_FAIL
+	lockOptions.WorkflowIDReusePolicy = enums.WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE
+	lockOptions.WorkflowExecutionErrorWhenAlreadyStarted = true
+	run, err := wfClient.ExecuteWorkflow(ctx, lockOptions, JobLockWorkflow, options.ID, *pipeline, properties)
+	if temporal.IsWorkflowExecutionAlreadyStartedError(err) {
+		return nil, ErrJobRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lockedRun{WorkflowRun: run, id: options.ID}, nil
+}
+
+// JobLockWorkflow holds the lock of a job with disableConcurrentBuilds() while its build runs as a child, see ExecuteBuild
+func JobLockWorkflow(ctx workflow.Context, workflowId string, pipeline Pipeline, properties map[string]interface{}) (map[string]any, error) {
+	ctx = workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{WorkflowID: workflowId})
+	var results map[string]any
+	err := workflow.ExecuteChildWorkflow(ctx, GroovyDSLWorkflow, pipeline, properties).Get(ctx, &results)
+	return results, err
+}
+
+func (run *lockedRun) GetID() string {
+	return run.id
+}
+
+// GetRunID is empty, the run of the build isn't known until JobLockWorkflow starts it
+func (run *lockedRun) GetRunID() string {
+	return ""
+}
@@ -0,0 +1,74 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/api/serviceerror"
+	temporalClient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/mocks"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestExecuteBuild(t *testing.T) {
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(`pipeline { agent none options { disableConcurrentBuilds() } stages { stage('Deploy') { steps { echo 'deploy' } } } }`)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+	options := temporalClient.StartWorkflowOptions{ID: "/jobs/deploy/2", TaskQueue: DefaultTaskQueue}
+	properties := map[string]interface{}{"jobName": "/jobs/deploy"}
+
+	wfClient := &mocks.Client{}
+	run := &mocks.WorkflowRun{}
+	lockOptions := mock.MatchedBy(func(options temporalClient.StartWorkflowOptions) bool {
+		return options.ID == "lock:/jobs/deploy" && options.WorkflowExecutionErrorWhenAlreadyStarted
+	})
+	wfClient.On("ExecuteWorkflow", mock.Anything, lockOptions, mock.Anything, "/jobs/deploy/2", *pipeline, properties).Return(run, nil).Once()
+	started, err := ExecuteBuild(context.Background(), wfClient, options, "/jobs/deploy", pipeline, properties)
+	if err != nil {
+		t.Fatalf("Failed to start the build: %v", err)
+	}
+	if started.GetID() != "/jobs/deploy/2" {
+		t.Errorf("Expected the id of the build, got %s", started.GetID())
+	}
+
+	// the lock of the job is held by the build started above
+	wfClient.On("ExecuteWorkflow", mock.Anything, lockOptions, mock.Anything, "/jobs/deploy/3", *pipeline, properties).Return(
+		nil, serviceerror.NewWorkflowExecutionAlreadyStarted("workflow execution already started", "", "run-2")).Once()
+	options.ID = "/jobs/deploy/3"
+	if _, err := ExecuteBuild(context.Background(), wfClient, options, "/jobs/deploy", pipeline, properties); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("Expected ErrJobRunning, got %v", err)
+	}
+	wfClient.AssertExpectations(t)
+}
+
+func TestJobLockWorkflow(t *testing.T) {
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(`pipeline { agent none options { disableConcurrentBuilds() } stages { stage('Deploy') { steps { echo 'deploy' } } } }`)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(GroovyDSLWorkflow)
+
+	var buildId string
+	env.OnWorkflow("GroovyDSLWorkflow", mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx workflow.Context, pipeline Pipeline, properties map[string]interface{}) (map[string]any, error) {
+			buildId = workflow.GetInfo(ctx).WorkflowExecution.ID
+			return map[string]any{"Deploy": []string{"deploy"}}, nil
+		})
+
+	env.ExecuteWorkflow(JobLockWorkflow, "/jobs/deploy/2", *pipeline, map[string]interface{}{"jobName": "/jobs/deploy"})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if buildId != "/jobs/deploy/2" {
+		t.Errorf("Expected the build to run as /jobs/deploy/2, got %s", buildId)
+	}
+}
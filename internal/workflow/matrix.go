@@ -0,0 +1,98 @@
+package workflow
+
+import (
+	"slices"
+	"strings"
+
+	"go.temporal.io/sdk/workflow"
+)
+
+type (
+	axisValue struct {
+		name  string
+		value string
+	}
+
+	// cell is one combination of the axis values, in the order of the axes
+	cell []axisValue
+)
+
+// cells returns the combinations of the axis values which aren't excluded
+func (matrix *Matrix) cells() []cell {
+	cells := []cell{{}}
+	for _, axis := range matrix.Axes {
+		var expanded []cell
+		for _, c := range cells {
+			for _, value := range axis.Values {
+				expanded = append(expanded, append(slices.Clone(c), axisValue{axis.Name.Literal(), value.Literal()}))
+			}
+		}
+		cells = expanded
+	}
+
+	return slices.DeleteFunc(cells, func(c cell) bool {
+		return slices.ContainsFunc(matrix.Excludes, func(exclude *Exclude) bool {
+			return exclude.matches(c)
+		})
+	})
+}
+
+func (exclude *Exclude) matches(c cell) bool {
+	for _, axis := range exclude.Axes {
+		value, ok := c.value(axis.Name.Literal())
+		if !ok {
+			return false
+		}
+		if axis.Values != nil && !slices.Contains(literals(axis.Values), value) {
+			return false
+		}
+		if axis.NotValues != nil && slices.Contains(literals(axis.NotValues), value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c cell) value(name string) (string, bool) {
+	for _, axis := range c {
+		if axis.name == name {
+			return axis.value, true
+		}
+	}
+	return "", false
+}
+
+// String returns the key of the cell in the results, e.g. PLATFORM=linux,JDK=17
+func (c cell) String() string {
+	pairs := make([]string, len(c))
+	for i, axis := range c {
+		pairs[i] = axis.name + "=" + axis.value
+	}
+	return strings.Join(pairs, ",")
+}
+
+// execute runs the stages of every cell as a parallel branch with the axis values as environment variables
+func (matrix *Matrix) execute(ctx workflow.Context, variables map[string]string, results map[string]any) error {
+	var branches Parallel
+	for _, c := range matrix.cells() {
+		env := make(Environment, len(c))
+		for i, axis := range c {
+			env[i] = &EnvVar{Name: axis.name, Value: QuotedString(escapeTemplate(axis.value))}
+		}
+		branches = append(branches, &Stage{
+			Name:        QuotedString(escapeTemplate(c.String())),
+			Agent:       matrix.Agent,
+			Environment: env,
+			Stages:      matrix.Stages,
+		})
+	}
+	return branches.execute(ctx, variables, results)
+}
+
+func literals(values []QuotedString) []string {
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[i] = value.Literal()
+	}
+	return result
+}
@@ -0,0 +1,102 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestMatrix(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('BuildAndTest') {
+				matrix {
+					axes {
+						axis {
+							name 'PLATFORM'
+							values 'linux', 'windows'
+						}
+						axis {
+							name 'JDK'
+							values '11', '17', '21'
+						}
+					}
+					excludes {
+						exclude {
+							axis {
+								name 'PLATFORM'
+								values 'windows'
+							}
+							axis {
+								name 'JDK'
+								notValues '21'
+							}
+						}
+					}
+					stages {
+						stage('Test') {
+							steps {
+								sh "test on ${PLATFORM} with JDK ${env.JDK}"
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			_, params, err := steps[0].resolve(&scope{env: stageContext.Variables})
+			if err != nil {
+				return nil, err
+			}
+			return []string{params["text"].(string)}, nil
+		})
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	var results map[string]any
+	if err := env.GetWorkflowResult(&results); err != nil {
+		t.Fatalf("Failed to get workflow result: %v", err)
+	}
+	want := map[string]any{
+		"BuildAndTest": map[string]any{
+			"PLATFORM=linux,JDK=11": map[string]any{
+				"Test": []any{"test on linux with JDK 11"},
+			},
+			"PLATFORM=linux,JDK=17": map[string]any{
+				"Test": []any{"test on linux with JDK 17"},
+			},
+			"PLATFORM=linux,JDK=21": map[string]any{
+				"Test": []any{"test on linux with JDK 21"},
+			},
+			"PLATFORM=windows,JDK=21": map[string]any{
+				"Test": []any{"test on windows with JDK 21"},
+			},
+		},
+	}
+	if diff := cmp.Diff(results, want); diff != "" {
+		t.Errorf("Unexpected results (-got +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,91 @@
+package workflow
+
+import (
+	"strings"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// commandErrType is the application error type reported by failed steps
+const commandErrType = "command"
+
+var (
+	defaultActivityOptions = workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 5,
+		// cancellation of aborted builds reaches the activities through heartbeats,
+		// waiting for it lets post actions run once the steps have stopped
+		HeartbeatTimeout:    heartbeatInterval * 6,
+		WaitForCancellation: true,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 3,
+			// failed steps are retried only when asked to with retry(N)
+			NonRetryableErrorTypes: []string{commandErrType},
+		},
+	}
+
+	timeUnits = map[string]time.Duration{
+		"NANOSECONDS":  time.Nanosecond,
+		"MICROSECONDS": time.Microsecond,
+		"MILLISECONDS": time.Millisecond,
+		"SECONDS":      time.Second,
+		"MINUTES":      time.Minute,
+		"HOURS":        time.Hour,
+		"DAYS":         time.Hour * 24,
+	}
+)
+
+// activityOptions applies timeout and retry options on top of the inherited activity options
+func (options Options) activityOptions(ao workflow.ActivityOptions) workflow.ActivityOptions {
+	for _, option := range options {
+		if option.Timeout != nil {
+			ao.StartToCloseTimeout = option.Timeout.duration()
+		}
+		if option.Retry != nil {
+			ao.RetryPolicy = &temporal.RetryPolicy{
+				MaximumAttempts: int32(*option.Retry),
+			}
+		}
+	}
+	return ao
+}
+
+// timeout returns the timeout option, if any
+func (options Options) timeout() (time.Duration, bool) {
+	for _, option := range options {
+		if option.Timeout != nil {
+			return option.Timeout.duration(), true
+		}
+	}
+	return 0, false
+}
+
+// DisableConcurrentBuilds reports whether only one build of the job may run at a time
+func (options Options) DisableConcurrentBuilds() bool {
+	for _, option := range options {
+		if option.DisableConcurrentBuilds {
+			return true
+		}
+	}
+	return false
+}
+
+// SkipDefaultCheckout is kept for compatibility, there's no implicit checkout to skip
+func (options Options) SkipDefaultCheckout() bool {
+	for _, option := range options {
+		if option.SkipDefaultCheckout != nil {
+			return bool(*option.SkipDefaultCheckout)
+		}
+	}
+	return false
+}
+
+// duration converts the timeout into time.Duration. The unit defaults to MINUTES like in Jenkins.
+func (timeout *Timeout) duration() time.Duration {
+	unit, ok := timeUnits[strings.ToUpper(timeout.Unit.Literal())]
+	if !ok {
+		unit = time.Minute
+	}
+	return time.Duration(timeout.Time) * unit
+}
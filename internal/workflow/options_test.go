@@ -0,0 +1,60 @@
+package workflow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOptionsActivityOptions(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		options {
+			timeout(time: 1, unit: 'HOURS')
+			disableConcurrentBuilds()
+			skipDefaultCheckout()
+		}
+		stages {
+			stage('Integration Test') {
+				options {
+					timeout(time: 90)
+					retry(2)
+				}
+				steps {
+					sh 'make integration-test'
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	if !pipeline.Options.DisableConcurrentBuilds() {
+		t.Errorf("Expected concurrent builds to be disabled")
+	}
+	if !pipeline.Options.SkipDefaultCheckout() {
+		t.Errorf("Expected default checkout to be skipped")
+	}
+
+	pipelineOptions := pipeline.Options.activityOptions(defaultActivityOptions)
+	if pipelineOptions.StartToCloseTimeout != time.Hour {
+		t.Errorf("Expected pipeline timeout 1h, got %v", pipelineOptions.StartToCloseTimeout)
+	}
+	if pipelineOptions.RetryPolicy != defaultActivityOptions.RetryPolicy {
+		t.Errorf("Expected default retry policy to be inherited")
+	}
+
+	stageOptions := pipeline.Stages[0].Options.activityOptions(pipelineOptions)
+	if stageOptions.StartToCloseTimeout != time.Minute*90 {
+		t.Errorf("Expected stage timeout 90m, got %v", stageOptions.StartToCloseTimeout)
+	}
+	if stageOptions.RetryPolicy.MaximumAttempts != 2 || len(stageOptions.RetryPolicy.NonRetryableErrorTypes) != 0 {
+		t.Errorf("Expected failed steps to be retried twice, got %+v", stageOptions.RetryPolicy)
+	}
+}
@@ -0,0 +1,191 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yegor86/tumbler-doll/internal/cryptography"
+)
+
+// arg returns the value of the named parameter argument, or nil if absent
+func (param *Parameter) arg(key string) *Value {
+	for _, arg := range param.Args {
+		if arg.Key == key {
+			return arg.Value
+		}
+	}
+	return nil
+}
+
+// Name returns the parameter name
+func (param *Parameter) Name() string {
+	if name := param.arg("name"); name != nil && name.String != nil {
+		return name.String.Literal()
+	}
+	return ""
+}
+
+// DefaultValue returns the declared default value. Choices default to the first choice.
+func (param *Parameter) DefaultValue() any {
+	if param.Type == "choice" {
+		choices := param.choices()
+		if len(choices) == 0 {
+			return ""
+		}
+		return choices[0]
+	}
+	defaultValue := param.arg("defaultValue")
+	if param.Type == "booleanParam" {
+		return defaultValue != nil && defaultValue.Bool != nil && bool(*defaultValue.Bool)
+	}
+	if defaultValue != nil && defaultValue.String != nil {
+		return defaultValue.String.Literal()
+	}
+	return ""
+}
+
+// choices returns the declared choices, either a list or a string with one choice per line, e.g. 'One\nTwo'
+func (param *Parameter) choices() []string {
+	var choices []string
+	value := param.arg("choices")
+	if value == nil {
+		return choices
+	}
+	if value.String != nil {
+		lines := strings.Split(strings.ReplaceAll(string(*value.String), `\n`, "\n"), "\n")
+		for _, line := range lines {
+			if choice := QuotedString(strings.TrimSuffix(line, "\r")).Literal(); choice != "" {
+				choices = append(choices, choice)
+			}
+		}
+		return choices
+	}
+	for _, choice := range value.List {
+		choices = append(choices, choice.Literal())
+	}
+	return choices
+}
+
+// convert checks the submitted value against the parameter type
+func (param *Parameter) convert(value any) (any, error) {
+	switch param.Type {
+	case "booleanParam":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("parameter %s must be a boolean, got %v", param.Name(), value)
+	case "choice":
+		v, ok := value.(string)
+		if !ok || !slices.Contains(param.choices(), v) {
+			return nil, fmt.Errorf("parameter %s must be one of %v, got %v", param.Name(), param.choices(), value)
+		}
+		return v, nil
+	default:
+		v, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("parameter %s must be a string, got %v", param.Name(), value)
+		}
+		return v, nil
+	}
+}
+
+// Resolve validates the submitted values against the declared parameters and fills in the defaults
+func (params Parameters) Resolve(values map[string]any) (map[string]any, error) {
+	resolved := make(map[string]any, len(params))
+	for _, param := range params {
+		resolved[param.Name()] = param.DefaultValue()
+	}
+
+	for name, value := range values {
+		idx := slices.IndexFunc(params, func(param *Parameter) bool {
+			return param.Name() == name
+		})
+		if idx < 0 {
+			return nil, fmt.Errorf("unknown parameter %s", name)
+		}
+		converted, err := params[idx].convert(value)
+		if err != nil {
+			return nil, err
+		}
+		resolved[name] = converted
+	}
+	return resolved, nil
+}
+
+// StorePasswords returns a copy of the resolved values with the values of the password parameters kept as secrets
+// and replaced by the secret ids, the passwords don't reach the workflow history that way. The stages bind them back.
+func (params Parameters) StorePasswords(values map[string]any) (map[string]any, error) {
+	stored := make(map[string]any, len(values))
+	for name, value := range values {
+		stored[name] = value
+	}
+	for _, param := range params {
+		value, _ := stored[param.Name()].(string)
+		if param.Type != "password" || value == "" {
+			continue
+		}
+		id, err := cryptography.GetInstance().StoreSecret(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store parameter %s: %w", param.Name(), err)
+		}
+		stored[param.Name()] = id
+	}
+	return stored, nil
+}
+
+// DeletePasswords deletes the secrets of the password parameters stored by StorePasswords
+func (params Parameters) DeletePasswords(stored map[string]any) error {
+	_, ids := params.passwords(stored)
+	var errs []error
+	for name, id := range ids {
+		if err := cryptography.GetInstance().DeleteSecret(id); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete parameter %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PasswordNames lists the names of the password parameters
+func (params Parameters) PasswordNames() []string {
+	var names []string
+	for _, param := range params {
+		if param.Type == "password" {
+			names = append(names, param.Name())
+		}
+	}
+	return names
+}
+
+// passwords splits the secret ids of the password parameters off the values stored by StorePasswords,
+// the password parameters are left blank
+func (params Parameters) passwords(values map[string]any) (map[string]any, map[string]string) {
+	masked := make(map[string]any, len(values))
+	for name, value := range values {
+		masked[name] = value
+	}
+	ids := make(map[string]string)
+	for _, param := range params {
+		if id, _ := masked[param.Name()].(string); param.Type == "password" && id != "" {
+			ids[param.Name()] = id
+			masked[param.Name()] = ""
+		}
+	}
+	return masked, ids
+}
+
+// toEnv exposes the parameter values as environment variables
+func toEnv(params map[string]any) map[string]string {
+	env := make(map[string]string, len(params))
+	for name, value := range params {
+		env[name] = fmt.Sprint(value)
+	}
+	return env
+}
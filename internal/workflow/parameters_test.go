@@ -0,0 +1,149 @@
+package workflow
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yegor86/tumbler-doll/internal/cryptography"
+)
+
+func TestParametersResolve(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		parameters {
+			string(name: 'PERSON', defaultValue: 'Mr Jenkins', description: 'Who should I say hello to?')
+			booleanParam(name: 'TOGGLE', defaultValue: true, description: 'Toggle this value')
+			choice(name: 'CHOICE', choices: ['One', 'Two', 'Three'], description: 'Pick something')
+			password(name: 'PASSWORD', defaultValue: 'SECRET', description: 'Enter a password')
+		}
+		stages {
+			stage('Example') {
+				steps {
+					echo 'Hello'
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	params, err := pipeline.Parameters.Resolve(nil)
+	if err != nil {
+		t.Fatalf("Failed to resolve default parameters: %v", err)
+	}
+	want := map[string]any{
+		"PERSON":   "Mr Jenkins",
+		"TOGGLE":   true,
+		"CHOICE":   "One",
+		"PASSWORD": "SECRET",
+	}
+	if diff := cmp.Diff(params, want); diff != "" {
+		t.Errorf("Default parameters are not equal (-got +want):\n%s", diff)
+	}
+
+	params, err = pipeline.Parameters.Resolve(map[string]any{
+		"TOGGLE": "false",
+		"CHOICE": "Three",
+	})
+	if err != nil {
+		t.Fatalf("Failed to resolve parameters: %v", err)
+	}
+	if params["TOGGLE"] != false || params["CHOICE"] != "Three" || params["PERSON"] != "Mr Jenkins" {
+		t.Errorf("Unexpected parameters %v", params)
+	}
+
+	invalid := []map[string]any{
+		{"UNKNOWN": "value"},
+		{"TOGGLE": "maybe"},
+		{"CHOICE": "Four"},
+		{"PERSON": 42.0},
+	}
+	for _, values := range invalid {
+		if _, err := pipeline.Parameters.Resolve(values); err == nil {
+			t.Errorf("Expected %v to be rejected", values)
+		}
+	}
+}
+
+func TestChoicesAsString(t *testing.T) {
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(`pipeline { agent none parameters { choice(name: 'ENV', choices: 'dev\nstaging\nprod', description: 'Target') } stages { stage('Example') { steps { echo 'Hello' } } } }`)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	params, err := pipeline.Parameters.Resolve(map[string]any{"ENV": "staging"})
+	if err != nil {
+		t.Fatalf("Failed to resolve parameters: %v", err)
+	}
+	if diff := cmp.Diff(params, map[string]any{"ENV": "staging"}); diff != "" {
+		t.Errorf("Parameters are not equal (-got +want):\n%s", diff)
+	}
+	if params, _ = pipeline.Parameters.Resolve(nil); params["ENV"] != "dev" {
+		t.Errorf("Expected the first choice by default, got %v", params["ENV"])
+	}
+}
+
+func TestPasswordsAreStoredAsSecrets(t *testing.T) {
+	t.Setenv("JENKINS_HOME", t.TempDir())
+	// there are no credentials.xml, the keys are seeded anyway
+	_ = cryptography.GetInstance().LoadOrSeedCrypto()
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(`pipeline { agent none parameters { string(name: 'USER', defaultValue: 'admin') password(name: 'TOKEN', defaultValue: '') } stages { stage('Example') { steps { echo 'Hello' } } } }`)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+	params, err := pipeline.Parameters.Resolve(map[string]any{"TOKEN": "s3cr3t"})
+	if err != nil {
+		t.Fatalf("Failed to resolve parameters: %v", err)
+	}
+
+	stored, err := pipeline.Parameters.StorePasswords(params)
+	if err != nil {
+		t.Fatalf("Failed to store passwords: %v", err)
+	}
+	if stored["USER"] != "admin" || stored["TOKEN"] == "s3cr3t" || params["TOKEN"] != "s3cr3t" {
+		t.Errorf("Expected a copy with the password replaced by a secret id, got %v", stored)
+	}
+
+	masked, passwords := pipeline.Parameters.passwords(stored)
+	if diff := cmp.Diff(masked, map[string]any{"USER": "admin", "TOKEN": ""}); diff != "" {
+		t.Errorf("Parameters are not masked (-got +want):\n%s", diff)
+	}
+
+	// the stages get the values encrypted
+	encrypted, err := (&ControllerActivities{}).ReadSecretsActivity(context.Background(), passwords)
+	if err != nil || encrypted["TOKEN"] == "s3cr3t" {
+		t.Fatalf("Expected the password to be read encrypted, got %v (%v)", encrypted, err)
+	}
+	variables := toEnv(masked)
+	bound, err := bindPasswords(variables, masked, encrypted)
+	if err != nil {
+		t.Fatalf("Failed to bind passwords: %v", err)
+	}
+	if bound["TOKEN"] != "s3cr3t" || variables["TOKEN"] != "s3cr3t" || masked["TOKEN"] != "" {
+		t.Errorf("Expected the password to be bound, got params %v and variables %v", bound, variables)
+	}
+
+	if _, err := bindPasswords(variables, masked, map[string]string{"TOKEN": "garbage"}); err == nil || !strings.Contains(err.Error(), "TOKEN") {
+		t.Errorf("Expected an error binding a value which isn't encrypted, got %v", err)
+	}
+
+	if err := pipeline.Parameters.DeletePasswords(stored); err != nil {
+		t.Fatalf("Failed to delete passwords: %v", err)
+	}
+	if _, err := (&ControllerActivities{}).ReadSecretsActivity(context.Background(), passwords); err == nil || !strings.Contains(err.Error(), "TOKEN") {
+		t.Errorf("Expected the deleted secret to be gone, got %v", err)
+	}
+}
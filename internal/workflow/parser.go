@@ -2,7 +2,6 @@ package workflow
 
 import (
 	"log"
-	"strings"
 
 	"github.com/alecthomas/participle/v2"
 	"github.com/alecthomas/participle/v2/lexer"
@@ -14,39 +13,318 @@ type (
 
 	// Pipeline represents the main Jenkins pipeline structure
 	Pipeline struct {
-		Agent  *Agent   `"pipeline" "{" "agent" @@`
-		Stages []*Stage `"stages" "{" @@+ "}"`
-		Close  string   `"}"`
+		Agent       *Agent      `"pipeline" "{" "agent" @@`
+		Environment Environment `( "environment" "{" @@* "}" )?`
+		Options     Options     `( "options" "{" @@* "}" )?`
+		Parameters  Parameters  `( "parameters" "{" @@* "}" )?`
+		Triggers    Triggers    `( "triggers" "{" @@* "}" )?`
+		Stages      []*Stage    `"stages" "{" @@+ "}"`
+		Post        *Post       `( @@ )?`
+		Close       string      `"}"`
 	}
 
 	// Agent represents the agent block in a Jenkinsfile
 	Agent struct {
-		None   bool    `( "none" )?`
-		Docker *Docker `( "{" "docker" @@ "}" )?`
+		Pos lexer.Position
+
+		// Any runs the stage on any node, like no agent at all
+		Any        bool        `( @"any" )?`
+		None       bool        `( "none" )?`
+		Docker     *Docker     `( "{" ( "docker" @@`
+		Dockerfile *Dockerfile `| "dockerfile" @@`
+		// Label is a label expression, e.g. linux && docker, the stage runs on a node matching it
+		Label *QuotedString `| "label" @String ) "}" )?`
 	}
 
+	// Docker runs the stage in a container of the image, docker 'maven' or docker { image 'maven' ... }
 	Docker struct {
-		Image QuotedString `@String`
+		Image QuotedString `( @String | "{" ( "image" @String`
+		// Args are given to docker run, e.g. -v /cache:/cache --network host
+		Args                  QuotedString `| "args" @String`
+		RegistryUrl           QuotedString `| "registryUrl" @String`
+		RegistryCredentialsId QuotedString `| "registryCredentialsId" @String`
+		// ReuseNode keeps the container for the next stages of the build with the same agent
+		ReuseNode  Boolean      `| "reuseNode" @Bool`
+		AlwaysPull Boolean      `| "alwaysPull" @Bool`
+		// Engine is the container engine, docker, podman or containerd, the one of the node by default
+		Engine QuotedString `| "engine" @String`
+		Label  QuotedString `| "label" @String )* "}" )`
+	}
+
+	// Dockerfile builds the image the stage runs in, dockerfile true builds the Dockerfile of the workspace
+	Dockerfile struct {
+		Default  Boolean      `( @Bool`
+		Filename QuotedString `| "{" ( "filename" @String`
+		// Dir is the build context, relative to the workspace
+		Dir                 QuotedString `| "dir" @String`
+		AdditionalBuildArgs QuotedString `| "additionalBuildArgs" @String`
+		Label               QuotedString `| "label" @String )* "}" )`
+	}
+
+	// Environment represents the environment block of a pipeline or a stage
+	Environment []*EnvVar
+
+	// EnvVar represents NAME = 'value' or NAME = credentials('credentials-id')
+	EnvVar struct {
+		Name        string        `@Ident "="`
+		Credentials *QuotedString `( "credentials" "(" @String ")"`
+		Value       QuotedString  `| @String )`
 	}
 
 	Parallel []*Stage
 
 	// Stage represents a stage block within stages
 	Stage struct {
-		Name     QuotedString `"stage" "(" @String ")" "{"`
-		Agent    *Agent       `( "agent" @@ )?`
-		Steps    []*Step      `( "steps" "{" @@+ "}" )?`
-		FailFast *bool        `( "failFast" @Bool )?`
-		Parallel Parallel     `( "parallel" "{" @@+ "}" )?`
-		Close    string       `"}"`
+		Pos         lexer.Position
+		Name        QuotedString `"stage" "(" @String ")" "{"`
+		Agent       *Agent       `( "agent" @@ )?`
+		Environment Environment  `( "environment" "{" @@* "}" )?`
+		Options     Options      `( "options" "{" @@* "}" )?`
+		When        *When        `( @@ )?`
+		Input       *Input       `( @@ )?`
+		Steps       []*Step      `( "steps" "{" @@+ "}" )?`
+		FailFast    *bool        `( "failFast" @Bool )?`
+		Parallel    Parallel     `( "parallel" "{" @@+ "}" )?`
+		Stages      []*Stage     `( "stages" "{" @@+ "}" )?`
+		Matrix      *Matrix      `( @@ )?`
+		Post        *Post        `( @@ )?`
+		Close       string       `"}"`
+	}
+
+	// Input represents the input directive of a stage, the stage waits for approval before it runs
+	Input struct {
+		Message    QuotedString  `"input" "{" ( "message" @String`
+		Id         *QuotedString `| "id" @String`
+		Ok         *QuotedString `| "ok" @String`
+		Submitter  *QuotedString `| "submitter" @String`
+		Parameters Parameters    `| "parameters" "{" @@* "}" )* "}"`
+	}
+
+	// Matrix represents a matrix block: the stages run once per combination of the axis values
+	Matrix struct {
+		Axes     []*Axis    `"matrix" "{" "axes" "{" @@+ "}"`
+		Excludes []*Exclude `( "excludes" "{" @@+ "}" )?`
+		Agent    *Agent     `( "agent" @@ )?`
+		Stages   []*Stage   `"stages" "{" @@+ "}" "}"`
+	}
+
+	// Axis represents axis { name 'PLATFORM'; values 'linux', 'windows' }
+	Axis struct {
+		Name   QuotedString   `"axis" "{" "name" @String`
+		Values []QuotedString `"values" @String ( "," @String )* "}"`
+	}
+
+	// Exclude skips the combinations which match all of its axes
+	Exclude struct {
+		Axes []*ExcludeAxis `"exclude" "{" @@+ "}"`
+	}
+
+	ExcludeAxis struct {
+		Name      QuotedString   `"axis" "{" "name" @String`
+		Values    []QuotedString `( "values" @String ( "," @String )*`
+		NotValues []QuotedString `| "notValues" @String ( "," @String )* ) "}"`
+	}
+
+	// Options represents the options block of a pipeline or a stage
+	Options []*Option
+
+	Option struct {
+		Timeout                 *Timeout `  "timeout" "(" @@ ")"`
+		Retry                   *int     `| "retry" "(" @Int ")"`
+		SkipDefaultCheckout     *Boolean `| "skipDefaultCheckout" "(" ( @Bool ")" | @")" )`
+		DisableConcurrentBuilds bool     `| @"disableConcurrentBuilds" "(" ")"`
+	}
+
+	Timeout struct {
+		Time int          `"time" ":" @Int`
+		Unit QuotedString `( "," "unit" ":" @String )?`
+	}
+
+	// Triggers represents the triggers block of a pipeline
+	Triggers []*Trigger
+
+	// Trigger starts builds of the job on a schedule, when the SCM changes or when an upstream job completes
+	Trigger struct {
+		Cron     *QuotedString `  "cron" "(" @String ")"`
+		PollSCM  *QuotedString `| "pollSCM" "(" @String ")"`
+		Upstream *Upstream     `| "upstream" "(" @@ ")"`
+	}
+
+	// Upstream represents upstream(upstreamProjects: 'job1,job2', threshold: hudson.model.Result.SUCCESS)
+	Upstream struct {
+		Projects  QuotedString `"upstreamProjects" ":" @String`
+		Threshold string       `( "," "threshold" ":" ( "hudson" "." "model" "." "Result" "." )? @( "SUCCESS" | "UNSTABLE" | "FAILURE" ) )?`
+	}
+
+	// Parameters represents the parameters block of a pipeline
+	Parameters []*Parameter
+
+	// Parameter represents a build parameter, e.g. string(name: 'PERSON', defaultValue: 'Mr Jenkins')
+	Parameter struct {
+		Type string           `@( "string" | "text" | "booleanParam" | "choice" | "password" ) "("`
+		Args []*ParameterArg  `@@ ( "," @@ )* ")"`
+	}
+
+	ParameterArg struct {
+		Key   string `@Ident ":"`
+		Value *Value `@@`
+	}
+
+	// Value represents a literal argument value: a string, a boolean, a number or a list of strings
+	Value struct {
+		String *QuotedString  `  @String`
+		Bool   *Boolean       `| @Bool`
+		Int    *int           `| @Int`
+		List   []QuotedString `| "[" ( @String ( "," @String )* )? "]"`
+	}
+
+	// When represents the when directive of a stage. The stage runs only if all conditions hold.
+	When struct {
+		BeforeAgent *Boolean     `"when" "{" ( "beforeAgent" @Bool )?`
+		Conditions  []*Condition `@@+ "}"`
+	}
+
+	Condition struct {
+		Branch      *QuotedString         `  "branch" @String`
+		Environment *EnvironmentCondition `| "environment" @@`
+		Expression  *Expression           `| "expression" "{" @@ "}"`
+		Not         *Condition            `| "not" "{" @@ "}"`
+		AllOf       []*Condition          `| "allOf" "{" @@+ "}"`
+		AnyOf       []*Condition          `| "anyOf" "{" @@+ "}"`
+	}
+
+	EnvironmentCondition struct {
+		Name  QuotedString `"name" ":" @String ","`
+		Value QuotedString `"value" ":" @String`
+	}
+
+	// Expression represents a Groovy expression, e.g. return env.DEPLOY == 'true' && !params.DRY_RUN
+	Expression struct {
+		Or []*AndExpression `"return"? @@ ( "||" @@ )*`
+	}
+
+	AndExpression struct {
+		And []*UnaryExpression `@@ ( "&&" @@ )*`
+	}
+
+	UnaryExpression struct {
+		Not        *UnaryExpression `  "!" @@`
+		Comparison *Comparison      `| @@`
+	}
+
+	Comparison struct {
+		Left     *Sum   `@@`
+		Operator string `( @( "==" | "!=" | "<=" | ">=" | "<" | ">" )`
+		Right    *Sum   `  @@ )?`
+	}
+
+	// Sum represents string concatenation or addition of numbers
+	Sum struct {
+		Terms []*Operand `@@ ( "+" @@ )*`
+	}
+
+	Operand struct {
+		Sub       *Expression   `  "(" @@ ")"`
+		Bool      *Boolean      `| @Bool`
+		Int       *int          `| @Int`
+		String    *QuotedString `| @String`
+		List      *List         `| @@`
+		Reference *Reference    `| @@`
+	}
+
+	List struct {
+		Open  string        `@"["`
+		Items []*Expression `( @@ ( "," @@ )* )? "]"`
+	}
+
+	// Reference represents a variable, e.g. env.BRANCH_NAME, or a method call on it, e.g. targets.size()
+	Reference struct {
+		Path []string    `@Ident ( "." @Ident )*`
+		Call *MethodCall `( @@ )?`
+	}
+
+	MethodCall struct {
+		Open string        `@"("`
+		Args []*Expression `( @@ ( "," @@ )* )? ")"`
+	}
+
+	// Script represents a script block with a sandboxed subset of Groovy
+	Script struct {
+		Statements []*Statement `"{" @@* "}"`
+	}
+
+	Statement struct {
+		Def    *Assignment `  "def" @@`
+		If     *If         `| @@`
+		For    *For        `| @@`
+		Assign *Assignment `| @@`
+		Call   *Call       `| @@`
+	}
+
+	// Assignment represents def x = ..., x = ... or env.X = ...
+	Assignment struct {
+		Target []string    `@Ident ( "." @Ident )? "="`
+		Value  *Expression `@@`
+	}
+
+	If struct {
+		Condition *Expression  `"if" "(" @@ ")"`
+		Then      []*Statement `"{" @@* "}"`
+		Else      *Else        `( "else" @@ )?`
+	}
+
+	Else struct {
+		If         *If          `  @@`
+		Statements []*Statement `| "{" @@* "}"`
+	}
+
+	// For represents a loop over a list, e.g. for (target in ['linux', 'darwin']) { ... }
+	For struct {
+		Variable string       `"for" "(" "def"? @Ident "in"`
+		Iterable *Expression  `@@ ")"`
+		Body     []*Statement `"{" @@* "}"`
+	}
+
+	// Call represents a step invocation, e.g. sh "make ${target}" or git(url: repo, branch: 'main')
+	Call struct {
+		Pos     lexer.Position
+		Command string     `@Ident`
+		Args    []*CallArg `( "(" ( @@ ( "," @@ )* )? ")" | @@ ( "," @@ )* )`
+	}
+
+	CallArg struct {
+		Key   string      `( @Ident ":" )?`
+		Value *Expression `@@`
+	}
+
+	// Post represents the post block of a pipeline or a stage
+	Post struct {
+		Conditions []*PostCondition `"post" "{" @@+ "}"`
+	}
+
+	// PostCondition represents a post condition block, e.g. always { ... }
+	PostCondition struct {
+		Condition string  `@( "always" | "success" | "failure" | "unstable" | "unsuccessful" | "aborted" | "cleanup" )`
+		Steps     []*Step `"{" @@+ "}"`
 	}
 
 	// Step represents individual steps within a stage
 	Step struct {
+		Pos      lexer.Position
+		Script   *Script          `"script" @@ |`
+		Build    *BuildStep       `"build" @@ |`
 		SingleKV *SingleKVCommand `@@ |`
 		MultiKV  *MultiKVCommand  `@@`
 	}
 
+	// BuildStep represents build job: 'folder/other', parameters: [string(name: 'TARGET', value: 'prod')], wait: true, propagate: true
+	BuildStep struct {
+		Job        QuotedString `( "job" ":" )? @String`
+		Parameters Parameters   `( "," ( "parameters" ":" "[" ( @@ ( "," @@ )* )? "]"`
+		Wait       *Boolean     `| "wait" ":" @Bool`
+		Propagate  *Boolean     `| "propagate" ":" @Bool ) )*`
+	}
+
 	SingleKVCommand struct {
 		Command string       `@Ident`
 		Value   QuotedString `@String`
@@ -63,36 +341,55 @@ type (
 	}
 )
 
+// QuotedString holds a Groovy string as a template: double-quoted strings keep ${...} and $name
+// placeholders for interpolation, while '$' and '\' in single-quoted strings are escaped with '\'.
 type QuotedString string
 
+// Boolean captures true/false literals, unlike bool which is set on any match
+type Boolean bool
+
 // Define the lexer rules for Jenkinsfile syntax
 var lexerRules = lexer.MustSimple([]lexer.SimpleRule{
-	{Name: "Keyword", Pattern: `\b(pipeline|agent|docker|stages|stage|steps|none|failFast)\b`},
-	{Name: "String", Pattern: `'([^']*)'|"([^"]*)"`},
-	{Name: "Bool", Pattern: `true|false`},
+	{Name: "Keyword", Pattern: `\b(pipeline|agent|docker|stages|stage|steps|none|failFast|environment|post|when|options|parameters|triggers)\b`},
+	{Name: "String", Pattern: `'''(\\.|[^\\])*?'''|"""(\\.|[^\\])*?"""|'(\\.|[^'\\])*'|"(\\.|[^"\\])*"`},
+	{Name: "Bool", Pattern: `\b(true|false)\b`},
+	{Name: "Int", Pattern: `\d+`},
 	{Name: "Ident", Pattern: `[a-zA-Z_][a-zA-Z0-9_]*`},
-	{Name: "Punctuation", Pattern: `[{}()]`},
+	{Name: "Operator", Pattern: `==|!=|<=|>=|&&|\|\||[!<>+.]`},
+	{Name: "Punctuation", Pattern: `[{}()=\[\]]`},
 	{Name: "whitespace", Pattern: `\s+`},
 	{Name: "comment", Pattern: `\/\/[^\n]*`},
+	{Name: "semicolon", Pattern: `;`},
 	{Name: "Colon", Pattern: `:`},
 	{Name: "Comma", Pattern: `,`},
 })
 
-// Capture method strips quotes from the Image field
+// Capture method strips quotes and turns the string into a template
 func (o *QuotedString) Capture(values []string) error {
-	*o = QuotedString(strings.Trim(values[0], `"'`))
+	*o = QuotedString(toTemplate(values[0]))
 	return nil
 }
 
-func (*DslParser) Parse(dslFile string) (*Pipeline, error) {
+func (o *Boolean) Capture(values []string) error {
+	// skipDefaultCheckout() captures the closing parenthesis and means true
+	*o = Boolean(values[0] != "false")
+	return nil
+}
+
+func (p *DslParser) Parse(dslFile string) (*Pipeline, error) {
+	return p.ParseFile("", dslFile)
+}
+
+// ParseFile parses the script of the named file. Syntax errors are returned as Diagnostics.
+func (*DslParser) ParseFile(fileName string, dslFile string) (*Pipeline, error) {
 	parser := participle.MustBuild[Pipeline](
 		participle.Lexer(lexerRules),
 	)
 
-	pipeline, err := parser.ParseString("", dslFile)
+	pipeline, err := parser.ParseString(fileName, dslFile)
 	if err != nil {
 		log.Printf("Error parsing Groovy DSL: %v\n", err)
-		return nil, err
+		return nil, toDiagnostics(fileName, dslFile, err)
 	}
 	return pipeline, nil
 }
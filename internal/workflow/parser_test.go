@@ -3,10 +3,16 @@ package workflow
 import (
 	"testing"
 
+	"github.com/alecthomas/participle/v2/lexer"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 
+	"github.com/yegor86/tumbler-doll/plugins/docker/shared"
 )
 
+// ignorePositions skips the source positions recorded by the parser
+var ignorePositions = cmpopts.IgnoreTypes(lexer.Position{})
+
 func TestParseSingleStep(t *testing.T) {
 
 	jenkinsfile := `
@@ -47,7 +53,7 @@ func TestParseSingleStep(t *testing.T) {
 		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
 	}
 
-	if diff := cmp.Diff(pipeline, want); diff != "" {
+	if diff := cmp.Diff(pipeline, want, ignorePositions); diff != "" {
 		t.Errorf("Structs are not equal (-got +want):\n%s", diff)
 	}
 }
@@ -118,7 +124,7 @@ func TestParseMultipleSteps(t *testing.T) {
 		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
 	}
 
-	if diff := cmp.Diff(pipeline, want); diff != "" {
+	if diff := cmp.Diff(pipeline, want, ignorePositions); diff != "" {
 		t.Errorf("Structs are not equal (-got +want):\n%s", diff)
 	}
 }
@@ -212,7 +218,314 @@ func TestParseParallelStage(t *testing.T) {
 		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
 	}
 
-	if diff := cmp.Diff(pipeline, want); diff != "" {
+	if diff := cmp.Diff(pipeline, want, ignorePositions); diff != "" {
 		t.Errorf("Structs are not equal (-got +want):\n%s", diff)
 	}
 }
+
+func TestParseAgents(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent any
+		stages {
+			stage('Image') {
+				agent {
+					dockerfile {
+						filename 'ci/Dockerfile'; dir 'build'
+						additionalBuildArgs '--build-arg VERSION=${params.VERSION}'
+						label 'docker'
+					}
+				}
+				steps {
+					sh 'make'
+				}
+			}
+			stage('Default') {
+				agent { dockerfile true }
+				steps {
+					sh 'make'
+				}
+			}
+			stage('Docker') {
+				agent {
+					docker {
+						image 'maven:3.9'
+						args '-v /root/.m2:/root/.m2 -e MAVEN_OPTS=-Xmx1g'
+						registryUrl 'https://registry.example.com/'
+						registryCredentialsId 'registry'
+						reuseNode true; alwaysPull true
+						engine 'podman'
+						label 'linux'
+					}
+				}
+				steps {
+					sh 'mvn package'
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	if diff := cmp.Diff(pipeline.Agent, &Agent{Any: true}, ignorePositions); diff != "" {
+		t.Errorf("Pipeline agent is not equal (-got +want):\n%s", diff)
+	}
+	want := &Dockerfile{
+		Filename:            "ci/Dockerfile",
+		Dir:                 "build",
+		AdditionalBuildArgs: "--build-arg VERSION=\\${params.VERSION}",
+		Label:               "docker",
+	}
+	if diff := cmp.Diff(pipeline.Stages[0].Agent.Dockerfile, want); diff != "" {
+		t.Errorf("Dockerfile is not equal (-got +want):\n%s", diff)
+	}
+	if diff := cmp.Diff(pipeline.Labels(), []string{"docker", "linux"}); diff != "" {
+		t.Errorf("Labels are not equal (-got +want):\n%s", diff)
+	}
+
+	t.Setenv("WORKSPACE", "/workspace")
+	options, args, err := pipeline.Stages[1].Agent.Dockerfile.buildOptions(&scope{})
+	if err != nil {
+		t.Fatalf("Failed to resolve build options: %v", err)
+	}
+	if diff := cmp.Diff(options, shared.BuildOptions{ContextDir: "/workspace", Dockerfile: "Dockerfile"}); diff != "" {
+		t.Errorf("Build options are not equal (-got +want):\n%s", diff)
+	}
+	if args != "" {
+		t.Errorf("Unexpected build arguments %q", args)
+	}
+
+	docker := pipeline.Stages[2].Agent.Docker
+	if !docker.ReuseNode || !docker.AlwaysPull || docker.RegistryCredentialsId != "registry" || docker.Engine != "podman" {
+		t.Errorf("Unexpected docker agent %+v", docker)
+	}
+	imageName, runOptions, err := docker.resolve(&scope{})
+	if err != nil {
+		t.Fatalf("Failed to resolve docker agent: %v", err)
+	}
+	if imageName != "registry.example.com/maven:3.9" {
+		t.Errorf("Unexpected image %s", imageName)
+	}
+	wantOptions := shared.RunOptions{Binds: []string{"/root/.m2:/root/.m2"}, Env: []string{"MAVEN_OPTS=-Xmx1g"}}
+	if diff := cmp.Diff(runOptions, wantOptions); diff != "" {
+		t.Errorf("Run options are not equal (-got +want):\n%s", diff)
+	}
+}
+
+func TestParseEnvironment(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		environment {
+			CC = 'clang'
+			DEBUG = "false"
+		}
+		stages {
+			stage('Example') {
+				environment {
+					DEBUG = 'true'
+				}
+				steps {
+					sh 'printenv'
+				}
+			}
+		}
+	}
+    `
+
+	want := &Pipeline{
+		Agent: &Agent{
+			Docker: nil,
+		},
+		Environment: Environment{
+			{Name: "CC", Value: "clang"},
+			{Name: "DEBUG", Value: "false"},
+		},
+		Stages: []*Stage{
+			{
+				Name: "Example",
+				Environment: Environment{
+					{Name: "DEBUG", Value: "true"},
+				},
+				Steps: []*Step{
+					{
+						SingleKV: &SingleKVCommand{
+							Command: "sh",
+							Value:   "printenv",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	if diff := cmp.Diff(pipeline, want, ignorePositions); diff != "" {
+		t.Errorf("Structs are not equal (-got +want):\n%s", diff)
+	}
+
+	variables, err := pipeline.Environment.merge(map[string]string{}, nil)
+	if err != nil {
+		t.Fatalf("Failed to merge environment: %v", err)
+	}
+	variables, err = pipeline.Stages[0].Environment.merge(variables, nil)
+	if err != nil {
+		t.Fatalf("Failed to merge environment: %v", err)
+	}
+	if diff := cmp.Diff(variables, map[string]string{"CC": "clang", "DEBUG": "true"}); diff != "" {
+		t.Errorf("Stage environment is not merged (-got +want):\n%s", diff)
+	}
+}
+
+func TestParsePost(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('Test') {
+				steps {
+					sh 'make check'
+				}
+				post {
+					failure {
+						echo 'Tests failed'
+					}
+				}
+			}
+		}
+		post {
+			cleanup {
+				sh 'rm -rf build'
+			}
+			always {
+				echo 'Done'
+			}
+		}
+	}
+    `
+
+	want := &Pipeline{
+		Agent: &Agent{
+			Docker: nil,
+		},
+		Stages: []*Stage{
+			{
+				Name: "Test",
+				Steps: []*Step{
+					{
+						SingleKV: &SingleKVCommand{
+							Command: "sh",
+							Value:   "make check",
+						},
+					},
+				},
+				Post: &Post{
+					Conditions: []*PostCondition{
+						{
+							Condition: "failure",
+							Steps: []*Step{
+								{
+									SingleKV: &SingleKVCommand{
+										Command: "echo",
+										Value:   "Tests failed",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Post: &Post{
+			Conditions: []*PostCondition{
+				{
+					Condition: "cleanup",
+					Steps: []*Step{
+						{
+							SingleKV: &SingleKVCommand{
+								Command: "sh",
+								Value:   "rm -rf build",
+							},
+						},
+					},
+				},
+				{
+					Condition: "always",
+					Steps: []*Step{
+						{
+							SingleKV: &SingleKVCommand{
+								Command: "echo",
+								Value:   "Done",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	if diff := cmp.Diff(pipeline, want, ignorePositions); diff != "" {
+		t.Errorf("Structs are not equal (-got +want):\n%s", diff)
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+
+	tests := []struct {
+		jenkinsfile string
+		want        Diagnostics
+	}{
+		{
+			jenkinsfile: "pipeline {\n agent none\n stages {\n  stage('Build') {\n   stepz { sh 'make' }\n  }\n }\n}",
+			want: Diagnostics{{
+				File:     "Jenkinsfile",
+				Line:     5,
+				Column:   4,
+				Token:    "stepz",
+				Expected: `"}"`,
+				Message:  `unexpected token "stepz" (expected "}")`,
+			}},
+		},
+		{
+			jenkinsfile: "pipeline {\n agent none\n stages {\n  stage('Build') {\n   steps { sh 'make }\n  }\n }\n}",
+			want: Diagnostics{{
+				File:    "Jenkinsfile",
+				Line:    5,
+				Column:  15,
+				Token:   "'make }",
+				Message: "unterminated string",
+			}},
+		},
+	}
+
+	dslParser := DslParser{}
+	for _, test := range tests {
+		_, err := dslParser.ParseFile("Jenkinsfile", test.jenkinsfile)
+		diagnostics, ok := err.(Diagnostics)
+		if !ok {
+			t.Fatalf("Expected diagnostics, got %v", err)
+		}
+		if diff := cmp.Diff(diagnostics, test.want); diff != "" {
+			t.Errorf("Diagnostics are not equal (-got +want):\n%s", diff)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package workflow
+
+import (
+	"go.temporal.io/sdk/workflow"
+)
+
+// postConditionOrder is the order in which Jenkins evaluates post conditions regardless of their order in the file
+var postConditionOrder = []string{"always", "aborted", "unstable", "failure", "success", "unsuccessful", "cleanup"}
+
+func (post *Post) execute(ctx workflow.Context, name string, agent *Agent, result Result, variables map[string]string, results map[string]any) error {
+	logger := workflow.GetLogger(ctx)
+
+	// the results are added to the ones already kept under the same name rather than replacing them
+	postResults, ok := results[name].(map[string]any)
+	if !ok {
+		postResults = make(map[string]any)
+	}
+	var postErr error
+	for _, condition := range postConditionOrder {
+		for _, postCondition := range post.Conditions {
+			if postCondition.Condition != condition || !postCondition.matches(result) {
+				continue
+			}
+			// a failed post condition doesn't prevent the remaining ones, e.g. cleanup, from running
+			output, err := executeSteps(ctx, postCondition.Steps, agent, variables)
+			// a condition can be given more than once
+			previous, _ := postResults[condition].([]string)
+			postResults[condition] = append(previous, output...)
+			if resultOf(err).stops() {
+				logger.Error("Post condition failed", "name", name, "condition", condition, "error", err)
+				if postErr == nil {
+					postErr = err
+				}
+			}
+		}
+	}
+	results[name] = postResults
+	return postErr
+}
+
+// matches reports whether the post condition has to run for the given result
+func (postCondition *PostCondition) matches(result Result) bool {
+	switch postCondition.Condition {
+	case "always", "cleanup":
+		return true
+	case "success":
+		return result == Success
+	case "unstable":
+		return result == Unstable
+	case "failure":
+		return result == Failure
+	case "aborted":
+		return result == Aborted
+	case "unsuccessful":
+		return result != Success
+	}
+	return false
+}
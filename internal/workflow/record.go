@@ -0,0 +1,137 @@
+package workflow
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+)
+
+// recordBuild keeps the record of a finished job build in the job directory, it outlives the workflow history
+func recordBuild(ctx workflow.Context, pipeline *Pipeline, state *BuildState, properties map[string]interface{}, results map[string]any, result Result) {
+	jobName, _ := properties["jobName"].(string)
+	number, err := strconv.Atoi(toString(properties["buildNumber"]))
+	if jobName == "" || err != nil {
+		// uploaded scripts aren't numbered
+		return
+	}
+
+	params, _ := properties["params"].(map[string]any)
+	record := jobs.BuildRecord{
+		Number:     number,
+		Result:     string(result),
+		Causes:     causesOf(properties),
+		Parameters: parameterValues(pipeline.Parameters, params),
+		Stages:     stageRecords(state.Stages, results),
+		Downstream: state.Downstream,
+	}
+	if state.StartTime != nil {
+		record.Timestamp = *state.StartTime
+		record.Duration = durationOf(state.StartTime, state.EndTime)
+	}
+
+	err = workflow.ExecuteActivity(ctx, "RecordBuildActivity", jobName, record).Get(ctx, nil)
+	if err != nil {
+		workflow.GetLogger(ctx).Warn("Failed to record build", "job", jobName, "build", number, "error", err)
+	}
+}
+
+// buildCompleted lets the API trigger the jobs downstream of a finished job build. Running it from the workflow
+// covers the builds the queue didn't start, e.g. restarted ones, and the ones which outlived an API restart.
+func buildCompleted(ctx workflow.Context, properties map[string]interface{}, result Result) {
+	jobName, _ := properties["jobName"].(string)
+	number, err := strconv.Atoi(toString(properties["buildNumber"]))
+	if jobName == "" || err != nil {
+		return
+	}
+
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		TaskQueue:           TriggerTaskQueue,
+		StartToCloseTimeout: time.Minute,
+		// keeps retrying while the API is down, but doesn't hold the build forever
+		ScheduleToCloseTimeout: 10 * time.Minute,
+	})
+	err = workflow.ExecuteActivity(ctx, "BuildCompletedActivity", jobName, number, result).Get(ctx, nil)
+	if err != nil {
+		workflow.GetLogger(ctx).Warn("Failed to trigger downstream jobs", "job", jobName, "build", number, "error", err)
+	}
+}
+
+// causesOf tells why the build started from the properties it was started with
+func causesOf(properties map[string]interface{}) []jobs.Cause {
+	if restarted, ok := properties["restartedBuild"].(string); ok {
+		originBuild, _ := strconv.Atoi(restarted[strings.LastIndex(restarted, "/")+1:])
+		originStage, _ := properties["restartFrom"].(string)
+		return []jobs.Cause{{Type: jobs.RestartCause, OriginBuild: originBuild, OriginStage: originStage}}
+	}
+	switch trigger, _ := properties["triggeredBy"].(string); trigger {
+	case jobs.TimerCause, jobs.SCMCause:
+		return []jobs.Cause{{Type: trigger}}
+	case jobs.UpstreamCause:
+		upstreamProject, _ := properties["upstreamProject"].(string)
+		upstreamBuild, _ := strconv.Atoi(toString(properties["upstreamBuild"]))
+		return []jobs.Cause{{Type: trigger, UpstreamProject: upstreamProject, UpstreamBuild: upstreamBuild}}
+	}
+	userId, _ := properties["userId"].(string)
+	return []jobs.Cause{{Type: jobs.UserCause, UserId: userId}}
+}
+
+// parameterValues lists the build parameters in the order they're declared in, without password values
+func parameterValues(parameters Parameters, params map[string]any) []jobs.ParameterValue {
+	var values []jobs.ParameterValue
+	for _, param := range parameters {
+		value, ok := params[param.Name()]
+		if !ok {
+			continue
+		}
+		if param.Type == "password" {
+			// not written to build.xml, no need to pass it along
+			value = nil
+		}
+		values = append(values, jobs.ParameterValue{Name: param.Name(), Type: param.Type, Value: value})
+	}
+	return values
+}
+
+// stageRecords records the stages with the output they have in the results, which mirror the stages
+func stageRecords(states []*StageState, results map[string]any) []jobs.StageRecord {
+	var records []jobs.StageRecord
+	for _, state := range states {
+		nested, _ := results[state.Name].(map[string]any)
+		records = append(records, jobs.StageRecord{
+			Name:     state.Name,
+			Status:   string(state.Status),
+			Duration: durationOf(state.StartTime, state.EndTime),
+			Output:   outputOf(results[state.Name]),
+			Stages:   stageRecords(state.Stages, nested),
+		})
+	}
+	return records
+}
+
+// outputOf returns the output of a stage in the results, the output carried over by a restarted build
+// comes back from the workflow input as a list of any
+func outputOf(result any) []string {
+	switch output := result.(type) {
+	case []string:
+		return output
+	case []any:
+		lines := make([]string, len(output))
+		for i, line := range output {
+			lines[i] = toString(line)
+		}
+		return lines
+	}
+	return nil
+}
+
+// durationOf returns the milliseconds between start and end, zero if either is unknown
+func durationOf(start *time.Time, end *time.Time) int64 {
+	if start == nil || end == nil {
+		return 0
+	}
+	return end.Sub(*start).Milliseconds()
+}
@@ -0,0 +1,226 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	temporalClient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+)
+
+// ErrBuildRunning is returned when restarting a build that hasn't finished yet
+var ErrBuildRunning = errors.New("build is still running")
+
+// restartPoint returns how many top-level stages a restarted build skips and the results they had in the
+// previous run. Both come from the "restartFrom" and "previousResults" properties set by RestartBuild.
+func restartPoint(stages []*Stage, properties map[string]interface{}) (int, map[string]any, error) {
+	stageName, _ := properties["restartFrom"].(string)
+	if stageName == "" {
+		return 0, nil, nil
+	}
+	previousResults, _ := properties["previousResults"].(map[string]any)
+	for i, stage := range stages {
+		if stage.Name.Literal() == stageName {
+			return i, previousResults, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("stage %s not found, a build restarts from a top-level stage", stageName)
+}
+
+// skipFromPreviousRun marks the stage and the ones it contains as carried over from the previous run
+func (state *StageState) skipFromPreviousRun() {
+	state.Status = StatusSkippedFromPreviousRun
+	for _, nested := range state.Stages {
+		nested.skipFromPreviousRun()
+	}
+}
+
+// RestartBuild starts a new build of a finished one from the given top-level stage.
+// The new build reuses the pipeline and the parameters of the original one, the stages before
+// stageName are skipped and keep the results of the original build. A job build takes the results
+// from its build record and gets the stashes of the original build, so it can be restarted after
+// Temporal has dropped the history of the original one. It fails with ErrJobRunning like ExecuteBuild.
+func RestartBuild(wfClient temporalClient.Client, workflowId string, stageName string) (temporalClient.WorkflowRun, error) {
+	ctx := context.Background()
+	description, err := wfClient.DescribeWorkflowExecution(ctx, workflowId, "")
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	if err == nil && description.WorkflowExecutionInfo.GetStatus() == enums.WORKFLOW_EXECUTION_STATUS_RUNNING {
+		return nil, ErrBuildRunning
+	}
+
+	jobName, number := splitBuildId(workflowId)
+	pipeline, properties, taskQueue, err := buildInput(ctx, wfClient, workflowId, jobName, number)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := restartPoint(pipeline.Stages, map[string]interface{}{"restartFrom": stageName}); err != nil {
+		return nil, err
+	}
+
+	previousResults, err := previousResults(wfClient, workflowId, jobName, number)
+	if err != nil {
+		return nil, err
+	}
+
+	props := make(map[string]interface{}, len(properties)+4)
+	for name, value := range properties {
+		props[name] = value
+	}
+	// a restarted job build gets the next build number, builds of uploaded scripts aren't numbered
+	jobId := uuid.New().String()
+	if jobName != "" {
+		buildNumber, err := jobs.NextBuildNumber(jobName)
+		if err != nil {
+			return nil, err
+		}
+		// the skipped stages may have stashed files the restarted ones unstash
+		if err := jobs.CopyStashes(jobName, number, buildNumber); err != nil {
+			return nil, err
+		}
+		jobId = strconv.Itoa(buildNumber)
+		props["jobName"] = jobName
+		props["buildNumber"] = jobId
+	}
+	if params, ok := properties["params"].(map[string]any); ok {
+		// the secrets of the passwords were deleted when the build completed, the password parameters
+		// are left blank like jobInput does
+		props["params"], _ = pipeline.Parameters.passwords(params)
+	}
+	props["jobId"] = jobId
+	props["restartFrom"] = stageName
+	props["restartedBuild"] = workflowId
+	props["previousResults"] = previousResults
+
+	workflowOptions := temporalClient.StartWorkflowOptions{
+		ID:        workflowId[:strings.LastIndex(workflowId, "/")+1] + jobId,
+		TaskQueue: taskQueue,
+	}
+	if jobName != "" {
+		// disableConcurrentBuilds() holds the restarted build back like the queued ones
+		return ExecuteBuild(ctx, wfClient, workflowOptions, jobName, &pipeline, props)
+	}
+	return wfClient.ExecuteWorkflow(ctx, workflowOptions, GroovyDSLWorkflow, pipeline, props)
+}
+
+// splitBuildId splits the id of a job build, e.g. /jobs/my-job/12, into the job name and the build number.
+// The job name is empty for builds of uploaded scripts.
+func splitBuildId(workflowId string) (string, int) {
+	idx := strings.LastIndex(workflowId, "/")
+	number, err := strconv.Atoi(workflowId[idx+1:])
+	if !strings.HasPrefix(workflowId, "/jobs/") || err != nil {
+		return "", 0
+	}
+	return workflowId[:idx], number
+}
+
+// buildInput returns the pipeline and the properties a build was started with and its task queue.
+// They're the input of the workflow, once Temporal has dropped the history of a job build they're
+// rebuilt from the Jenkinsfile of the job and the parameters in the build record.
+func buildInput(ctx context.Context, wfClient temporalClient.Client, workflowId string, jobName string, number int) (Pipeline, map[string]interface{}, string, error) {
+	var pipeline Pipeline
+	var properties map[string]interface{}
+
+	iter := wfClient.GetWorkflowHistory(ctx, workflowId, "", false, enums.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+	event, err := iter.Next()
+	if isNotFound(err) && jobName != "" {
+		return jobInput(jobName, number)
+	}
+	if err != nil {
+		return pipeline, nil, "", err
+	}
+	started := event.GetWorkflowExecutionStartedEventAttributes()
+	if started == nil {
+		return pipeline, nil, "", fmt.Errorf("build %s has no start event", workflowId)
+	}
+	if err := converter.GetDefaultDataConverter().FromPayloads(started.Input, &pipeline, &properties); err != nil {
+		return pipeline, nil, "", err
+	}
+	return pipeline, properties, started.TaskQueue.GetName(), nil
+}
+
+// jobInput rebuilds the input of a job build from the Jenkinsfile of the job and the build record.
+// The build record doesn't keep password values, the password parameters are left blank.
+func jobInput(jobName string, number int) (Pipeline, map[string]interface{}, string, error) {
+	job, err := jobs.ReadJob(jobName)
+	if err != nil {
+		return Pipeline{}, nil, "", err
+	}
+	var parser DslParser
+	pipeline, err := parser.ParseFile(jobName, job.Script)
+	if err != nil {
+		return Pipeline{}, nil, "", err
+	}
+	record, err := jobs.ReadBuildRecord(jobName, number)
+	if err != nil {
+		return Pipeline{}, nil, "", err
+	}
+	params := make(map[string]any, len(record.Parameters))
+	for _, param := range record.Parameters {
+		if param.Value != nil {
+			params[param.Name] = param.Value
+		}
+	}
+	return *pipeline, map[string]interface{}{"jobName": jobName, "params": params}, DefaultTaskQueue, nil
+}
+
+// previousResults returns the results of the build to restart, a job build has them in its build record
+func previousResults(wfClient temporalClient.Client, workflowId string, jobName string, number int) (map[string]any, error) {
+	if jobName == "" {
+		return GetResults(wfClient, workflowId)
+	}
+	record, err := jobs.ReadBuildRecord(jobName, number)
+	if errors.Is(err, os.ErrNotExist) {
+		// recorded before the build records were kept
+		return GetResults(wfClient, workflowId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resultsOf(record.Stages), nil
+}
+
+// resultsOf turns the stages of a build record back into the results of the build, see stageRecords
+func resultsOf(stages []jobs.StageRecord) map[string]any {
+	results := make(map[string]any, len(stages))
+	for _, stage := range stages {
+		switch {
+		case len(stage.Stages) > 0:
+			results[stage.Name] = resultsOf(stage.Stages)
+		case stage.Status == string(StatusSkipped):
+			results[stage.Name] = Skipped
+		default:
+			results[stage.Name] = stage.Output
+		}
+	}
+	return results
+}
+
+func isNotFound(err error) bool {
+	var notFound *serviceerror.NotFound
+	return errors.As(err, &notFound)
+}
+
+// GetResults returns the results recorded by a build so far, they're available for failed builds too
+func GetResults(wfClient temporalClient.Client, workflowId string) (map[string]any, error) {
+	msgEncoded, err := wfClient.QueryWorkflow(context.Background(), workflowId, "", "results")
+	if err != nil {
+		return nil, err
+	}
+
+	var results map[string]any
+	if err := msgEncoded.Get(&results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,198 @@
+package workflow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/api/serviceerror"
+	temporalClient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/mocks"
+	"go.temporal.io/sdk/testsuite"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+)
+
+const restartJenkinsfile = `
+    pipeline {
+		agent none
+		stages {
+			stage('Build') {
+				steps {
+					sh 'make'
+				}
+			}
+			stage('Test') {
+				parallel {
+					stage('Unit') {
+						steps {
+							sh 'make check'
+						}
+					}
+				}
+			}
+			stage('Deploy') {
+				steps {
+					sh 'make deploy'
+				}
+			}
+		}
+	}
+    `
+
+func TestRestartFromStage(t *testing.T) {
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(restartJenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+
+	var calls []string
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			_, params := steps[0].ToCommand()
+			calls = append(calls, params["text"].(string))
+			return []string{params["text"].(string)}, nil
+		})
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{
+		"restartFrom": "Deploy",
+		"previousResults": map[string]any{
+			"Build":  []any{"make"},
+			"Test":   map[string]any{"Unit": []any{"make check"}},
+			"Deploy": []any{"failed deploy"},
+		},
+	})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if diff := cmp.Diff(calls, []string{"make deploy"}); diff != "" {
+		t.Errorf("Unexpected steps (-got +want):\n%s", diff)
+	}
+
+	var results map[string]any
+	if err := env.GetWorkflowResult(&results); err != nil {
+		t.Fatalf("Failed to get workflow result: %v", err)
+	}
+	want := map[string]any{
+		"Build":  []any{"make"},
+		"Test":   map[string]any{"Unit": []any{"make check"}},
+		"Deploy": []any{"make deploy"},
+	}
+	if diff := cmp.Diff(results, want); diff != "" {
+		t.Errorf("Unexpected results (-got +want):\n%s", diff)
+	}
+
+	encoded, err := env.QueryWorkflow("state")
+	if err != nil {
+		t.Fatalf("Failed to query state: %v", err)
+	}
+	var state BuildState
+	if err := encoded.Get(&state); err != nil {
+		t.Fatalf("Failed to decode state: %v", err)
+	}
+	statuses := []Status{state.Stages[0].Status, state.Stages[1].Status, state.Stages[1].Stages[0].Status, state.Stages[2].Status}
+	wantStatuses := []Status{StatusSkippedFromPreviousRun, StatusSkippedFromPreviousRun, StatusSkippedFromPreviousRun, StatusSuccess}
+	if diff := cmp.Diff(statuses, wantStatuses); diff != "" {
+		t.Errorf("Unexpected stage statuses (-got +want):\n%s", diff)
+	}
+}
+
+func TestRestartFromUnknownStage(t *testing.T) {
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(restartJenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	// only top-level stages can be restarted
+	if _, _, err := restartPoint(pipeline.Stages, map[string]interface{}{"restartFrom": "Unit"}); err == nil {
+		t.Errorf("Expected an error restarting from a parallel branch")
+	}
+	skipped, _, err := restartPoint(pipeline.Stages, map[string]interface{}{"restartFrom": "Test"})
+	if err != nil || skipped != 1 {
+		t.Errorf("Expected to skip 1 stage, got %d, %v", skipped, err)
+	}
+}
+
+func TestRestartBuildFromRecord(t *testing.T) {
+	t.Setenv("JENKINS_HOME", t.TempDir())
+	jobDir := jobs.JobDir("/jobs/app")
+	if err := os.MkdirAll(jobs.StashDir("/jobs/app", 1), 0740); err != nil {
+		t.Fatal(err)
+	}
+	config := "<flow-definition><definition><script><![CDATA[" + restartJenkinsfile + "]]></script></definition></flow-definition>"
+	for name, content := range map[string]string{
+		filepath.Join(jobDir, "config.xml"):                        config,
+		filepath.Join(jobDir, "nextBuildNumber"):                   "2\n",
+		filepath.Join(jobs.StashDir("/jobs/app", 1), "bin.tar.gz"): "archive",
+	} {
+		if err := os.WriteFile(name, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := jobs.WriteBuildRecord("/jobs/app", jobs.BuildRecord{
+		Number:     1,
+		Result:     "FAILURE",
+		Parameters: []jobs.ParameterValue{{Name: "TARGET", Type: "string", Value: "staging"}},
+		Stages: []jobs.StageRecord{
+			{Name: "Build", Status: "success", Output: []string{"make"}},
+			{Name: "Test", Status: "success", Stages: []jobs.StageRecord{{Name: "Unit", Status: "success", Output: []string{"make check"}}}},
+			{Name: "Deploy", Status: "failed", Output: []string{"failed deploy"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Temporal has dropped the history of the build
+	wfClient := &mocks.Client{}
+	notFound := serviceerror.NewNotFound("workflow execution not found")
+	wfClient.On("DescribeWorkflowExecution", mock.Anything, "/jobs/app/1", "").Return(nil, notFound)
+	history := &mocks.HistoryEventIterator{}
+	history.On("Next").Return(nil, notFound)
+	wfClient.On("GetWorkflowHistory", mock.Anything, "/jobs/app/1", "", false, mock.Anything).Return(history)
+
+	var props map[string]interface{}
+	options := mock.MatchedBy(func(options temporalClient.StartWorkflowOptions) bool {
+		return options.ID == "/jobs/app/2" && options.TaskQueue == DefaultTaskQueue
+	})
+	captured := mock.MatchedBy(func(properties map[string]interface{}) bool {
+		props = properties
+		return true
+	})
+	wfClient.On("ExecuteWorkflow", mock.Anything, options, mock.Anything, mock.Anything, captured).Return(&mocks.WorkflowRun{}, nil)
+
+	if _, err := RestartBuild(wfClient, "/jobs/app/1", "Deploy"); err != nil {
+		t.Fatalf("Failed to restart build: %v", err)
+	}
+	want := map[string]interface{}{
+		"jobName":        "/jobs/app",
+		"jobId":          "2",
+		"buildNumber":    "2",
+		"params":         map[string]any{"TARGET": "staging"},
+		"restartFrom":    "Deploy",
+		"restartedBuild": "/jobs/app/1",
+		"previousResults": map[string]any{
+			"Build":  []string{"make"},
+			"Test":   map[string]any{"Unit": []string{"make check"}},
+			"Deploy": []string{"failed deploy"},
+		},
+	}
+	if diff := cmp.Diff(props, want); diff != "" {
+		t.Errorf("Unexpected properties of the restarted build (-got +want):\n%s", diff)
+	}
+
+	// the restarted build can unstash what the skipped stages stashed
+	if data, err := os.ReadFile(filepath.Join(jobs.StashDir("/jobs/app", 2), "bin.tar.gz")); err != nil || string(data) != "archive" {
+		t.Errorf("Expected the stashes to be copied to the restarted build, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,185 @@
+package workflow
+
+import (
+	"fmt"
+	"strings"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Script blocks are interpreted inside the workflow, so they have to stay deterministic: there are
+// no while loops, no arbitrary method calls and no access to the host. Steps called from a script
+// are dispatched to StageActivity one at a time and their output is the value of the call.
+
+type interpreter struct {
+	ctx    workflow.Context
+	agent  *Agent
+	scope  *scope
+	output []string
+}
+
+func (script *Script) execute(ctx workflow.Context, agent *Agent, variables map[string]string) ([]string, error) {
+	params, _ := ctx.Value("params").(map[string]any)
+	in := &interpreter{
+		ctx:   ctx,
+		agent: agent,
+		scope: &scope{
+			env:    variables,
+			params: params,
+			vars:   make(map[string]any),
+		},
+	}
+	err := in.run(script.Statements)
+	return in.output, err
+}
+
+func (in *interpreter) run(statements []*Statement) error {
+	for _, statement := range statements {
+		if err := in.runStatement(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *interpreter) runStatement(statement *Statement) error {
+	switch {
+	case statement.Def != nil:
+		if len(statement.Def.Target) != 1 {
+			return fmt.Errorf("invalid variable name %s", strings.Join(statement.Def.Target, "."))
+		}
+		return in.assign(statement.Def)
+	case statement.Assign != nil:
+		return in.assign(statement.Assign)
+	case statement.If != nil:
+		return in.runIf(statement.If)
+	case statement.For != nil:
+		return in.runFor(statement.For)
+	case statement.Call != nil:
+		_, err := in.call(statement.Call)
+		return err
+	}
+	return nil
+}
+
+func (in *interpreter) assign(assignment *Assignment) error {
+	value, err := assignment.Value.evaluate(in.scope)
+	if err != nil {
+		return err
+	}
+	target := assignment.Target
+	if len(target) == 2 && target[0] == "env" {
+		// environment variables set by a script are visible to the following steps of the stage
+		in.scope.env[target[1]] = toString(value)
+		return nil
+	}
+	if len(target) != 1 {
+		return fmt.Errorf("cannot assign to %s", strings.Join(target, "."))
+	}
+	in.scope.vars[target[0]] = value
+	return nil
+}
+
+func (in *interpreter) runIf(ifStatement *If) error {
+	condition, err := ifStatement.Condition.evaluate(in.scope)
+	if err != nil {
+		return err
+	}
+	if isTruthy(condition) {
+		return in.run(ifStatement.Then)
+	}
+	if ifStatement.Else == nil {
+		return nil
+	}
+	if ifStatement.Else.If != nil {
+		return in.runIf(ifStatement.Else.If)
+	}
+	return in.run(ifStatement.Else.Statements)
+}
+
+func (in *interpreter) runFor(forStatement *For) error {
+	iterable, err := forStatement.Iterable.evaluate(in.scope)
+	if err != nil {
+		return err
+	}
+	items, ok := iterable.([]any)
+	if !ok {
+		return fmt.Errorf("cannot iterate over %v", iterable)
+	}
+	for _, item := range items {
+		in.scope.vars[forStatement.Variable] = item
+		if err := in.run(forStatement.Body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// call dispatches a step to StageActivity and returns its output
+func (in *interpreter) call(call *Call) (any, error) {
+	step, err := in.toStep(call)
+	if err != nil {
+		return nil, err
+	}
+	if call.Command == "error" {
+		// error 'x' and error(message: 'x') fail the stage the same way
+		_, params := step.ToCommand()
+		return nil, temporal.NewNonRetryableApplicationError(stepMessage(params), commandErrType, nil)
+	}
+	if call.Command == "input" {
+		// the value of an input call is the user who approved it
+		output, submitter, err := executeInput(in.ctx, step, in.scope.env)
+		in.output = append(in.output, output...)
+		return submitter, err
+	}
+	if call.Command == "build" {
+		output, err := executeBuild(in.ctx, step, in.scope.env)
+		in.output = append(in.output, output...)
+		return nil, err
+	}
+	if call.Command == "stash" || call.Command == "unstash" {
+		output, err := executeStash(in.ctx, step, in.agent, in.scope.env)
+		in.output = append(in.output, output...)
+		return nil, err
+	}
+
+	output, err := executeStageActivity(in.ctx, []*Step{step}, in.agent, in.scope.env)
+	in.output = append(in.output, output...)
+	if len(output) == 0 {
+		return nil, err
+	}
+	return output[len(output)-1], err
+}
+
+// toStep evaluates the call arguments into a step with literal values
+func (in *interpreter) toStep(call *Call) (*Step, error) {
+	if len(call.Args) == 1 && call.Args[0].Key == "" {
+		value, err := call.Args[0].Value.evaluate(in.scope)
+		if err != nil {
+			return nil, err
+		}
+		return &Step{
+			SingleKV: &SingleKVCommand{
+				Command: call.Command,
+				Value:   QuotedString(escapeTemplate(toString(value))),
+			},
+		}, nil
+	}
+
+	command := &MultiKVCommand{Command: call.Command}
+	for _, arg := range call.Args {
+		if arg.Key == "" {
+			return nil, fmt.Errorf("step %s expects named arguments", call.Command)
+		}
+		value, err := arg.Value.evaluate(in.scope)
+		if err != nil {
+			return nil, err
+		}
+		command.Params = append(command.Params, Param{
+			Key:   arg.Key,
+			Value: QuotedString(escapeTemplate(toString(value))),
+		})
+	}
+	return &Step{MultiKV: command}, nil
+}
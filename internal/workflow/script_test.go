@@ -0,0 +1,130 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestScriptBlock(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('Build') {
+				steps {
+					echo 'Before script'
+					script {
+						def targets = ['linux', 'darwin', 'windows']
+						for (target in targets) {
+							if (target == 'windows' && !params.WINDOWS) {
+								echo "Skipping ${target}"
+							} else if (target.startsWith('dar')) {
+								sh "make TARGET=$target ARCH=arm64"
+							} else {
+								sh(script: 'make TARGET=' + target)
+							}
+						}
+						env.BUILT = targets.size() + ' targets'
+					}
+					sh 'echo $BUILT'
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+
+	var calls []string
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			variables := stageContext.Variables
+			var output []string
+			for _, step := range steps {
+				command, params := step.ToCommand()
+				call := command
+				for _, key := range []string{"text", "script"} {
+					if value, ok := params[key]; ok {
+						call += " " + value.(string)
+					}
+				}
+				if command == "sh" && variables["BUILT"] != "" {
+					call += " BUILT=" + variables["BUILT"]
+				}
+				calls = append(calls, call)
+				output = append(output, call)
+			}
+			return output, nil
+		})
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{
+		"params": map[string]any{"WINDOWS": false},
+	})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	want := []string{
+		"echo Before script",
+		"sh make TARGET=linux",
+		"sh make TARGET=darwin ARCH=arm64",
+		"echo Skipping windows",
+		"sh echo $BUILT BUILT=3 targets",
+	}
+	if diff := cmp.Diff(calls, want); diff != "" {
+		t.Errorf("Unexpected steps (-got +want):\n%s", diff)
+	}
+}
+
+func TestScriptError(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('Build') {
+				steps {
+					script {
+						if (params.TARGET != 'linux') {
+							error(message: "Unsupported target ${params.TARGET}")
+						}
+					}
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{
+		"params": map[string]any{"TARGET": "windows"},
+	})
+	var appErr *temporal.ApplicationError
+	if err := env.GetWorkflowError(); !errors.As(err, &appErr) || appErr.Type() != commandErrType || appErr.Message() != "Unsupported target windows" {
+		t.Errorf("Expected the build to fail with the message of the error step, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestNestedStages(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('Platforms') {
+				parallel {
+					stage('Linux') {
+						stages {
+							stage('Build') {
+								steps {
+									sh 'make linux'
+								}
+							}
+							stage('Test') {
+								steps {
+									sh 'make check'
+								}
+							}
+						}
+					}
+					stage('Windows') {
+						steps {
+							sh 'make windows'
+						}
+					}
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			_, params := steps[0].ToCommand()
+			return []string{params["text"].(string)}, nil
+		})
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	var results map[string]any
+	if err := env.GetWorkflowResult(&results); err != nil {
+		t.Fatalf("Failed to get workflow result: %v", err)
+	}
+	want := map[string]any{
+		"Platforms": map[string]any{
+			"Linux": map[string]any{
+				"Build": []any{"make linux"},
+				"Test":  []any{"make check"},
+			},
+			"Windows": []any{"make windows"},
+		},
+	}
+	if diff := cmp.Diff(results, want); diff != "" {
+		t.Errorf("Unexpected results (-got +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,381 @@
+package workflow
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+)
+
+// maxStashSize bounds the compressed size of a stash, it travels in the activity payloads between the node
+// and the controller. Large artifacts belong in archiveArtifacts.
+const maxStashSize = 1 << 20
+
+// pinnedNode is the node the steps of a stage using stash run on, see pinNode
+type pinnedNode struct {
+	taskQueue string
+}
+
+// Stash is a stash archived by the node, see StashActivity
+type Stash struct {
+	Archive []byte
+	Files   int
+}
+
+// executeStash runs the stash and unstash steps. The files are archived from and extracted to the workspace
+// by the node, the stashes are kept by the controller with the build, in builds/<N>/stashes like Jenkins does,
+// so that a build restarted from a later stage can unstash them too.
+func executeStash(ctx workflow.Context, step *Step, agent *Agent, variables map[string]string) ([]string, error) {
+	if err := awaitResumed(ctx); err != nil {
+		return nil, err
+	}
+	if state, ok := ctx.Value("currentStage").(*StageState); ok {
+		state.CurrentStep = step.Name()
+	}
+
+	params, _ := ctx.Value("params").(map[string]any)
+	command, stepParams, err := step.resolve(&scope{env: variables, params: params})
+	if err != nil {
+		return nil, temporal.NewNonRetryableApplicationError(err.Error(), commandErrType, nil)
+	}
+	name, ok := stepParams["name"].(string)
+	if !ok {
+		name, _ = stepParams["text"].(string)
+	}
+	if !validStashName(name) {
+		return nil, temporal.NewNonRetryableApplicationError(fmt.Sprintf("invalid stash name %q", name), commandErrType, nil)
+	}
+	properties, _ := ctx.Value("properties").(map[string]interface{})
+	jobName, _ := properties["jobName"].(string)
+	buildNumber, _ := strconv.Atoi(toString(properties["buildNumber"]))
+	if jobName == "" {
+		return nil, temporal.NewNonRetryableApplicationError(fmt.Sprintf("%s is only available in job builds", command), commandErrType, nil)
+	}
+
+	nodeCtx, err := stageTaskQueue(ctx, agent, variables)
+	if err != nil {
+		return nil, err
+	}
+	controllerCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		TaskQueue:           ControllerTaskQueue,
+		StartToCloseTimeout: time.Minute,
+	})
+
+	if command == "unstash" {
+		var archive []byte
+		if err := workflow.ExecuteActivity(controllerCtx, "LoadStashActivity", jobName, buildNumber, name).Get(ctx, &archive); err != nil {
+			return nil, err
+		}
+		var output string
+		err := workflow.ExecuteActivity(nodeCtx, "UnstashActivity", jobName, buildNumber, name, archive).Get(ctx, &output)
+		return []string{output}, err
+	}
+
+	var stash Stash
+	if err := workflow.ExecuteActivity(nodeCtx, "StashActivity", jobName, buildNumber, stepParams).Get(ctx, &stash); err != nil {
+		return nil, err
+	}
+	if err := workflow.ExecuteActivity(controllerCtx, "StoreStashActivity", jobName, buildNumber, name, stash.Archive).Get(ctx, nil); err != nil {
+		return nil, err
+	}
+	return []string{fmt.Sprintf("Stashed %d file(s) as %s", stash.Files, name)}, nil
+}
+
+// pinNode pins the steps to a node when they stash files: the workspace the files are archived from is the one
+// of the node the previous steps ran on. The first activity of the steps asks the node it runs on for the
+// task queue only that node polls, the next ones run there, see stageTaskQueue.
+func pinNode(ctx workflow.Context, steps []*Step) workflow.Context {
+	if _, ok := ctx.Value("pinnedNode").(*pinnedNode); ok || !usesStash(steps) {
+		return ctx
+	}
+	return workflow.WithValue(ctx, "pinnedNode", &pinnedNode{})
+}
+
+// pin returns the context on the task queue of the pinned node, pinning the node ctx runs on first
+func (pinned *pinnedNode) pin(ctx workflow.Context) (workflow.Context, error) {
+	if pinned.taskQueue == "" {
+		var nodeTaskQueue string
+		if err := workflow.ExecuteActivity(ctx, "NodeTaskQueueActivity").Get(ctx, &nodeTaskQueue); err != nil {
+			return ctx, err
+		}
+		// a script block may have pinned the node meanwhile
+		if pinned.taskQueue == "" {
+			pinned.taskQueue = nodeTaskQueue
+		}
+	}
+	return workflow.WithTaskQueue(ctx, pinned.taskQueue), nil
+}
+
+// usesStash reports whether the steps, or the script blocks among them, call stash or unstash
+func usesStash(steps []*Step) bool {
+	for _, step := range steps {
+		if name := step.Name(); name == "stash" || name == "unstash" {
+			return true
+		}
+		if step.Script != nil && statementsUseStash(step.Script.Statements) {
+			return true
+		}
+	}
+	return false
+}
+
+func statementsUseStash(statements []*Statement) bool {
+	for _, statement := range statements {
+		switch {
+		case statement.Call != nil:
+			if statement.Call.Command == "stash" || statement.Call.Command == "unstash" {
+				return true
+			}
+		case statement.If != nil:
+			for ifStatement := statement.If; ifStatement != nil; {
+				if statementsUseStash(ifStatement.Then) {
+					return true
+				}
+				if ifStatement.Else == nil {
+					break
+				}
+				if statementsUseStash(ifStatement.Else.Statements) {
+					return true
+				}
+				ifStatement = ifStatement.Else.If
+			}
+		case statement.For != nil:
+			if statementsUseStash(statement.For.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// StashActivity archives the files of the workspace of the build for the stash step
+func (a *StageActivities) StashActivity(ctx context.Context, jobName string, buildNumber int, params map[string]interface{}) (Stash, error) {
+	name, ok := params["name"].(string)
+	if !ok {
+		name, _ = params["text"].(string)
+	}
+	workspace, err := buildWorkspace(jobName, buildNumber)
+	if err != nil {
+		return Stash{}, temporal.NewNonRetryableApplicationError(err.Error(), "workspace", nil)
+	}
+	includes, _ := params["includes"].(string)
+	if includes == "" {
+		includes = "**"
+	}
+	excludes, _ := params["excludes"].(string)
+
+	var archive bytes.Buffer
+	count, err := stashFiles(workspace, &limitedWriter{w: &archive, n: maxStashSize}, includes, excludes)
+	if errors.Is(err, errStashTooLarge) {
+		return Stash{}, temporal.NewNonRetryableApplicationError(fmt.Sprintf("stash %s is larger than %d bytes", name, maxStashSize), commandErrType, nil)
+	} else if err != nil {
+		return Stash{}, temporal.NewNonRetryableApplicationError(fmt.Sprintf("failed to stash %s: %s", name, err), commandErrType, nil)
+	}
+	if count == 0 && params["allowEmpty"] != "true" {
+		return Stash{}, temporal.NewNonRetryableApplicationError(fmt.Sprintf("no files included in stash %s", name), commandErrType, nil)
+	}
+	return Stash{Archive: archive.Bytes(), Files: count}, nil
+}
+
+// UnstashActivity extracts a stash into the workspace of the build for the unstash step
+func (a *StageActivities) UnstashActivity(ctx context.Context, jobName string, buildNumber int, name string, archive []byte) (string, error) {
+	workspace, err := buildWorkspace(jobName, buildNumber)
+	if err != nil {
+		return "", temporal.NewNonRetryableApplicationError(err.Error(), "workspace", nil)
+	}
+	count, err := unstashFiles(bytes.NewReader(archive), workspace)
+	if err != nil {
+		return "", temporal.NewNonRetryableApplicationError(fmt.Sprintf("failed to unstash %s: %s", name, err), commandErrType, nil)
+	}
+	return fmt.Sprintf("Unstashed %d file(s) from %s", count, name), nil
+}
+
+// StoreStashActivity keeps a stash of the build, as builds/<N>/stashes/<name>.tar.gz
+func (a *ControllerActivities) StoreStashActivity(ctx context.Context, jobName string, buildNumber int, name string, archive []byte) error {
+	if !validStashName(name) {
+		return temporal.NewNonRetryableApplicationError(fmt.Sprintf("invalid stash name %q", name), commandErrType, nil)
+	}
+	dir := jobs.StashDir(jobName, buildNumber)
+	if err := os.MkdirAll(dir, 0740); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name+".tar.gz"), archive, 0640)
+}
+
+// LoadStashActivity returns a stash kept by StoreStashActivity
+func (a *ControllerActivities) LoadStashActivity(ctx context.Context, jobName string, buildNumber int, name string) ([]byte, error) {
+	if !validStashName(name) {
+		return nil, temporal.NewNonRetryableApplicationError(fmt.Sprintf("invalid stash name %q", name), commandErrType, nil)
+	}
+	archive, err := os.ReadFile(filepath.Join(jobs.StashDir(jobName, buildNumber), name+".tar.gz"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, temporal.NewNonRetryableApplicationError(fmt.Sprintf("no such saved stash %s", name), commandErrType, nil)
+	}
+	return archive, err
+}
+
+// validStashName reports whether the stash can be kept as a file of the stashes directory
+func validStashName(name string) bool {
+	return name != "" && name == filepath.Base(name) && name != ".."
+}
+
+var errStashTooLarge = errors.New("stash too large")
+
+// limitedWriter fails with errStashTooLarge once more than n bytes are written
+type limitedWriter struct {
+	w io.Writer
+	n int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > l.n {
+		return 0, errStashTooLarge
+	}
+	l.n -= len(p)
+	return l.w.Write(p)
+}
+
+// stashFiles archives the files of the workspace matching includes and not excludes,
+// both comma-separated Ant patterns, e.g. 'target/**/*.jar'. It returns how many files were archived.
+func stashFiles(workspace string, archive io.Writer, includes string, excludes string) (int, error) {
+	gz := gzip.NewWriter(archive)
+	tw := tar.NewWriter(gz)
+
+	count := 0
+	err := filepath.WalkDir(workspace, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(workspace, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !antMatch(includes, rel) || antMatch(excludes, rel) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		if _, err := io.Copy(tw, src); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// unstashFiles extracts an archive made by stashFiles into the workspace, it returns how many files were extracted
+func unstashFiles(archive io.Reader, workspace string) (int, error) {
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return 0, err
+	}
+	tr := tar.NewReader(gz)
+
+	count := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if header.Typeflag != tar.TypeReg || !filepath.IsLocal(header.Name) {
+			continue
+		}
+		path := filepath.Join(workspace, filepath.FromSlash(header.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return count, err
+		}
+		dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fs.FileMode(header.Mode).Perm())
+		if err != nil {
+			return count, err
+		}
+		if _, err := io.Copy(dst, tr); err != nil {
+			dst.Close()
+			return count, err
+		}
+		if err := dst.Close(); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+// antMatch reports whether the slash-separated path matches one of the comma-separated Ant patterns:
+// ** matches any number of directories, * and ? match within a directory
+func antMatch(patterns string, path string) bool {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if strings.HasSuffix(pattern, "/") {
+			// a directory stands for everything in it
+			pattern += "**"
+		}
+		var expr strings.Builder
+		for i := 0; i < len(pattern); i++ {
+			switch {
+			case strings.HasPrefix(pattern[i:], "**/"):
+				expr.WriteString("(.*/)?")
+				i += 2
+			case strings.HasPrefix(pattern[i:], "**"):
+				expr.WriteString(".*")
+				i++
+			case pattern[i] == '*':
+				expr.WriteString("[^/]*")
+			case pattern[i] == '?':
+				expr.WriteString("[^/]")
+			default:
+				expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		}
+		if regexp.MustCompile("^" + expr.String() + "$").MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package workflow
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/testsuite"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+)
+
+func TestStashAndUnstash(t *testing.T) {
+	t.Setenv("JENKINS_HOME", t.TempDir())
+	t.Setenv("WORKSPACE", t.TempDir())
+	build, err := buildWorkspace("/jobs/app", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"target/app.jar":         "jar",
+		"target/lib/dep.jar":     "dep",
+		"target/classes/App.cls": "class",
+		"src/App.java":           "source",
+	} {
+		path := filepath.Join(build, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	node := &StageActivities{}
+	controller := &ControllerActivities{}
+
+	stash, err := node.StashActivity(ctx, "/jobs/app", 3, map[string]interface{}{"name": "jars", "includes": "target/**/*.jar", "excludes": "**/lib/"})
+	if err != nil || stash.Files != 1 {
+		t.Fatalf("Failed to stash: %d file(s), %v", stash.Files, err)
+	}
+	if _, err := node.StashActivity(ctx, "/jobs/app", 3, map[string]interface{}{"name": "docs", "includes": "*.md"}); err == nil {
+		t.Errorf("Expected an error stashing no files")
+	}
+	if err := controller.StoreStashActivity(ctx, "/jobs/app", 3, "jars", stash.Archive); err != nil {
+		t.Fatalf("Failed to store the stash: %v", err)
+	}
+
+	archive, err := controller.LoadStashActivity(ctx, "/jobs/app", 3, "jars")
+	if err != nil {
+		t.Fatalf("Failed to load the stash: %v", err)
+	}
+	if _, err := node.UnstashActivity(ctx, "/jobs/app", 4, "jars", archive); err != nil {
+		t.Fatalf("Failed to unstash: %v", err)
+	}
+	deploy := filepath.Join(os.Getenv("WORKSPACE"), "app", "4")
+	var files []string
+	filepath.WalkDir(deploy, func(path string, entry os.DirEntry, err error) error {
+		if entry.Type().IsRegular() {
+			rel, _ := filepath.Rel(deploy, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if diff := cmp.Diff(files, []string{"target/app.jar"}); diff != "" {
+		t.Errorf("Unexpected files unstashed (-got +want):\n%s", diff)
+	}
+
+	for _, name := range []string{"", "..", "../other", "missing"} {
+		if _, err := controller.LoadStashActivity(ctx, "/jobs/app", 3, name); err == nil {
+			t.Errorf("Expected stash name %q to be rejected", name)
+		}
+	}
+
+	// the stashes travel in the activity payloads
+	large := make([]byte, 2*maxStashSize)
+	rand.New(rand.NewSource(1)).Read(large)
+	if err := os.WriteFile(filepath.Join(build, "large.bin"), large, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node.StashActivity(ctx, "/jobs/app", 3, map[string]interface{}{"name": "large"}); err == nil {
+		t.Errorf("Expected an error stashing more than %d bytes", maxStashSize)
+	}
+}
+
+func TestStashSteps(t *testing.T) {
+	t.Setenv("JENKINS_HOME", t.TempDir())
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('Build') {
+				agent { label 'linux' }
+				steps {
+					sh 'make'
+					stash name: 'jars', includes: '*.jar'
+				}
+			}
+			stage('Deploy') {
+				steps {
+					script {
+						unstash 'jars'
+					}
+					sh 'deploy'
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+	registerAPIActivities(env)
+	env.SetStartWorkflowOptions(client.StartWorkflowOptions{TaskQueue: DefaultTaskQueue})
+
+	var mutex sync.Mutex
+	var calls []string
+	record := func(ctx context.Context, call string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls = append(calls, activity.GetInfo(ctx).TaskQueue+" "+call)
+	}
+	// several nodes poll the queues, the stages stashing files stay on the first node they run on
+	nodeTaskQueues := map[string]string{"JobQueue": "JobQueue@builder-1", "JobQueue@linux": "JobQueue@builder-2"}
+	env.OnActivity("NodeTaskQueueActivity", mock.Anything).Return(
+		func(ctx context.Context) (string, error) {
+			return nodeTaskQueues[activity.GetInfo(ctx).TaskQueue], nil
+		}).Twice()
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			_, params := steps[0].ToCommand()
+			record(ctx, params["text"].(string))
+			return []string{}, nil
+		})
+	env.OnActivity("StashActivity", mock.Anything, "/jobs/app", 3, mock.Anything).Return(
+		func(ctx context.Context, jobName string, buildNumber int, params map[string]interface{}) (Stash, error) {
+			record(ctx, "stash "+params["includes"].(string))
+			return Stash{Archive: []byte("archive"), Files: 2}, nil
+		})
+	env.OnActivity("UnstashActivity", mock.Anything, "/jobs/app", 3, "jars", mock.Anything).Return(
+		func(ctx context.Context, jobName string, buildNumber int, name string, archive []byte) (string, error) {
+			record(ctx, "unstash "+string(archive))
+			return "Unstashed 2 file(s) from jars", nil
+		})
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{
+		"jobName":     "/jobs/app",
+		"buildNumber": 3,
+	})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	want := []string{
+		"JobQueue@builder-2 make",
+		"JobQueue@builder-2 stash *.jar",
+		"JobQueue@builder-1 unstash archive",
+		"JobQueue@builder-1 deploy",
+	}
+	if diff := cmp.Diff(calls, want); diff != "" {
+		t.Errorf("Unexpected steps (-got +want):\n%s", diff)
+	}
+	// the controller keeps the stash with the build
+	data, err := os.ReadFile(filepath.Join(jobs.StashDir("/jobs/app", 3), "jars.tar.gz"))
+	if err != nil || string(data) != "archive" {
+		t.Errorf("Expected the stash to be kept with the build, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,156 @@
+package workflow
+
+import (
+	"context"
+	"time"
+
+	temporalClient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
+)
+
+const (
+	StatusPending  Status = "pending"
+	StatusRunning  Status = "running"
+	StatusPaused   Status = "paused"
+	StatusSuccess  Status = "success"
+	StatusUnstable Status = "unstable"
+	StatusFailed   Status = "failed"
+	StatusSkipped  Status = "skipped"
+	StatusAborted  Status = "aborted"
+
+	// StatusSkippedFromPreviousRun marks the stages a restarted build didn't run again
+	StatusSkippedFromPreviousRun Status = "skipped-from-previous-run"
+)
+
+type (
+	// Status is the progress of a build or a stage
+	Status string
+
+	// BuildState is the snapshot returned by the "state" query of a build
+	BuildState struct {
+		Status    Status        `json:"status"`
+		StartTime *time.Time    `json:"startTime,omitempty"`
+		EndTime   *time.Time    `json:"endTime,omitempty"`
+		Stages    []*StageState `json:"stages"`
+		// Inputs are waiting for a response, see InputSignal
+		Inputs []*PendingInput `json:"inputs,omitempty"`
+		// Downstream are the builds started by the build step
+		Downstream []jobs.DownstreamBuild `json:"downstream,omitempty"`
+	}
+
+	// StageState is the state of a stage, Stages holds its parallel branches, nested stages or matrix cells
+	StageState struct {
+		Name      string     `json:"name"`
+		Status    Status     `json:"status"`
+		StartTime *time.Time `json:"startTime,omitempty"`
+		EndTime   *time.Time `json:"endTime,omitempty"`
+		// CurrentStep is the running step, or the first one of the steps run together by an activity
+		CurrentStep string        `json:"currentStep,omitempty"`
+		Stages      []*StageState `json:"stages,omitempty"`
+	}
+)
+
+// newBuildState returns the state of a build with every stage pending
+func newBuildState(pipeline *Pipeline) *BuildState {
+	return &BuildState{
+		Status: StatusPending,
+		Stages: newStageStates(pipeline.Stages),
+	}
+}
+
+func newStageStates(stages []*Stage) []*StageState {
+	states := make([]*StageState, 0, len(stages))
+	for _, stage := range stages {
+		state := &StageState{
+			Name:   stage.Name.Literal(),
+			Status: StatusPending,
+		}
+		if len(stage.Parallel) > 0 {
+			state.Stages = newStageStates(stage.Parallel)
+		} else if len(stage.Stages) > 0 {
+			state.Stages = newStageStates(stage.Stages)
+		} else if stage.Matrix != nil {
+			for _, c := range stage.Matrix.cells() {
+				state.Stages = append(state.Stages, &StageState{
+					Name:   c.String(),
+					Status: StatusPending,
+					Stages: newStageStates(stage.Matrix.Stages),
+				})
+			}
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// IsDone reports whether the build has finished
+func (state *BuildState) IsDone() bool {
+	return state.Status != StatusPending && state.Status != StatusRunning && state.Status != StatusPaused
+}
+
+func (state *BuildState) start(ctx workflow.Context) {
+	now := workflow.Now(ctx)
+	state.Status = StatusRunning
+	state.StartTime = &now
+}
+
+func (state *BuildState) finish(ctx workflow.Context, status Status) {
+	now := workflow.Now(ctx)
+	state.Status = status
+	state.EndTime = &now
+}
+
+// stageState finds the state of the stage among the children of the enclosing stage kept in the context.
+// The returned context makes the children of the stage visible to its parallel branches and nested stages.
+func stageState(ctx workflow.Context, name string) (workflow.Context, *StageState) {
+	siblings, _ := ctx.Value("stageStates").([]*StageState)
+	for _, state := range siblings {
+		if state.Name == name {
+			return workflow.WithValue(ctx, "stageStates", state.Stages), state
+		}
+	}
+	// not part of the snapshot, e.g. a stage added at runtime
+	state := &StageState{Name: name, Status: StatusPending}
+	return workflow.WithValue(ctx, "stageStates", state.Stages), state
+}
+
+func (state *StageState) start(ctx workflow.Context) {
+	now := workflow.Now(ctx)
+	state.Status = StatusRunning
+	state.StartTime = &now
+}
+
+func (state *StageState) finish(ctx workflow.Context, status Status) {
+	now := workflow.Now(ctx)
+	state.Status = status
+	state.EndTime = &now
+	state.CurrentStep = ""
+}
+
+// status maps a result onto the status of a finished build or stage
+func (r Result) status() Status {
+	switch r {
+	case Success:
+		return StatusSuccess
+	case Unstable:
+		return StatusUnstable
+	case Aborted:
+		return StatusAborted
+	}
+	return StatusFailed
+}
+
+func GetState(wfClient temporalClient.Client, workflowId string) (*BuildState, error) {
+	msgEncoded, err := wfClient.QueryWorkflow(context.Background(), workflowId, "", "state")
+	if err != nil {
+		return nil, err
+	}
+
+	var queryResult BuildState
+	if err := msgEncoded.Get(&queryResult); err != nil {
+		return nil, err
+	}
+	return &queryResult, nil
+}
@@ -0,0 +1,110 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestBuildState(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		stages {
+			stage('Build') {
+				parallel {
+					stage('Linux') {
+						steps {
+							sh 'make linux'
+						}
+					}
+					stage('Windows') {
+						steps {
+							sh 'make windows'
+						}
+					}
+				}
+			}
+			stage('Deploy') {
+				when {
+					branch 'release/*'
+				}
+				steps {
+					sh 'make deploy'
+				}
+			}
+			stage('Test') {
+				steps {
+					echo 'Testing'
+					sh 'make check'
+				}
+			}
+			stage('Publish') {
+				steps {
+					sh 'make publish'
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			_, params := steps[len(steps)-1].ToCommand()
+			if params["text"] == "make check" {
+				return nil, temporal.NewNonRetryableApplicationError("tests failed", commandErrType, nil)
+			}
+			return []string{params["text"].(string)}, nil
+		})
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{})
+	if env.GetWorkflowError() == nil {
+		t.Fatalf("Expected the workflow to fail")
+	}
+
+	encoded, err := env.QueryWorkflow("state")
+	if err != nil {
+		t.Fatalf("Failed to query state: %v", err)
+	}
+	var state BuildState
+	if err := encoded.Get(&state); err != nil {
+		t.Fatalf("Failed to decode state: %v", err)
+	}
+
+	want := BuildState{
+		Status: StatusFailed,
+		Stages: []*StageState{
+			{Name: "Build", Status: StatusSuccess, Stages: []*StageState{
+				{Name: "Linux", Status: StatusSuccess},
+				{Name: "Windows", Status: StatusSuccess},
+			}},
+			{Name: "Deploy", Status: StatusSkipped},
+			{Name: "Test", Status: StatusFailed},
+			{Name: "Publish", Status: StatusPending},
+		},
+	}
+	ignoreTimes := cmpopts.IgnoreFields(BuildState{}, "StartTime", "EndTime")
+	ignoreStageTimes := cmpopts.IgnoreFields(StageState{}, "StartTime", "EndTime")
+	if diff := cmp.Diff(state, want, ignoreTimes, ignoreStageTimes); diff != "" {
+		t.Errorf("Unexpected state (-got +want):\n%s", diff)
+	}
+	if state.StartTime == nil || state.EndTime == nil || state.Stages[2].EndTime == nil || state.Stages[3].StartTime != nil {
+		t.Errorf("Unexpected start and end times: %+v", state)
+	}
+}
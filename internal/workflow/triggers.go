@@ -0,0 +1,66 @@
+package workflow
+
+import (
+	"strings"
+)
+
+// resultOrdinals orders the results from the best to the worst, like hudson.model.Result
+var resultOrdinals = map[Result]int{
+	Success:  0,
+	Unstable: 1,
+	Failure:  2,
+	Aborted:  4,
+}
+
+// BuildResult maps the error a build ended with, e.g. the one returned by WorkflowRun.Get, onto its result
+func BuildResult(err error) Result {
+	return resultOf(err)
+}
+
+// IsBetterOrEqualTo reports whether the result is at least as good as the other one
+func (r Result) IsBetterOrEqualTo(other Result) bool {
+	return resultOrdinals[r] <= resultOrdinals[other]
+}
+
+// Names returns the jobs listed by upstreamProjects, e.g. 'folder/job1, job2'
+func (upstream *Upstream) Names() []string {
+	var names []string
+	for _, name := range strings.Split(upstream.Projects.Literal(), ",") {
+		if name = strings.Trim(strings.TrimSpace(name), "/"); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ThresholdResult is the worst result of an upstream build which still triggers a build, SUCCESS by default
+func (upstream *Upstream) ThresholdResult() Result {
+	if upstream.Threshold == "" {
+		return Success
+	}
+	// the grammar only lets SUCCESS, UNSTABLE and FAILURE through, with or without hudson.model.Result
+	return Result(upstream.Threshold)
+}
+
+// Checkouts returns the parameters of the git steps of the pipeline, they tell which repositories to poll.
+// Values which are only known at runtime, e.g. ${params.BRANCH}, are left as they are.
+func (pipeline *Pipeline) Checkouts() []map[string]interface{} {
+	var checkouts []map[string]interface{}
+	var walk func(stages []*Stage)
+	walk = func(stages []*Stage) {
+		for _, stage := range stages {
+			for _, step := range stage.Steps {
+				if command, params := step.ToCommand(); command == "git" {
+					checkouts = append(checkouts, params)
+				}
+			}
+			walk(stage.Parallel)
+			walk(stage.Stages)
+			if stage.Matrix != nil {
+				walk(stage.Matrix.Stages)
+			}
+		}
+	}
+	walk(pipeline.Stages)
+	return checkouts
+}
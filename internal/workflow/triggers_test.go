@@ -0,0 +1,94 @@
+package workflow
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTriggers(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		triggers {
+			cron('H 2 * * *')
+			pollSCM('H/5 * * * *')
+			upstream(upstreamProjects: 'lib, folder/tools', threshold: hudson.model.Result.UNSTABLE)
+		}
+		stages {
+			stage('Checkout') {
+				steps {
+					git url: 'git@github.com:org/repo.git', branch: 'main'
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	cron := QuotedString("H 2 * * *")
+	pollSCM := QuotedString("H/5 * * * *")
+	want := Triggers{
+		{Cron: &cron},
+		{PollSCM: &pollSCM},
+		{Upstream: &Upstream{Projects: "lib, folder/tools", Threshold: "UNSTABLE"}},
+	}
+	if diff := cmp.Diff(pipeline.Triggers, want); diff != "" {
+		t.Errorf("Triggers are not equal (-got +want):\n%s", diff)
+	}
+
+	upstream := pipeline.Triggers[2].Upstream
+	if diff := cmp.Diff(upstream.Names(), []string{"lib", "folder/tools"}); diff != "" {
+		t.Errorf("Unexpected upstream jobs (-got +want):\n%s", diff)
+	}
+	if upstream.ThresholdResult() != Unstable {
+		t.Errorf("Expected threshold UNSTABLE, got %s", upstream.ThresholdResult())
+	}
+
+	checkouts := []map[string]interface{}{{"url": "git@github.com:org/repo.git", "branch": "main"}}
+	if diff := cmp.Diff(pipeline.Checkouts(), checkouts); diff != "" {
+		t.Errorf("Unexpected checkouts (-got +want):\n%s", diff)
+	}
+}
+
+func TestInvalidThreshold(t *testing.T) {
+	dslParser := DslParser{}
+	for _, threshold := range []string{"FAILURE", "hudson.model.Result.SUCCESS"} {
+		pipeline, err := dslParser.Parse(`pipeline { agent none triggers { upstream(upstreamProjects: 'lib', threshold: ` + threshold + `) } stages { stage('Build') { steps { echo 'build' } } } }`)
+		if err != nil {
+			t.Errorf("Failed to parse threshold %s: %v", threshold, err)
+		} else if got := pipeline.Triggers[0].Upstream.ThresholdResult(); !strings.HasSuffix(threshold, string(got)) {
+			t.Errorf("Expected threshold %s, got %s", threshold, got)
+		}
+	}
+	for _, threshold := range []string{"hudson.model.Result.ABORTED", "hudson.model.Result.UNSTALBE", "SUCCES"} {
+		if _, err := dslParser.Parse(`pipeline { agent none triggers { upstream(upstreamProjects: 'lib', threshold: ` + threshold + `) } stages { stage('Build') { steps { echo 'build' } } } }`); err == nil {
+			t.Errorf("Expected threshold %s to be rejected", threshold)
+		}
+	}
+}
+
+func TestResultIsBetterOrEqualTo(t *testing.T) {
+	for _, tt := range []struct {
+		result    Result
+		threshold Result
+		want      bool
+	}{
+		{Success, Success, true},
+		{Unstable, Success, false},
+		{Unstable, Unstable, true},
+		{Success, Failure, true},
+		{Aborted, Failure, false},
+	} {
+		if got := tt.result.IsBetterOrEqualTo(tt.threshold); got != tt.want {
+			t.Errorf("%s.IsBetterOrEqualTo(%s) = %v, want %v", tt.result, tt.threshold, got, tt.want)
+		}
+	}
+}
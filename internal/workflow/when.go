@@ -0,0 +1,68 @@
+package workflow
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Conditions are evaluated inside the workflow before any agent is allocated,
+// so 'beforeAgent' is accepted for compatibility but doesn't change the behaviour.
+
+// evaluate reports whether all when conditions hold in the given scope
+func (when *When) evaluate(sc *scope) (bool, error) {
+	for _, condition := range when.Conditions {
+		if ok, err := condition.evaluate(sc); !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (condition *Condition) evaluate(sc *scope) (bool, error) {
+	switch {
+	case condition.Branch != nil:
+		matched, err := filepath.Match(condition.Branch.Literal(), sc.env["BRANCH_NAME"])
+		return err == nil && matched, nil
+	case condition.Environment != nil:
+		value, ok := sc.env[condition.Environment.Name.Literal()]
+		return ok && value == condition.Environment.Value.Literal(), nil
+	case condition.Expression != nil:
+		value, err := condition.Expression.evaluate(sc)
+		return isTruthy(value), err
+	case condition.Not != nil:
+		ok, err := condition.Not.evaluate(sc)
+		return !ok, err
+	case len(condition.AllOf) > 0:
+		for _, c := range condition.AllOf {
+			if ok, err := c.evaluate(sc); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case len(condition.AnyOf) > 0:
+		for _, c := range condition.AnyOf {
+			if ok, err := c.evaluate(sc); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+	return false, nil
+}
+
+// branch returns the branch checked out by the first git step of the pipeline, e.g. main, which is the branch
+// the build is for. Branches given by parameters, e.g. ${params.BRANCH}, are interpolated within the scope.
+func (pipeline *Pipeline) branch(sc *scope) string {
+	for _, checkout := range pipeline.Checkouts() {
+		branch, _ := checkout["branch"].(string)
+		if branch == "" {
+			continue
+		}
+		branch, err := interpolate(branch, sc)
+		if err != nil {
+			continue
+		}
+		return strings.TrimPrefix(branch, "refs/heads/")
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestWhenConditions(t *testing.T) {
+
+	sc := &scope{
+		env: map[string]string{
+			"BRANCH_NAME": "release-1.2",
+			"DEPLOY_TO":   "production",
+			"DRY_RUN":     "",
+		},
+		params: map[string]any{
+			"SKIP_TESTS": false,
+		},
+	}
+
+	tests := []struct {
+		when string
+		want bool
+	}{
+		{`branch 'release-*'`, true},
+		{`branch 'main'`, false},
+		{`environment name: 'DEPLOY_TO', value: 'production'`, true},
+		{`environment name: 'DEPLOY_TO', value: 'staging'`, false},
+		{`not { branch 'main' }`, true},
+		{`allOf { branch 'release-*'; environment name: 'DEPLOY_TO', value: 'production' }`, true},
+		{`anyOf { branch 'main'; environment name: 'DEPLOY_TO', value: 'staging' }`, false},
+		{`expression { return env.DEPLOY_TO == 'production' && !DRY_RUN }`, true},
+		{`expression { env.BRANCH_NAME != 'release-1.2' || UNDEFINED }`, false},
+		{`beforeAgent true
+		  expression { (DEPLOY_TO == 'staging') || true }`, true},
+		{`expression { false }`, false},
+		{`expression { params.SKIP_TESTS }`, false},
+		{`expression { !params.SKIP_TESTS && params.UNDEFINED == null }`, true},
+	}
+
+	dslParser := DslParser{}
+	for _, test := range tests {
+		jenkinsfile := `
+		pipeline {
+			agent none
+			stages {
+				stage('Deploy') {
+					when { ` + test.when + ` }
+					steps {
+						echo 'Deploying'
+					}
+				}
+			}
+		}
+		`
+		pipeline, err := dslParser.Parse(jenkinsfile)
+		if err != nil {
+			t.Fatalf("Failed to parse when { %s }: %v", test.when, err)
+		}
+
+		got, err := pipeline.Stages[0].When.evaluate(sc)
+		if err != nil {
+			t.Fatalf("Failed to evaluate when { %s }: %v", test.when, err)
+		}
+		if got != test.want {
+			t.Errorf("when { %s } = %v, want %v", test.when, got, test.want)
+		}
+	}
+}
+
+func TestWhenBranch(t *testing.T) {
+
+	jenkinsfile := `
+    pipeline {
+		agent none
+		parameters {
+			string(name: 'BRANCH', defaultValue: 'main')
+		}
+		stages {
+			stage('Checkout') {
+				steps {
+					git url: 'git@github.com:org/repo.git', branch: "${params.BRANCH}"
+				}
+			}
+			stage('Release') {
+				when { branch 'release-*' }
+				steps {
+					echo "Releasing ${BRANCH_NAME}"
+				}
+			}
+			stage('Nightly') {
+				when { branch 'main' }
+				steps {
+					echo 'Nightly'
+				}
+			}
+		}
+	}
+    `
+
+	dslParser := DslParser{}
+	pipeline, err := dslParser.Parse(jenkinsfile)
+	if err != nil {
+		t.Fatalf("Failed to parse Jenkinsfile: %v", err)
+	}
+
+	var testSuite testsuite.WorkflowTestSuite
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterActivity(&StageActivities{})
+
+	env.OnActivity("StageActivity", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, steps []*Step, agent Agent, stageContext StageContext) ([]string, error) {
+			command, params, err := steps[0].resolve(&scope{env: stageContext.Variables, params: stageContext.Params})
+			if err != nil || command == "git" {
+				return nil, err
+			}
+			return []string{params["text"].(string)}, nil
+		})
+
+	env.ExecuteWorkflow(GroovyDSLWorkflow, *pipeline, map[string]interface{}{
+		"params": map[string]any{"BRANCH": "release-1.2"},
+	})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	var results map[string]any
+	if err := env.GetWorkflowResult(&results); err != nil {
+		t.Fatalf("Failed to get workflow result: %v", err)
+	}
+	want := map[string]any{
+		"Checkout": nil,
+		"Release":  []any{"Releasing release-1.2"},
+		"Nightly":  Skipped,
+	}
+	if diff := cmp.Diff(results, want); diff != "" {
+		t.Errorf("Unexpected results (-got +want):\n%s", diff)
+	}
+}
@@ -1,115 +1,412 @@
 package workflow
 
 import (
-	"context"
-	"fmt"
-	"os"
+	"errors"
+	"strconv"
 	"time"
 
-	temporalClient "go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
+
+	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
 )
 
 const (
-	Undefined State = -1
-	Pending   State = 0
-	Started   State = 1
-	Running   State = 2
-	Done      State = 3
+	Success  Result = "SUCCESS"
+	Unstable Result = "UNSTABLE"
+	Failure  Result = "FAILURE"
+	Aborted  Result = "ABORTED"
+
+	// Skipped is recorded in the results in place of the output of a stage that didn't run
+	Skipped = "skipped"
+
+	// unstableErrType is the application error type reported by stages marked as unstable
+	unstableErrType = "unstable"
 )
 
 type (
-	State int64
+	// Result is the outcome of a stage or a whole pipeline run
+	Result string
 	
 	executable interface {
 		execute(ctx workflow.Context, variables map[string]string, results map[string]any) error
 	}
 )
 
-var (
-	currentState State = Undefined
-)
-
 func GroovyDSLWorkflow(ctx workflow.Context, pipeline Pipeline, properties map[string]interface{}) (map[string]any, error) {
-	currentState = Started
+	// the state belongs to this execution, builds running in the same worker don't share it
+	state := newBuildState(&pipeline)
+	results := make(map[string]any)
 
 	logger := workflow.GetLogger(ctx)
 	// setup query handler for query type "state"
-	err := workflow.SetQueryHandler(ctx, "state", func(input []byte) (State, error) {
-		return currentState, nil
+	err := workflow.SetQueryHandler(ctx, "state", func() (*BuildState, error) {
+		return state, nil
+	})
+	if err != nil {
+		logger.Info("SetQueryHandler failed: " + err.Error())
+		return nil, err
+	}
+	// results are kept for failed builds as well, a restarted build carries them over
+	err = workflow.SetQueryHandler(ctx, "results", func() (map[string]any, error) {
+		return results, nil
 	})
 	if err != nil {
 		logger.Info("SetQueryHandler failed: " + err.Error())
 		return nil, err
 	}
+	skipped, previousResults, err := restartPoint(pipeline.Stages, properties)
+	if err != nil {
+		return nil, err
+	}
 
-	variables := make(map[string]string)
-	results := make(map[string]any)
+	// aborting a build cancels the context the stages run in, post actions run in a disconnected one
+	rootCtx := ctx
+	ctx, cancel := workflow.WithCancel(ctx)
+	ctx = workflow.WithValue(ctx, "control", handleSignals(rootCtx, state, cancel))
 
-	fmt.Printf("Temporal address: %s\n", os.Getenv("TEMPORAL_ADDRESS"))
-	
-	currentState = Running
-	for _, stage := range pipeline.Stages {
-		if err := stage.execute(ctx, variables, results); err != nil {
-			// return nil, err
+	ctx = workflow.WithActivityOptions(ctx, pipeline.Options.activityOptions(defaultActivityOptions))
+	ctx = workflow.WithValue(ctx, "stageStates", state.Stages)
+	ctx = workflow.WithValue(ctx, "inputValues", make(map[string]string))
+	if timeout, ok := pipeline.Options.timeout(); ok {
+		ctx = workflow.WithValue(ctx, "inputTimeout", timeout)
+	}
+
+	// build parameters are visible as params.NAME and as environment variables,
+	// the passwords are bound by the stages from the secrets they're kept in
+	params, _ := properties["params"].(map[string]any)
+	params, passwords := pipeline.Parameters.passwords(params)
+	ctx = workflow.WithValue(ctx, "params", params)
+	ctx = workflow.WithValue(ctx, "passwords", passwords)
+	encryptedPasswords, err := readPasswords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = workflow.WithValue(ctx, "encryptedPasswords", encryptedPasswords)
+	ctx = workflow.WithValue(ctx, "properties", properties)
+	ctx = workflow.WithValue(ctx, "agentLabel", pipeline.Agent.label())
+	ctx = workflow.WithValue(ctx, "reusedContainers", make(map[string]string))
+	ctx = workflow.WithValue(ctx, "credentials", pipeline.Environment.credentials(nil))
+	variables, err := pipeline.Environment.merge(buildEnv(&pipeline, properties, params), params)
+	if err != nil {
+		return nil, err
+	}
+
+	state.start(ctx)
+	result := Success
+	var pipelineErr error
+	for i, stage := range pipeline.Stages {
+		if i < skipped {
+			// restarted builds keep the results of the stages before the restart point
+			state.Stages[i].skipFromPreviousRun()
+			if previous, ok := previousResults[stage.Name.Literal()]; ok {
+				results[stage.Name.Literal()] = previous
+			}
+			continue
+		}
+		err := stage.execute(ctx, variables, results)
+		result = result.combine(resultOf(err))
+		if result.stops() {
 			logger.Error(err.Error())
+			pipelineErr = err
 			break
 		}
 	}
 
-	logger.Info("Groovy Workflow completed.")
-	currentState = Done
-	return results, nil
+	if pipeline.Post != nil {
+		err := pipeline.Post.execute(postContext(ctx, result), "Declarative: Post Actions", pipeline.Agent, result, variables, results)
+		if err != nil && pipelineErr == nil {
+			pipelineErr = err
+		}
+	}
+
+	removeReusedContainers(postContext(ctx, result))
+
+	logger.Info("Groovy Workflow completed.", "result", result)
+	result = resultOf(pipelineErr).combine(result)
+	state.finish(ctx, result.status())
+	recordBuild(postContext(ctx, result), &pipeline, state, properties, results, result)
+	buildCompleted(postContext(ctx, result), properties, result)
+	deletePasswords(postContext(ctx, result))
+	if result == Aborted {
+		return results, temporal.NewNonRetryableApplicationError("build aborted", abortedErrType, nil)
+	}
+	if result == Unstable && pipelineErr == nil {
+		// lets the upstream build and the queue tell unstable builds from successful ones
+		return results, temporal.NewNonRetryableApplicationError("build is unstable", unstableErrType, nil)
+	}
+	return results, pipelineErr
 }
 
-func GetState(wfClient temporalClient.Client, workflowId string) (State, error) {
-	msgEncoded, err := wfClient.QueryWorkflow(context.Background(), workflowId, "", "state")
-	if err != nil {
-		return Undefined, err
+// buildEnv returns the environment variables of a build: the parameters, the job name and the build number
+// of a job build, and BRANCH_NAME, the branch checked out by the pipeline
+func buildEnv(pipeline *Pipeline, properties map[string]interface{}, params map[string]any) map[string]string {
+	variables := toEnv(params)
+	if branch := pipeline.branch(&scope{env: variables, params: params}); branch != "" {
+		variables["BRANCH_NAME"] = branch
 	}
-	
-	var queryResult State
-	msgEncoded.Get(&queryResult)
-	return queryResult, nil
+	if jobName, ok := properties["jobName"].(string); ok {
+		variables["JOB_NAME"] = jobs.ShortName(jobName)
+	}
+	if buildNumber, ok := properties["buildNumber"].(string); ok {
+		variables["BUILD_NUMBER"] = buildNumber
+		variables["BUILD_ID"] = buildNumber
+	}
+	return variables
+}
+
+// postContext returns the context to run post actions in, they still run when the build is aborted
+func postContext(ctx workflow.Context, result Result) workflow.Context {
+	if result != Aborted {
+		return ctx
+	}
+	postCtx, _ := workflow.NewDisconnectedContext(ctx)
+	return postCtx
 }
 
 func (stage *Stage) execute(ctx workflow.Context, variables map[string]string, results map[string]any) error {
+	ctx, state := stageState(ctx, stage.Name.Literal())
+	ctx = workflow.WithValue(ctx, "currentStage", state)
+	state.start(ctx)
+
+	err := stage.executeStage(ctx, variables, results)
+	if results[stage.Name.Literal()] == Skipped {
+		state.finish(ctx, StatusSkipped)
+	} else {
+		state.finish(ctx, resultOf(err).status())
+	}
+	return err
+}
+
+func (stage *Stage) executeStage(ctx workflow.Context, variables map[string]string, results map[string]any) error {
+	// values approved in earlier input steps override pipeline environment, stage environment overrides both
+	params, _ := ctx.Value("params").(map[string]any)
+	if inputValues, _ := ctx.Value("inputValues").(map[string]string); len(inputValues) > 0 {
+		variables = overlay(variables, inputValues)
+	}
+	variables, err := stage.Environment.merge(variables, params)
+	if err != nil {
+		return err
+	}
+	bindings, _ := ctx.Value("credentials").(map[string]string)
+	ctx = workflow.WithValue(ctx, "credentials", stage.Environment.credentials(bindings))
+	if stage.Agent != nil {
+		// the agent of the stage replaces the one of the pipeline for its steps and nested stages
+		ctx = workflow.WithValue(ctx, "agentLabel", stage.Agent.label())
+	}
+
+	if stage.When != nil {
+		ok, err := stage.When.evaluate(&scope{env: variables, params: params})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			workflow.GetLogger(ctx).Info("Stage skipped due to when conditional", "stage", stage.Name)
+			results[stage.Name.Literal()] = Skipped
+			return nil
+		}
+	}
+
+	if len(stage.Options) > 0 {
+		ctx = workflow.WithActivityOptions(ctx, stage.Options.activityOptions(workflow.GetActivityOptions(ctx)))
+		if timeout, ok := stage.Options.timeout(); ok {
+			ctx = workflow.WithValue(ctx, "inputTimeout", timeout)
+		}
+	}
+
+	if stage.Input != nil {
+		values, _, err := stage.Input.execute(ctx, variables)
+		if err != nil {
+			return err
+		}
+		recordInputValues(ctx, values, variables)
+	}
+
+	err = stage.executeBody(ctx, variables, results)
+	if stage.Post != nil {
+		postErr := stage.Post.execute(postContext(ctx, resultOf(err)), stage.Name.Literal()+": Post Actions", stage.Agent, resultOf(err), variables, results)
+		if !resultOf(err).stops() && postErr != nil {
+			err = postErr
+		}
+	}
+	return err
+}
+
+func (stage *Stage) executeBody(ctx workflow.Context, variables map[string]string, results map[string]any) error {
 	if len(stage.Parallel) > 0 {
 		parallelResults := make(map[string]any)
 		err := stage.Parallel.execute(ctx, variables, parallelResults)
+		if resultOf(err).stops() {
+			return err
+		}
+		results[stage.Name.Literal()] = parallelResults
 		if err != nil {
 			return err
 		}
-		results[string(stage.Name)] = parallelResults
 	}
 
-	if err := stage.executeSteps(ctx, variables, results); err != nil {
-		return err
+	if len(stage.Stages) > 0 {
+		return stage.executeStages(ctx, variables, results)
+	}
+
+	if stage.Matrix != nil {
+		matrixResults := make(map[string]any)
+		results[stage.Name.Literal()] = matrixResults
+		return stage.Matrix.execute(ctx, variables, matrixResults)
 	}
-	return nil
+
+	return stage.executeSteps(ctx, variables, results)
+}
+
+// executeStages runs nested stages one after another, their results are nested under the stage name
+func (stage *Stage) executeStages(ctx workflow.Context, variables map[string]string, results map[string]any) error {
+	nestedResults := make(map[string]any)
+	results[stage.Name.Literal()] = nestedResults
+
+	result := Success
+	var err error
+	for _, nested := range stage.Stages {
+		nestedErr := nested.execute(ctx, variables, nestedResults)
+		result = result.combine(resultOf(nestedErr))
+		if result.stops() {
+			return nestedErr
+		}
+		if nestedErr != nil {
+			err = nestedErr
+		}
+	}
+	return err
 }
 
 func (stage *Stage) executeSteps(ctx workflow.Context, variables map[string]string, results map[string]any) error {
 	if len(stage.Steps) == 0 {
 		return nil
 	}
+
+	result, err := executeSteps(ctx, stage.Steps, stage.Agent, variables)
+	if resultOf(err).stops() {
+		return err
+	}
+	results[stage.Name.Literal()] = result
+	return err
+}
+
+// executeSteps runs the steps of a stage or of a post condition. Consecutive steps run in a single activity,
+// script blocks, input, build, stash and unstash steps are handled by the workflow in between. It stops at
+// the first step which stops the build, an unstable step only makes the returned error unstable.
+func executeSteps(ctx workflow.Context, steps []*Step, agent *Agent, variables map[string]string) ([]string, error) {
+	var result []string
+	var err error
+	ctx = pinNode(ctx, steps)
+	for start := 0; start < len(steps); {
+		end := start
+		for end < len(steps) && !steps[end].runsInWorkflow() {
+			end++
+		}
+
+		var output []string
+		var stepErr error
+		if end > start {
+			output, stepErr = executeStageActivity(ctx, steps[start:end], agent, variables)
+			start = end
+		} else if steps[start].Script != nil {
+			output, stepErr = steps[start].Script.execute(ctx, agent, variables)
+			start++
+		} else if steps[start].Name() == "build" {
+			output, stepErr = executeBuild(ctx, steps[start], variables)
+			start++
+		} else if name := steps[start].Name(); name == "stash" || name == "unstash" {
+			output, stepErr = executeStash(ctx, steps[start], agent, variables)
+			start++
+		} else {
+			output, _, stepErr = executeInput(ctx, steps[start], variables)
+			start++
+		}
+
+		result = append(result, output...)
+		if resultOf(stepErr).stops() {
+			return result, stepErr
+		}
+		if stepErr != nil {
+			err = stepErr
+		}
+	}
+	return result, err
+}
+
+// executeStageActivity runs the steps as a single StageActivity on the given agent, see stageTaskQueue.
+// Timeout and retry policy come from the activity options set by the pipeline and stage options.
+// Credentials are passed by id and passwords encrypted, the activity binds them, so secrets never reach the workflow history.
+func executeStageActivity(ctx workflow.Context, steps []*Step, agent *Agent, variables map[string]string) ([]string, error) {
 	var result []string
 
-	ao := workflow.ActivityOptions{
-		StartToCloseTimeout: time.Minute * 5,
-		RetryPolicy: &temporal.RetryPolicy{
-			MaximumAttempts: 3,
-		},
+	if err := awaitResumed(ctx); err != nil {
+		return result, err
+	}
+	if state, ok := ctx.Value("currentStage").(*StageState); ok && len(steps) > 0 {
+		state.CurrentStep = steps[0].Name()
 	}
-	ctx = workflow.WithActivityOptions(ctx, ao)
 
-	err := workflow.ExecuteActivity(ctx, "StageActivity", stage.Steps, stage.Agent).Get(ctx, &result)
+	params, _ := ctx.Value("params").(map[string]any)
+	credentials, _ := ctx.Value("credentials").(map[string]string)
+	passwords, _ := ctx.Value("encryptedPasswords").(map[string]string)
+	properties, _ := ctx.Value("properties").(map[string]interface{})
+	jobName, _ := properties["jobName"].(string)
+	buildNumber, _ := strconv.Atoi(toString(properties["buildNumber"]))
+	stageContext := StageContext{
+		Variables:   variables,
+		Params:      params,
+		Credentials: credentials,
+		Passwords:   passwords,
+		JobName:     jobName,
+		BuildNumber: buildNumber,
+	}
+	ctx, err := stageTaskQueue(ctx, agent, variables)
 	if err != nil {
-		return err
+		return result, err
 	}
-	results[string(stage.Name)] = result
-	return nil
+	err = workflow.ExecuteActivity(ctx, "StageActivity", steps, agent, stageContext).Get(ctx, &result)
+
+	// unstable stages still report the output of their steps
+	var appErr *temporal.ApplicationError
+	if resultOf(err) == Unstable && errors.As(err, &appErr) && appErr.HasDetails() {
+		appErr.Details(&result)
+	}
+	return result, err
+}
+
+// stageTaskQueue returns the context the activities of the steps are dispatched with, on the task queue of the agent.
+// Stages with a label are dispatched to the task queue the API picks for the label expression.
+func stageTaskQueue(ctx workflow.Context, agent *Agent, variables map[string]string) (workflow.Context, error) {
+	pinned, _ := ctx.Value("pinnedNode").(*pinnedNode)
+	if pinned != nil && pinned.taskQueue != "" {
+		return workflow.WithTaskQueue(ctx, pinned.taskQueue), nil
+	}
+	if label, _ := ctx.Value("agentLabel").(string); label != "" {
+		params, _ := ctx.Value("params").(map[string]any)
+		expression, err := interpolate(label, &scope{env: variables, params: params})
+		if err != nil {
+			return ctx, err
+		}
+		if _, err := ParseLabelExpression(expression); err != nil {
+			return ctx, err
+		}
+		// the API knows which nodes poll the queue of the expression, and which nodes match it
+		var taskQueue string
+		routeCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+			TaskQueue:           NodesTaskQueue,
+			StartToCloseTimeout: time.Minute,
+		})
+		if err := workflow.ExecuteActivity(routeCtx, "LabelTaskQueueActivity", expression).Get(ctx, &taskQueue); err != nil {
+			return ctx, err
+		}
+		ctx = workflow.WithTaskQueue(ctx, taskQueue)
+	}
+	ctx, err := reuseNode(ctx, agent)
+	if err != nil || pinned == nil {
+		return ctx, err
+	}
+	return pinned.pin(ctx)
 }
 
 func (p Parallel) execute(ctx workflow.Context, variables map[string]string, results map[string]any) error {
@@ -120,14 +417,17 @@ func (p Parallel) execute(ctx workflow.Context, variables map[string]string, res
 
 	// In the parallel block, we want to execute all of them in parallel and wait for all of them.
 	// if one activity fails then we want to cancel all the rest of them as well.
+	// An unstable branch doesn't cancel the others, it only marks the whole block as unstable.
 	childCtx, cancelHandler := workflow.WithCancel(ctx)
 	selector := workflow.NewSelector(ctx)
-	var activityErr error
+	var activityErr, unstableErr error
 	for _, s := range p {
 		f := executeAsync(s, childCtx, variables, results)
 		selector.AddFuture(f, func(f workflow.Future) {
 			err := f.Get(ctx, nil)
-			if err != nil {
+			if resultOf(err) == Unstable {
+				unstableErr = err
+			} else if err != nil {
 				// cancel all pending activities
 				cancelHandler()
 				activityErr = err
@@ -142,7 +442,7 @@ func (p Parallel) execute(ctx workflow.Context, variables map[string]string, res
 		}
 	}
 
-	return nil
+	return unstableErr
 }
 
 func executeAsync(exe executable, ctx workflow.Context, variables map[string]string, results map[string]any) workflow.Future {
@@ -154,8 +454,100 @@ func executeAsync(exe executable, ctx workflow.Context, variables map[string]str
 	return future
 }
 
+// resultOf maps an execution error onto the stage result
+func resultOf(err error) Result {
+	if err == nil {
+		return Success
+	}
+	if temporal.IsCanceledError(err) {
+		return Aborted
+	}
+	var appErr *temporal.ApplicationError
+	if errors.As(err, &appErr) && appErr.Type() == unstableErrType {
+		return Unstable
+	}
+	if errors.As(err, &appErr) && appErr.Type() == abortedErrType {
+		return Aborted
+	}
+	return Failure
+}
+
+// combine returns the worse of two results
+func (r Result) combine(other Result) Result {
+	if r == Aborted || other == Aborted {
+		return Aborted
+	}
+	if r == Failure || other == Failure {
+		return Failure
+	}
+	if r == Unstable || other == Unstable {
+		return Unstable
+	}
+	return Success
+}
+
+// stops reports whether the result prevents the remaining stages from running
+func (r Result) stops() bool {
+	return r == Failure || r == Aborted
+}
+
+// merge returns a copy of variables with the environment block values applied on top.
+// Values are interpolated in order, so a variable can refer to the ones defined before it.
+func (env Environment) merge(variables map[string]string, params map[string]any) (map[string]string, error) {
+	merged := make(map[string]string, len(variables)+len(env))
+	for name, value := range variables {
+		merged[name] = value
+	}
+	sc := &scope{env: merged, params: params}
+	for _, envVar := range env {
+		if envVar.Credentials != nil {
+			// bound by the activity
+			delete(merged, envVar.Name)
+			continue
+		}
+		value, err := interpolate(string(envVar.Value), sc)
+		if err != nil {
+			return nil, err
+		}
+		merged[envVar.Name] = value
+	}
+	return merged, nil
+}
+
+// overlay returns a copy of variables with values applied on top
+func overlay(variables map[string]string, values map[string]string) map[string]string {
+	merged := make(map[string]string, len(variables)+len(values))
+	for name, value := range variables {
+		merged[name] = value
+	}
+	for name, value := range values {
+		merged[name] = value
+	}
+	return merged
+}
+
+// credentials returns a copy of bindings with the credentials() variables of the environment block applied on top
+func (env Environment) credentials(bindings map[string]string) map[string]string {
+	merged := make(map[string]string, len(bindings))
+	for name, credentialsId := range bindings {
+		merged[name] = credentialsId
+	}
+	for _, envVar := range env {
+		if envVar.Credentials != nil {
+			merged[envVar.Name] = envVar.Credentials.Literal()
+		} else {
+			delete(merged, envVar.Name)
+		}
+	}
+	return merged
+}
+
 func (step *Step) Name() string {
-	if step.SingleKV != nil {
+	if step.Script != nil {
+		return "script"
+	} else if step.Build != nil {
+		return "build"
+	} else if step.SingleKV != nil {
 		return step.SingleKV.Command
 	} else if step.MultiKV != nil {
 		return step.MultiKV.Command
@@ -163,17 +555,53 @@ func (step *Step) Name() string {
 	return "Unknown"
 }
 
+// runsInWorkflow reports whether the step is interpreted by the workflow rather than run by StageActivity
+func (step *Step) runsInWorkflow() bool {
+	switch step.Name() {
+	case "script", "input", "build", "stash", "unstash":
+		return true
+	}
+	return false
+}
+
 func (step *Step) ToCommand() (string, map[string]interface{}) {
+	if step.Build != nil {
+		return "build", step.Build.params()
+	}
 	if step.SingleKV == nil && step.MultiKV == nil {
 		return "", nil
 	}
 	params := make(map[string]interface{})
 	if step.SingleKV != nil {
-		params["text"] = string(step.SingleKV.Value)
+		params["text"] = step.SingleKV.Value.Literal()
 		return step.SingleKV.Command, params
 	}
 	for _, p := range step.MultiKV.Params {
-		params[p.Key] = string(p.Value)
+		params[p.Key] = p.Value.Literal()
 	}
 	return step.MultiKV.Command, params
 }
+
+// resolve works like ToCommand but interpolates the values of the step within the scope
+func (step *Step) resolve(sc *scope) (string, map[string]interface{}, error) {
+	if step.SingleKV == nil && step.MultiKV == nil {
+		return "", map[string]interface{}{}, nil
+	}
+	params := make(map[string]interface{})
+	if step.SingleKV != nil {
+		text, err := interpolate(string(step.SingleKV.Value), sc)
+		if err != nil {
+			return "", nil, err
+		}
+		params["text"] = text
+		return step.SingleKV.Command, params, nil
+	}
+	for _, p := range step.MultiKV.Params {
+		value, err := interpolate(string(p.Value), sc)
+		if err != nil {
+			return "", nil, err
+		}
+		params[p.Key] = value
+	}
+	return step.MultiKV.Command, params, nil
+}
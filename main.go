@@ -1,15 +1,16 @@
 package main
 
 import (
-	"fmt"
 	"log"
+	"log/slog"
+	"os"
 
 	temporal "go.temporal.io/sdk/client"
+	temporalLog "go.temporal.io/sdk/log"
 
 	"github.com/yegor86/tumbler-doll/cmd"
 	"github.com/yegor86/tumbler-doll/internal/cryptography"
 	"github.com/yegor86/tumbler-doll/internal/env"
-	"github.com/yegor86/tumbler-doll/internal/jenkins/jobs"
 )
 
 func main() {
@@ -17,21 +18,16 @@ func main() {
 	crypto := cryptography.GetInstance()
 	crypto.LoadOrSeedCrypto()
 
-	wfClient, err := temporal.Dial(temporal.Options{
+	// commands which don't talk to Temporal, e.g. lint, must work without a server
+	wfClient, err := temporal.NewLazyClient(temporal.Options{
 		HostPort: "localhost:7233",
+		Logger:   temporalLog.NewStructuredLogger(slog.New(slog.NewTextHandler(os.Stderr, nil))),
 	})
 	if err != nil {
 		log.Fatalf("Unable to create Workflow client: %v", err)
 	}
 	defer wfClient.Close()
 
-	jobDb := jobs.GetInstance()
-	jobs, err := jobDb.LoadJobs()
-	if err != nil {
-		panic(err)
-	}
-
-	fmt.Printf("Jobs: %v", jobs)
-
+	// the jobs are loaded by the commands which need them
 	cmd.Execute(wfClient)
 }
\ No newline at end of file
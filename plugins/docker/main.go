@@ -2,8 +2,13 @@ package docker
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/yegor86/tumbler-doll/internal/grpc"
 	"github.com/yegor86/tumbler-doll/plugins"
@@ -13,7 +18,9 @@ import (
 )
 
 type DockerPlugin struct {
-	dockerClient shared.DockerClient
+	clients      *shared.Clients
+	// engine is the container engine of the node, agents may choose another one
+	engine       string
 	streamClient *grpc.GrpcClient
 	ctx context.Context
 }
@@ -24,8 +31,10 @@ func (p *DockerPlugin) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to extract TEMPORAL_ADDRESS from context: %v", ctx.Value("temporalHostport"))
 	}
 
-	dockerClient, err := shared.NewDockerClient(ctx)
-	if err != nil {
+	// the engine of the node is connected right away, the other ones once an agent asks for them
+	engine, _ := ctx.Value("containerEngine").(string)
+	clients := shared.NewClients()
+	if _, err := clients.Get(ctx, engine); err != nil {
 		return err
 	}
 
@@ -34,7 +43,8 @@ func (p *DockerPlugin) Start(ctx context.Context) error {
 		return err
 	}
 	
-	p.dockerClient = dockerClient
+	p.clients = clients
+	p.engine = engine
 	p.streamClient = streamClient
 	p.ctx = ctx
 	return nil
@@ -45,14 +55,15 @@ func (p *DockerPlugin) Stop() error {
 	if err != nil {
 		return err
 	}
-	return p.dockerClient.Stop()
+	return p.clients.Stop()
 }
 
 func (p *DockerPlugin) ListMethods() map[string]string {
 	return map[string]string{}
 }
 
-func (p *DockerPlugin) Pull(ctx context.Context) error {
+// Pull pulls the image, authenticated with the registry when auth is given
+func (p *DockerPlugin) Pull(ctx context.Context, auth *shared.RegistryAuth) error {
 	workflowExecutionId, ok := ctx.Value("workflowExecutionId").(string)
 	if !ok {
 		return errors.New("unable to redirect DockerPlugin.Pull output. 'workflowExecutionId' not found")
@@ -63,7 +74,11 @@ func (p *DockerPlugin) Pull(ctx context.Context) error {
 		return fmt.Errorf("docker image type is wrong %v", imageName)
 	}
 
-	ioReader, err := p.dockerClient.Pull(p.ctx, imageName)
+	_, client, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	ioReader, err := client.Pull(p.ctx, imageName, auth)
 	if err != nil {
 		return err
 	}
@@ -75,14 +90,128 @@ func (p *DockerPlugin) Pull(ctx context.Context) error {
 	})
 }
 
-func (p *DockerPlugin) RunContainer(ctx context.Context) (string, error) {
+// BuildImage builds the image of the dockerfile agent and returns its name. The image is tagged by the hash
+// of the Dockerfile and the arguments, it's only built when there's no image with the tag yet.
+// The output of the build goes to the log of the build.
+func (p *DockerPlugin) BuildImage(ctx context.Context, options shared.BuildOptions, args string) (string, error) {
+	workflowExecutionId, ok := ctx.Value("workflowExecutionId").(string)
+	if !ok {
+		return "", errors.New("unable to redirect DockerPlugin.BuildImage output. 'workflowExecutionId' not found")
+	}
+	toReq := func(resp string) *logstream.LogRequest {
+		return &logstream.LogRequest{
+			Message:    resp,
+			WorkflowId: workflowExecutionId,
+		}
+	}
+
+	dockerfile, err := os.ReadFile(filepath.Join(options.ContextDir, options.Dockerfile))
+	if err != nil {
+		return "", err
+	}
+	if err := options.ParseArgs(args); err != nil {
+		return "", err
+	}
+	options.Tag = shared.DockerfileTag(dockerfile, args)
+
+	_, client, err := p.client(ctx)
+	if err != nil {
+		return "", err
+	}
+	exists, err := client.ImageExists(ctx, options.Tag)
+	if err != nil {
+		return "", err
+	}
+	if exists && !options.NoCache {
+		return options.Tag, p.streamClient.Stream.Send(toReq(fmt.Sprintf("Using image %s built from %s", options.Tag, options.Dockerfile)))
+	}
+
+	ioReader, err := client.BuildImage(ctx, options)
+	if err != nil {
+		return "", err
+	}
+	defer ioReader.Close()
+
+	// the daemon reports the output and the failure of the build as JSON messages
+	decoder := json.NewDecoder(ioReader)
+	for {
+		var message shared.BuildMessage
+		if err := decoder.Decode(&message); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		if message.Error != "" {
+			return "", fmt.Errorf("failed to build image from %s: %s", options.Dockerfile, message.Error)
+		}
+		for _, line := range strings.Split(strings.TrimRight(message.Stream, "\n"), "\n") {
+			if line == "" {
+				continue
+			}
+			if err := p.streamClient.Stream.Send(toReq(line)); err != nil {
+				return "", err
+			}
+		}
+	}
+	return options.Tag, nil
+}
+
+func (p *DockerPlugin) ImageExists(ctx context.Context, imageName string) (bool, error) {
+	_, client, err := p.client(ctx)
+	if err != nil {
+		return false, err
+	}
+	return client.ImageExists(ctx, imageName)
+}
+
+func (p *DockerPlugin) RunContainer(ctx context.Context, options shared.RunOptions) (string, error) {
 	imageName, ok := ctx.Value("imageName").(string)
 	if !ok {
 		return "", fmt.Errorf("docker image type is wrong %v", imageName)
 	}
-	return p.dockerClient.RunContainer(ctx, imageName)
+	engine, client, err := p.client(ctx)
+	if err != nil {
+		return "", err
+	}
+	containerId, err := client.RunContainer(ctx, imageName, options)
+	return shared.ContainerId(engine, containerId), err
 }
 
+// FindContainer returns the running container with the labels, e.g. the one kept for the stages of a build
+func (p *DockerPlugin) FindContainer(ctx context.Context, labels map[string]string) (string, error) {
+	engine, client, err := p.client(ctx)
+	if err != nil {
+		return "", err
+	}
+	containerId, err := client.FindContainer(ctx, labels)
+	return shared.ContainerId(engine, containerId), err
+}
+
+// RemoveContainers removes the containers with the labels from the engines used so far
+func (p *DockerPlugin) RemoveContainers(ctx context.Context, labels map[string]string) error {
+	var errs []error
+	for _, client := range p.clients.Connected() {
+		errs = append(errs, client.RemoveContainers(ctx, labels))
+	}
+	return errors.Join(errs...)
+}
+
+// StopContainer stops the container in the engine it was started by
 func (p *DockerPlugin) StopContainer(ctx context.Context, containerId string) error {
-	return p.dockerClient.StopContainer(ctx, containerId)
+	engine, id := shared.SplitContainerId(containerId)
+	client, err := p.clients.Get(ctx, engine)
+	if err != nil {
+		return err
+	}
+	return client.StopContainer(ctx, id)
+}
+
+// client returns the engine of the agent, given by the containerEngine of the context, or the one of the node
+func (p *DockerPlugin) client(ctx context.Context) (string, shared.DockerClient, error) {
+	engine, _ := ctx.Value("containerEngine").(string)
+	if engine == "" {
+		engine = p.engine
+	}
+	client, err := p.clients.Get(ctx, engine)
+	return engine, client, err
 }
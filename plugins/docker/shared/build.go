@@ -0,0 +1,173 @@
+package shared
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dockerfileRepository is the repository of the images built from Dockerfiles, they're tagged by content hash
+const dockerfileRepository = "tumbler-doll/dockerfile"
+
+// BuildMessage is the part of the JSON messages streamed by `docker build` that is read
+type BuildMessage struct {
+	Stream string `json:"stream,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BuildOptions is what `docker build` is given for the dockerfile agent
+type BuildOptions struct {
+	// ContextDir is sent to the daemon as the build context
+	ContextDir string
+	// Dockerfile is relative to ContextDir
+	Dockerfile string
+	Tag        string
+	BuildArgs  map[string]*string
+	Target     string
+	Pull       bool
+	NoCache    bool
+}
+
+// ParseArgs adds the arguments given to `docker build`, e.g. the additionalBuildArgs of the dockerfile agent:
+// --build-arg, --target, --pull and --no-cache are supported
+func (options *BuildOptions) ParseArgs(args string) error {
+	words, err := splitArgs(args)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(words); i++ {
+		name, value, hasValue := strings.Cut(words[i], "=")
+		if !hasValue && (name == "--build-arg" || name == "--target") {
+			if i+1 == len(words) {
+				return fmt.Errorf("%s requires a value", name)
+			}
+			i++
+			value = words[i]
+		}
+
+		switch name {
+		case "--build-arg":
+			if options.BuildArgs == nil {
+				options.BuildArgs = make(map[string]*string)
+			}
+			// an argument without a value takes the one of the environment variable
+			argName, argValue, ok := strings.Cut(value, "=")
+			if !ok {
+				envValue, found := os.LookupEnv(argName)
+				if !found {
+					continue
+				}
+				argValue = envValue
+			}
+			options.BuildArgs[argName] = &argValue
+		case "--target":
+			options.Target = value
+		case "--pull":
+			options.Pull = true
+		case "--no-cache":
+			options.NoCache = true
+		default:
+			return fmt.Errorf("unsupported docker build argument %s", words[i])
+		}
+	}
+	return nil
+}
+
+// DockerfileTag returns the tag of the image built from the Dockerfile with the arguments,
+// an unchanged Dockerfile gets the same tag so that its image is reused
+func DockerfileTag(dockerfile []byte, args string) string {
+	hash := sha256.New()
+	hash.Write(dockerfile)
+	hash.Write([]byte{0})
+	hash.Write([]byte(args))
+	return dockerfileRepository + ":" + hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// tarContext writes the files of the directory into a tar archive, the build context of `docker build`
+func tarContext(dir string, out io.Writer) error {
+	tw := tar.NewWriter(out)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil || name == "." {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// splitArgs splits the arguments like a shell does, quotes group words
+func splitArgs(args string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range args {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unclosed quote in %q", args)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,98 @@
+package shared
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseArgs(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://proxy:3128")
+
+	var options BuildOptions
+	err := options.ParseArgs(`--build-arg VERSION=1.2 --build-arg "GREETING=hello world" --build-arg=HTTP_PROXY --build-arg UNSET --target test --pull`)
+	if err != nil {
+		t.Fatalf("Failed to parse build args: %v", err)
+	}
+	version, greeting, proxy := "1.2", "hello world", "http://proxy:3128"
+	want := BuildOptions{
+		BuildArgs: map[string]*string{"VERSION": &version, "GREETING": &greeting, "HTTP_PROXY": &proxy},
+		Target:    "test",
+		Pull:      true,
+	}
+	if diff := cmp.Diff(options, want); diff != "" {
+		t.Errorf("Build options are not equal (-got +want):\n%s", diff)
+	}
+
+	for _, invalid := range []string{"--squash", "--target", `--build-arg "A=1`} {
+		if err := (&BuildOptions{}).ParseArgs(invalid); err == nil {
+			t.Errorf("Parsing %q should fail", invalid)
+		}
+	}
+}
+
+func TestDockerfileTag(t *testing.T) {
+	dockerfile := []byte("FROM golang:1.23\nRUN go version\n")
+
+	tag := DockerfileTag(dockerfile, "")
+	if !strings.HasPrefix(tag, dockerfileRepository+":") {
+		t.Errorf("Unexpected tag %s", tag)
+	}
+	if again := DockerfileTag([]byte("FROM golang:1.23\nRUN go version\n"), ""); again != tag {
+		t.Errorf("Unchanged Dockerfile is tagged %s, then %s", tag, again)
+	}
+	if changed := DockerfileTag([]byte("FROM golang:1.24\nRUN go version\n"), ""); changed == tag {
+		t.Errorf("Changed Dockerfile keeps the tag %s", tag)
+	}
+	if withArgs := DockerfileTag(dockerfile, "--target test"); withArgs == tag {
+		t.Errorf("Dockerfile built with other arguments keeps the tag %s", tag)
+	}
+}
+
+func TestTarContext(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"Dockerfile":    "FROM alpine\nCOPY src /src\n",
+		"src/main.go":   "package main\n",
+		".git/HEAD":     "ref: refs/heads/main\n",
+		"ci/Dockerfile": "FROM alpine\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	if err := tarContext(dir, &archive); err != nil {
+		t.Fatalf("Failed to archive build context: %v", err)
+	}
+
+	var names []string
+	reader := tar.NewReader(&archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read archive: %v", err)
+		}
+		names = append(names, header.Name)
+	}
+	sort.Strings(names)
+	want := []string{"Dockerfile", "ci", "ci/Dockerfile", "src", "src/main.go"}
+	if diff := cmp.Diff(names, want); diff != "" {
+		t.Errorf("Archived files are not equal (-got +want):\n%s", diff)
+	}
+}
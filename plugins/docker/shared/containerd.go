@@ -0,0 +1,297 @@
+package shared
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+type (
+	// ContainerdClient drives containerd through nerdctl, its docker compatible command line.
+	// nerdctl reads the socket and the namespace of containerd from CONTAINERD_ADDRESS and CONTAINERD_NAMESPACE.
+	ContainerdClient struct {
+		nerdctl string
+		// env is the environment of nerdctl, the one of the worker when it's nil
+		env []string
+	}
+
+	// commandOutput is the output of a running command, closing it kills the command
+	commandOutput struct {
+		*io.PipeReader
+		cancel context.CancelFunc
+	}
+
+	// execConn is the output of `nerdctl exec` as a connection, closing it kills the command
+	execConn struct {
+		net.Conn
+		cancel context.CancelFunc
+	}
+)
+
+// NewContainerdClient finds nerdctl, the command is NERDCTL or nerdctl on the PATH
+func NewContainerdClient(ctx context.Context) (DockerClient, error) {
+	nerdctl := os.Getenv("NERDCTL")
+	if nerdctl == "" {
+		nerdctl = "nerdctl"
+	}
+	path, err := exec.LookPath(nerdctl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create containerd client: %w", err)
+	}
+	return &ContainerdClient{nerdctl: path}, nil
+}
+
+// Pull logs in to the registry first when auth is given. nerdctl keeps the credentials like docker does,
+// so the login and the pull get a docker config of their own which is removed once the pull is over.
+func (c *ContainerdClient) Pull(ctx context.Context, imageName string, auth *RegistryAuth) (io.ReadCloser, error) {
+	if auth == nil {
+		return c.stream(ctx, "pull", buildImageWithTag(imageName))
+	}
+
+	configDir, err := os.MkdirTemp("", "nerdctl-config")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker config: %w", err)
+	}
+	client := &ContainerdClient{nerdctl: c.nerdctl, env: append(os.Environ(), "DOCKER_CONFIG="+configDir)}
+	args := []string{"login", "--username", auth.Username, "--password-stdin"}
+	if auth.ServerAddress != "" {
+		args = append(args, auth.ServerAddress)
+	}
+	if _, err := client.run(ctx, strings.NewReader(auth.Password), args...); err != nil {
+		os.RemoveAll(configDir)
+		return nil, err
+	}
+	output, err := client.stream(ctx, "pull", buildImageWithTag(imageName))
+	if err != nil {
+		os.RemoveAll(configDir)
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_, err := io.Copy(writer, output)
+		output.Close()
+		os.RemoveAll(configDir)
+		writer.CloseWithError(err)
+	}()
+	return &commandOutput{PipeReader: reader, cancel: func() { output.Close() }}, nil
+}
+
+// BuildImage: same as `nerdctl build`, which needs buildkitd. The output is turned into the JSON messages
+// of `docker build` so that it's read the same way.
+func (c *ContainerdClient) BuildImage(ctx context.Context, options BuildOptions) (io.ReadCloser, error) {
+	args := []string{"build", "--tag", options.Tag, "--file", filepath.Join(options.ContextDir, options.Dockerfile)}
+	names := make([]string, 0, len(options.BuildArgs))
+	for name := range options.BuildArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if value := options.BuildArgs[name]; value != nil {
+			args = append(args, "--build-arg", name+"="+*value)
+		}
+	}
+	if options.Target != "" {
+		args = append(args, "--target", options.Target)
+	}
+	if options.Pull {
+		args = append(args, "--pull")
+	}
+	if options.NoCache {
+		args = append(args, "--no-cache")
+	}
+	output, err := c.stream(ctx, append(args, options.ContextDir)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build containerd image %s: %w", options.Tag, err)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		defer output.Close()
+		encoder := json.NewEncoder(writer)
+		scanner := bufio.NewScanner(output)
+		for scanner.Scan() {
+			if err := encoder.Encode(BuildMessage{Stream: scanner.Text() + "\n"}); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			encoder.Encode(BuildMessage{Error: err.Error()})
+		}
+		writer.Close()
+	}()
+	return &commandOutput{PipeReader: reader, cancel: func() { output.Close() }}, nil
+}
+
+func (c *ContainerdClient) ImageExists(ctx context.Context, imageName string) (bool, error) {
+	output, err := c.run(ctx, nil, "images", "--quiet", buildImageWithTag(imageName))
+	return output != "", err
+}
+
+// RunContainer: same as `nerdctl run`
+func (c *ContainerdClient) RunContainer(ctx context.Context, imageName string, options RunOptions) (string, error) {
+	args := []string{"run", "--detach", "--tty", "--entrypoint", "sh"}
+	for _, variable := range options.Env {
+		args = append(args, "--env", variable)
+	}
+	if options.User != "" {
+		args = append(args, "--user", options.User)
+	}
+	if options.Workdir != "" {
+		args = append(args, "--workdir", options.Workdir)
+	}
+	for _, bind := range options.Binds {
+		args = append(args, "--volume", bind)
+	}
+	if options.Network != "" {
+		args = append(args, "--network", options.Network)
+	}
+	if options.Privileged {
+		args = append(args, "--privileged")
+	}
+	for _, label := range sortedLabels(options.Labels) {
+		args = append(args, "--label", label)
+	}
+
+	containerId, err := c.run(ctx, nil, append(args, imageName)...)
+	if err != nil {
+		return "", fmt.Errorf("failed to run containerd container: %w", err)
+	}
+	return containerId, nil
+}
+
+// ExecContainer: same as `nerdctl exec`, the command runs in workdir or in the working directory of the container
+func (c *ContainerdClient) ExecContainer(ctx context.Context, containerId string, cmd []string, env []string, workdir string) (*types.HijackedResponse, error) {
+	args := []string{"exec"}
+	for _, variable := range env {
+		args = append(args, "--env", variable)
+	}
+	if workdir != "" {
+		args = append(args, "--workdir", workdir)
+	}
+	args = append(append(args, containerId), cmd...)
+
+	ctx, cancel := context.WithCancel(ctx)
+	client, server := net.Pipe()
+	command := exec.CommandContext(ctx, c.nerdctl, args...)
+	command.Stdout, command.Stderr = server, server
+	if err := command.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start exec instance for command '%v': %w", cmd, err)
+	}
+	go func() {
+		command.Wait()
+		server.Close()
+		cancel()
+	}()
+	conn := &execConn{Conn: client, cancel: cancel}
+	return &types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(conn)}, nil
+}
+
+func (c *ContainerdClient) StopContainer(ctx context.Context, containerId string) error {
+	if _, err := c.run(ctx, nil, "stop", containerId); err != nil {
+		return err
+	}
+	_, err := c.run(ctx, nil, "rm", containerId)
+	return err
+}
+
+func (c *ContainerdClient) FindContainer(ctx context.Context, labels map[string]string) (string, error) {
+	output, err := c.run(ctx, nil, append([]string{"ps", "--quiet", "--no-trunc"}, labelFilterArgs(labels)...)...)
+	if err != nil || output == "" {
+		return "", err
+	}
+	return strings.Fields(output)[0], nil
+}
+
+func (c *ContainerdClient) RemoveContainers(ctx context.Context, labels map[string]string) error {
+	output, err := c.run(ctx, nil, append([]string{"ps", "--all", "--quiet", "--no-trunc"}, labelFilterArgs(labels)...)...)
+	if err != nil || output == "" {
+		return err
+	}
+	_, err = c.run(ctx, nil, append([]string{"rm", "--force"}, strings.Fields(output)...)...)
+	return err
+}
+
+func (c *ContainerdClient) Stop() error {
+	return nil
+}
+
+// run runs nerdctl and returns its output, the error output of a failing command is in the error
+func (c *ContainerdClient) run(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, c.nerdctl, args...)
+	command.Env = c.env
+	command.Stdin = stdin
+	command.Stdout, command.Stderr = &stdout, &stderr
+	if err := command.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("nerdctl %s: %s: %w", args[0], message, err)
+		}
+		return "", fmt.Errorf("nerdctl %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// stream runs nerdctl in the background, its output ends with the error of the command if it fails
+func (c *ContainerdClient) stream(ctx context.Context, args ...string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	reader, writer := io.Pipe()
+	command := exec.CommandContext(ctx, c.nerdctl, args...)
+	command.Env = c.env
+	command.Stdout, command.Stderr = writer, writer
+	if err := command.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("nerdctl %s: %w", args[0], err)
+	}
+	go func() {
+		err := command.Wait()
+		if err != nil {
+			err = fmt.Errorf("nerdctl %s: %w", args[0], err)
+		}
+		writer.CloseWithError(err)
+		cancel()
+	}()
+	return &commandOutput{PipeReader: reader, cancel: cancel}, nil
+}
+
+func (output *commandOutput) Close() error {
+	output.cancel()
+	return output.PipeReader.Close()
+}
+
+func (conn *execConn) Close() error {
+	conn.cancel()
+	return conn.Conn.Close()
+}
+
+// sortedLabels returns the labels as name=value, sorted by name
+func sortedLabels(labels map[string]string) []string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// labelFilterArgs returns the filters of `nerdctl ps` for the containers with the labels
+func labelFilterArgs(labels map[string]string) []string {
+	var args []string
+	for _, label := range sortedLabels(labels) {
+		args = append(args, "--filter", "label="+label)
+	}
+	return args
+}
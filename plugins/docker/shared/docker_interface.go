@@ -2,12 +2,15 @@ package shared
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"path/filepath"
 	"strings"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
 	dockerClient "github.com/docker/docker/client"
@@ -16,9 +19,17 @@ import (
 // type ContainerId string
 
 type DockerClient interface {
-	Pull(ctx context.Context, imageName string) (io.ReadCloser, error)
-	RunContainer(ctx context.Context, imageName string) (string, error)
-	ExecContainer(ctx context.Context, containerId string, cmd []string) (*types.HijackedResponse, error)
+	// Pull authenticates with the registry when auth is given
+	Pull(ctx context.Context, imageName string, auth *RegistryAuth) (io.ReadCloser, error)
+	// BuildImage is `docker build`, the output is a stream of JSON messages like the one of Pull
+	BuildImage(ctx context.Context, options BuildOptions) (io.ReadCloser, error)
+	ImageExists(ctx context.Context, imageName string) (bool, error)
+	RunContainer(ctx context.Context, imageName string, options RunOptions) (string, error)
+	// FindContainer returns the id of a running container with the labels, or an empty one
+	FindContainer(ctx context.Context, labels map[string]string) (string, error)
+	// RemoveContainers stops and removes the containers with the labels
+	RemoveContainers(ctx context.Context, labels map[string]string) error
+	ExecContainer(ctx context.Context, containerId string, cmd []string, env []string, workdir string) (*types.HijackedResponse, error)
 	StopContainer(ctx context.Context, containerId string) error
 	Stop() error
 }
@@ -44,19 +55,68 @@ func NewDockerClient(ctx context.Context) (DockerClient, error) {
 	}, nil
 }
 
-func (p *DockerClientImpl) Pull(ctx context.Context, imageName string) (io.ReadCloser, error) {
-	return p.docker.ImagePull(ctx, buildImageWithTag(imageName), image.PullOptions{})
+func (p *DockerClientImpl) Pull(ctx context.Context, imageName string, auth *RegistryAuth) (io.ReadCloser, error) {
+	options := image.PullOptions{}
+	if auth != nil {
+		registryAuth, err := auth.encode()
+		if err != nil {
+			return nil, err
+		}
+		options.RegistryAuth = registryAuth
+	}
+	return p.docker.ImagePull(ctx, buildImageWithTag(imageName), options)
+}
+
+// BuildImage: same as `docker build`, the directory is sent as the build context
+func (p *DockerClientImpl) BuildImage(ctx context.Context, options BuildOptions) (io.ReadCloser, error) {
+	buildContext, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(tarContext(options.ContextDir, writer))
+	}()
+
+	resp, err := p.docker.ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+		Tags:        []string{options.Tag},
+		Dockerfile:  filepath.ToSlash(options.Dockerfile),
+		BuildArgs:   options.BuildArgs,
+		Target:      options.Target,
+		PullParent:  options.Pull,
+		NoCache:     options.NoCache,
+		Remove:      true,
+		ForceRemove: true,
+	})
+	if err != nil {
+		buildContext.Close()
+		return nil, fmt.Errorf("failed to build Docker image %s: %w", options.Tag, err)
+	}
+	return resp.Body, nil
+}
+
+// ImageExists: same as `docker image inspect`, without the details
+func (p *DockerClientImpl) ImageExists(ctx context.Context, imageName string) (bool, error) {
+	_, _, err := p.docker.ImageInspectWithRaw(ctx, imageName)
+	if dockerClient.IsErrNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
 // RunContainer: same as `docker run`
-func (p *DockerClientImpl) RunContainer(ctx context.Context, imageName string) (string, error) {
+func (p *DockerClientImpl) RunContainer(ctx context.Context, imageName string, options RunOptions) (string, error) {
 
 	// Create the container
 	resp, err := p.docker.ContainerCreate(ctx, &container.Config{
 		Image:      imageName,
 		Entrypoint: []string{"sh"},
 		Tty:        true,
-	}, &container.HostConfig{}, &network.NetworkingConfig{}, nil, "")
+		Env:        options.Env,
+		User:       options.User,
+		WorkingDir: options.Workdir,
+		Labels:     options.Labels,
+	}, &container.HostConfig{
+		Binds:       options.Binds,
+		NetworkMode: container.NetworkMode(options.Network),
+		Privileged:  options.Privileged,
+	}, &network.NetworkingConfig{}, nil, "")
 	if err != nil {
 		return "", fmt.Errorf("failed to create Docker container: %w", err)
 	}
@@ -69,8 +129,8 @@ func (p *DockerClientImpl) RunContainer(ctx context.Context, imageName string) (
 	return resp.ID, nil
 }
 
-// ExecContainer: same as `docker exec`
-func (p *DockerClientImpl) ExecContainer(ctx context.Context, containerId string, cmd []string) (*types.HijackedResponse, error) {
+// ExecContainer: same as `docker exec`, the command runs in workdir or in the working directory of the container
+func (p *DockerClientImpl) ExecContainer(ctx context.Context, containerId string, cmd []string, env []string, workdir string) (*types.HijackedResponse, error) {
 	docker, err := dockerClient.NewClientWithOpts(dockerClient.FromEnv, dockerClient.WithVersion(dockerClientVersion))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Docker client: %w", err)
@@ -79,6 +139,8 @@ func (p *DockerClientImpl) ExecContainer(ctx context.Context, containerId string
 	
 	execResp, err := docker.ContainerExecCreate(ctx, containerId, container.ExecOptions{
 		Cmd:          cmd,
+		Env:          env,
+		WorkingDir:   workdir,
 		AttachStdout: true,
 		AttachStderr: true,
 	})
@@ -105,15 +167,43 @@ func (p *DockerClientImpl) StopContainer(ctx context.Context, containerId string
 	return nil
 }
 
+func (p *DockerClientImpl) FindContainer(ctx context.Context, labels map[string]string) (string, error) {
+	containers, err := p.docker.ContainerList(ctx, container.ListOptions{Filters: labelFilters(labels)})
+	if err != nil || len(containers) == 0 {
+		return "", err
+	}
+	return containers[0].ID, nil
+}
+
+func (p *DockerClientImpl) RemoveContainers(ctx context.Context, labels map[string]string) error {
+	containers, err := p.docker.ContainerList(ctx, container.ListOptions{All: true, Filters: labelFilters(labels)})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, c := range containers {
+		errs = append(errs, p.docker.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true}))
+	}
+	return errors.Join(errs...)
+}
+
 func (p *DockerClientImpl) Stop() error {
 	return p.docker.Close()
 }
 
-// Append tag 'latest' to image without tag
+func labelFilters(labels map[string]string) filters.Args {
+	args := filters.NewArgs()
+	for name, value := range labels {
+		args.Add("label", name+"="+value)
+	}
+	return args
+}
+
+// Append tag 'latest' to image without tag, the port of a registry isn't a tag
 func buildImageWithTag(imageName string) string {
-	imageTag := strings.Split(imageName, ":")
-	if len(imageTag) > 1 {
-		return imageTag[0] + ":" + imageTag[1]
+	name := imageName[strings.LastIndex(imageName, "/")+1:]
+	if strings.ContainsAny(name, ":@") {
+		return imageName
 	}
-	return imageTag[0] + ":latest"
+	return imageName + ":latest"
 }
@@ -0,0 +1,103 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Container engines the agents run in, they're all driven through DockerClient
+const (
+	Docker     = "docker"
+	Podman     = "podman"
+	Containerd = "containerd"
+)
+
+// Engines are the names of the supported container engines
+var Engines = []string{Docker, Podman, Containerd}
+
+// NewClient connects to the container engine, each one is configured by the environment variables of its own tools:
+// DOCKER_HOST for docker, CONTAINER_HOST for podman, NERDCTL, CONTAINERD_ADDRESS and CONTAINERD_NAMESPACE for containerd
+func NewClient(ctx context.Context, engine string) (DockerClient, error) {
+	switch engine {
+	case "", Docker:
+		return NewDockerClient(ctx)
+	case Podman:
+		return NewPodmanClient(ctx)
+	case Containerd:
+		return NewContainerdClient(ctx)
+	}
+	return nil, fmt.Errorf("unsupported container engine %s, expected one of %s", engine, strings.Join(Engines, ", "))
+}
+
+// ContainerId qualifies the id of a container with its engine, e.g. podman://<id>, so that the steps run
+// in it through the same engine. Docker containers keep their plain ids.
+func ContainerId(engine string, id string) string {
+	if engine == "" || engine == Docker || id == "" {
+		return id
+	}
+	return engine + "://" + id
+}
+
+// SplitContainerId returns the engine and the id of the engine of a container id given by ContainerId
+func SplitContainerId(containerId string) (string, string) {
+	if engine, id, ok := strings.Cut(containerId, "://"); ok {
+		return engine, id
+	}
+	return Docker, containerId
+}
+
+// Clients connects to the container engines the first time they're used, so that
+// the engines which aren't used don't need to be there
+type Clients struct {
+	mu      sync.Mutex
+	clients map[string]DockerClient
+	// connect is NewClient, tests replace it
+	connect func(ctx context.Context, engine string) (DockerClient, error)
+}
+
+func NewClients() *Clients {
+	return &Clients{clients: make(map[string]DockerClient), connect: NewClient}
+}
+
+// Get returns the client of the engine, the default engine is docker
+func (c *Clients) Get(ctx context.Context, engine string) (DockerClient, error) {
+	if engine == "" {
+		engine = Docker
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if client, ok := c.clients[engine]; ok {
+		return client, nil
+	}
+	client, err := c.connect(ctx, engine)
+	if err != nil {
+		return nil, err
+	}
+	c.clients[engine] = client
+	return client, nil
+}
+
+// Connected returns the clients of the engines used so far by name
+func (c *Clients) Connected() map[string]DockerClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clients := make(map[string]DockerClient, len(c.clients))
+	for engine, client := range c.clients {
+		clients[engine] = client
+	}
+	return clients
+}
+
+// Stop disconnects from the engines
+func (c *Clients) Stop() error {
+	var errs []error
+	for _, client := range c.Connected() {
+		errs = append(errs, client.Stop())
+	}
+	return errors.Join(errs...)
+}
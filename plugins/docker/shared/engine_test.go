@@ -0,0 +1,235 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMain(m *testing.M) {
+	// the containerd client runs the test binary as its nerdctl, which relays the commands to the fake engine
+	if socket := os.Getenv("FAKE_NERDCTL_SOCKET"); socket != "" {
+		os.Exit(fakeNerdctl(socket, os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// TestEngines runs the same containers through each engine and checks that the engine ends up with the same ones
+func TestEngines(t *testing.T) {
+	engines := map[string]func(t *testing.T, engine *fakeEngine){
+		Docker: func(t *testing.T, engine *fakeEngine) {
+			t.Setenv("DOCKER_HOST", "unix://"+engine.socket)
+		},
+		Podman: func(t *testing.T, engine *fakeEngine) {
+			t.Setenv("CONTAINER_HOST", "unix://"+engine.socket)
+		},
+		Containerd: func(t *testing.T, engine *fakeEngine) {
+			t.Setenv("NERDCTL", os.Args[0])
+			t.Setenv("FAKE_NERDCTL_SOCKET", engine.socket)
+		},
+	}
+	for _, name := range Engines {
+		t.Run(name, func(t *testing.T) {
+			engine := newFakeEngine(t)
+			engines[name](t, engine)
+			client, err := NewClient(context.Background(), name)
+			if err != nil {
+				t.Fatalf("Failed to connect to %s: %v", name, err)
+			}
+			defer client.Stop()
+			testEngine(t, client, engine)
+			if name == Containerd {
+				testContainerdCredentials(t, engine)
+			}
+		})
+	}
+}
+
+func testEngine(t *testing.T, client DockerClient, engine *fakeEngine) {
+	ctx := context.Background()
+
+	if exists, err := client.ImageExists(ctx, "maven:3.9"); err != nil || exists {
+		t.Fatalf("Image exists before it's pulled: %v, %v", exists, err)
+	}
+	output, err := client.Pull(ctx, "maven:3.9", &RegistryAuth{ServerAddress: "registry.example.com", Username: "ci", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to pull image: %v", err)
+	}
+	if _, err := io.ReadAll(output); err != nil {
+		t.Fatalf("Failed to pull image: %v", err)
+	}
+	output.Close()
+	if exists, err := client.ImageExists(ctx, "maven:3.9"); err != nil || !exists {
+		t.Fatalf("Pulled image doesn't exist: %v, %v", exists, err)
+	}
+	pulls, _, _, _ := engine.state()
+	if diff := cmp.Diff(pulls, []fakePull{{Image: "maven:3.9", Username: "ci"}}); diff != "" {
+		t.Errorf("Pulls are not equal (-got +want):\n%s", diff)
+	}
+
+	contextDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(contextDir, "ci"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(contextDir, "ci", "Dockerfile"), []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	version := "1.2"
+	output, err = client.BuildImage(ctx, BuildOptions{
+		ContextDir: contextDir,
+		Dockerfile: "ci/Dockerfile",
+		Tag:        "tumbler-doll/dockerfile:0123456789abcdef",
+		BuildArgs:  map[string]*string{"VERSION": &version},
+		Target:     "test",
+	})
+	if err != nil {
+		t.Fatalf("Failed to build image: %v", err)
+	}
+	decoder := json.NewDecoder(output)
+	for {
+		var message BuildMessage
+		if err := decoder.Decode(&message); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Failed to read build output: %v", err)
+		}
+		if message.Error != "" {
+			t.Fatalf("Failed to build image: %s", message.Error)
+		}
+	}
+	output.Close()
+	wantBuild := fakeBuild{
+		Tag:        "tumbler-doll/dockerfile:0123456789abcdef",
+		Dockerfile: "ci/Dockerfile",
+		BuildArgs:  map[string]string{"VERSION": "1.2"},
+		Target:     "test",
+	}
+	_, builds, _, _ := engine.state()
+	if diff := cmp.Diff(builds, []fakeBuild{wantBuild}); diff != "" {
+		t.Errorf("Builds are not equal (-got +want):\n%s", diff)
+	}
+	if exists, err := client.ImageExists(ctx, wantBuild.Tag); err != nil || !exists {
+		t.Fatalf("Built image doesn't exist: %v, %v", exists, err)
+	}
+
+	labels := map[string]string{"tumbler-doll.build": "my-job-7"}
+	options := RunOptions{
+		Binds:      []string{"/workspace/my-job/7:/workspace/my-job/7", "m2:/root/.m2:ro"},
+		Env:        []string{"MAVEN_OPTS=-Xmx1g", "CI=true"},
+		Network:    "host",
+		User:       "1000:1000",
+		Workdir:    "/workspace/my-job/7",
+		Privileged: true,
+		Labels:     labels,
+	}
+	containerId, err := client.RunContainer(ctx, "maven:3.9", options)
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	want := fakeContainer{
+		Image:      "maven:3.9",
+		Entrypoint: []string{"sh"},
+		Tty:        true,
+		Env:        []string{"CI=true", "MAVEN_OPTS=-Xmx1g"},
+		User:       "1000:1000",
+		Workdir:    "/workspace/my-job/7",
+		Binds:      []string{"/workspace/my-job/7:/workspace/my-job/7", "m2:/root/.m2:ro"},
+		Network:    "host",
+		Privileged: true,
+		Labels:     labels,
+		Running:    true,
+	}
+	_, _, _, containers := engine.state()
+	if diff := cmp.Diff(containers[containerId], want); diff != "" {
+		t.Errorf("Containers are not equal (-got +want):\n%s", diff)
+	}
+
+	if found, err := client.FindContainer(ctx, labels); err != nil || found != containerId {
+		t.Errorf("Found container %q (%v), want %s", found, err, containerId)
+	}
+	if found, err := client.FindContainer(ctx, map[string]string{"tumbler-doll.build": "other-job-1"}); err != nil || found != "" {
+		t.Errorf("Found container %q (%v) of another build", found, err)
+	}
+
+	resp, err := client.ExecContainer(ctx, containerId, []string{"sh", "-e", "-c", "mvn package"}, []string{"BUILD_NUMBER=7"}, "/workspace/my-job/7")
+	if err != nil {
+		t.Fatalf("Failed to exec in container: %v", err)
+	}
+	execOutput, err := io.ReadAll(resp.Reader)
+	resp.Close()
+	if err != nil || !strings.Contains(string(execOutput), strings.TrimSpace(fakeExecOutput)) {
+		t.Errorf("Unexpected exec output %q (%v)", execOutput, err)
+	}
+	wantExec := fakeExec{Container: containerId, Cmd: []string{"sh", "-e", "-c", "mvn package"}, Env: []string{"BUILD_NUMBER=7"}, Workdir: "/workspace/my-job/7"}
+	_, _, execs, _ := engine.state()
+	if diff := cmp.Diff(execs, []fakeExec{wantExec}); diff != "" {
+		t.Errorf("Execs are not equal (-got +want):\n%s", diff)
+	}
+
+	if err := client.StopContainer(ctx, containerId); err != nil {
+		t.Fatalf("Failed to stop container: %v", err)
+	}
+	if _, _, _, containers := engine.state(); len(containers) != 0 {
+		t.Errorf("Stopped container wasn't removed")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.RunContainer(ctx, "maven:3.9", RunOptions{Labels: labels}); err != nil {
+			t.Fatalf("Failed to run container: %v", err)
+		}
+	}
+	other, err := client.RunContainer(ctx, "maven:3.9", RunOptions{Labels: map[string]string{"tumbler-doll.build": "other-job-1"}})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	if err := client.RemoveContainers(ctx, labels); err != nil {
+		t.Fatalf("Failed to remove containers: %v", err)
+	}
+	if _, _, _, containers := engine.state(); len(containers) != 1 || containers[other].Image == "" {
+		t.Errorf("Removed containers other than the ones with the labels, %d left", len(containers))
+	}
+}
+
+func TestContainerId(t *testing.T) {
+	for engine, want := range map[string]string{"": "0123", Docker: "0123", Podman: "podman://0123", Containerd: "containerd://0123"} {
+		containerId := ContainerId(engine, "0123")
+		if containerId != want {
+			t.Errorf("ContainerId(%q, 0123) = %s, want %s", engine, containerId, want)
+		}
+		if engine == "" {
+			engine = Docker
+		}
+		if gotEngine, id := SplitContainerId(containerId); gotEngine != engine || id != "0123" {
+			t.Errorf("SplitContainerId(%s) = %s, %s", containerId, gotEngine, id)
+		}
+	}
+	if containerId := ContainerId(Podman, ""); containerId != "" {
+		t.Errorf("An empty id is qualified as %s", containerId)
+	}
+	if _, err := NewClient(context.Background(), "rkt"); err == nil {
+		t.Errorf("Connecting to an unsupported engine should fail")
+	}
+}
+
+// testContainerdCredentials checks that the credentials of nerdctl login didn't outlive the pull
+func testContainerdCredentials(t *testing.T, engine *fakeEngine) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+	if len(engine.loggedIn) == 0 {
+		t.Errorf("Expected the pull to log in")
+	}
+	if username, ok := engine.loggedIn[""]; ok {
+		t.Errorf("Expected the login not to use the default docker config, %s logged in there", username)
+	}
+	for config := range engine.loggedIn {
+		if _, err := os.Stat(config); !os.IsNotExist(err) {
+			t.Errorf("Expected the docker config %s to be removed after the pull: %v", config, err)
+		}
+	}
+}
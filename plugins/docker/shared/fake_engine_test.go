@@ -0,0 +1,634 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+type (
+	// fakeEngine is a container engine behind a unix socket which serves the docker API, the libpod API
+	// and the commands of the fake nerdctl. Whatever the API, the containers end up as fakeContainers.
+	fakeEngine struct {
+		socket string
+
+		mu         sync.Mutex
+		images     map[string]bool
+		pulls      []fakePull
+		builds     []fakeBuild
+		containers map[string]*fakeContainer
+		execs      []fakeExec
+		// loggedIn is the user of the last nerdctl login by the DOCKER_CONFIG it keeps the credentials in
+		loggedIn map[string]string
+		lastId   int
+	}
+
+	fakePull struct {
+		Image    string
+		Username string
+	}
+
+	fakeBuild struct {
+		Tag        string
+		Dockerfile string
+		BuildArgs  map[string]string
+		Target     string
+	}
+
+	fakeContainer struct {
+		Image      string
+		Entrypoint []string
+		Tty        bool
+		Env        []string
+		User       string
+		Workdir    string
+		Binds      []string
+		Network    string
+		Privileged bool
+		Labels     map[string]string
+		Running    bool
+	}
+
+	fakeExec struct {
+		Container string
+		Cmd       []string
+		Env       []string
+		Workdir   string
+	}
+
+	// fakeCommand is a nerdctl command relayed by the fake nerdctl, and its result
+	fakeCommand struct {
+		Args  []string
+		Stdin string
+		// Config is the DOCKER_CONFIG of the fake nerdctl, the default docker config when it's empty
+		Config string
+		Stdout string
+		Stderr string
+		Status int
+	}
+)
+
+// fakeExecOutput is what each exec prints
+const fakeExecOutput = "hello from the fake engine\n"
+
+func newFakeEngine(t *testing.T) *fakeEngine {
+	// the path of a unix socket is limited to about a hundred bytes, the test names would make it too long
+	dir, err := os.MkdirTemp("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	engine := &fakeEngine{
+		socket:     filepath.Join(dir, "engine.sock"),
+		images:     make(map[string]bool),
+		containers: make(map[string]*fakeContainer),
+		loggedIn:   make(map[string]string),
+	}
+	listener, err := net.Listen("unix", engine.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: engine}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return engine
+}
+
+func (e *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/nerdctl":
+		e.serveNerdctl(w, r)
+	case strings.HasPrefix(r.URL.Path, "/"+podmanApiVersion+"/libpod/"):
+		e.serveLibpod(w, r, strings.TrimPrefix(r.URL.Path, "/"+podmanApiVersion+"/libpod"))
+	case strings.HasPrefix(r.URL.Path, "/v"+dockerClientVersion+"/"):
+		e.serveDocker(w, r, strings.TrimPrefix(r.URL.Path, "/v"+dockerClientVersion))
+	default:
+		writeError(w, http.StatusNotFound, "unexpected path "+r.URL.Path)
+	}
+}
+
+// serveDocker serves the endpoints of the docker API used by DockerClientImpl
+func (e *fakeEngine) serveDocker(w http.ResponseWriter, r *http.Request, path string) {
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && path == "/images/create":
+		e.pull(query.Get("fromImage")+":"+query.Get("tag"), registryUser(r))
+		writeJSON(w, http.StatusOK, map[string]string{"status": "Pulled"})
+	case r.Method == http.MethodPost && path == "/build":
+		var buildArgs map[string]*string
+		json.Unmarshal([]byte(query.Get("buildargs")), &buildArgs)
+		build := fakeBuild{Tag: query.Get("t"), Dockerfile: query.Get("dockerfile"), Target: query.Get("target")}
+		for name, value := range buildArgs {
+			build.BuildArgs = setArg(build.BuildArgs, name, *value)
+		}
+		e.build(build, r.Body)
+		writeJSON(w, http.StatusOK, BuildMessage{Stream: "Successfully tagged " + build.Tag + "\n"})
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/images/") && strings.HasSuffix(path, "/json"):
+		if !e.imageExists(strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/json")) {
+			writeError(w, http.StatusNotFound, "No such image")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"Id": "sha256:0123"})
+	case r.Method == http.MethodPost && path == "/containers/create":
+		var body struct {
+			container.Config
+			HostConfig container.HostConfig
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		id := e.create(&fakeContainer{
+			Image:      body.Image,
+			Entrypoint: body.Entrypoint,
+			Tty:        body.Tty,
+			Env:        body.Env,
+			User:       body.User,
+			Workdir:    body.WorkingDir,
+			Binds:      body.HostConfig.Binds,
+			Network:    string(body.HostConfig.NetworkMode),
+			Privileged: body.HostConfig.Privileged,
+			Labels:     body.Labels,
+		})
+		writeJSON(w, http.StatusCreated, map[string]any{"Id": id, "Warnings": []string{}})
+	case r.Method == http.MethodGet && path == "/containers/json":
+		var filters map[string]map[string]bool
+		json.Unmarshal([]byte(query.Get("filters")), &filters)
+		var labels []string
+		for label := range filters["label"] {
+			labels = append(labels, label)
+		}
+		var containers []map[string]string
+		for _, id := range e.list(labels, query.Get("all") == "1") {
+			containers = append(containers, map[string]string{"Id": id})
+		}
+		writeJSON(w, http.StatusOK, containers)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/exec/") && strings.HasSuffix(path, "/start"):
+		hijack(w, "application/vnd.docker.raw-stream")
+	case strings.HasPrefix(path, "/containers/"):
+		e.serveContainer(w, r, strings.TrimPrefix(path, "/containers/"), query.Get("force") == "1")
+	default:
+		writeError(w, http.StatusNotFound, "unexpected docker endpoint "+r.Method+" "+path)
+	}
+}
+
+// serveLibpod serves the endpoints of the libpod API used by PodmanClient
+func (e *fakeEngine) serveLibpod(w http.ResponseWriter, r *http.Request, path string) {
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && path == "/images/pull":
+		e.pull(query.Get("reference"), registryUser(r))
+		writeJSON(w, http.StatusOK, map[string]string{"stream": "Pulled " + query.Get("reference") + "\n"})
+	case r.Method == http.MethodPost && path == "/build":
+		var buildArgs map[string]string
+		json.Unmarshal([]byte(query.Get("buildargs")), &buildArgs)
+		build := fakeBuild{Tag: query.Get("t"), Dockerfile: query.Get("dockerfile"), Target: query.Get("target")}
+		for name, value := range buildArgs {
+			build.BuildArgs = setArg(build.BuildArgs, name, value)
+		}
+		e.build(build, r.Body)
+		writeJSON(w, http.StatusOK, BuildMessage{Stream: "Successfully tagged " + build.Tag + "\n"})
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/images/") && strings.HasSuffix(path, "/exists"):
+		if !e.imageExists(strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/exists")) {
+			writeError(w, http.StatusNotFound, "failed to find image")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && path == "/containers/create":
+		// the fields of the SpecGenerator of libpod
+		var spec struct {
+			Image      string            `json:"image"`
+			Entrypoint []string          `json:"entrypoint"`
+			Terminal   bool              `json:"terminal"`
+			Env        map[string]string `json:"env"`
+			User       string            `json:"user"`
+			WorkDir    string            `json:"work_dir"`
+			Labels     map[string]string `json:"labels"`
+			Mounts     []struct {
+				Destination string   `json:"destination"`
+				Type        string   `json:"type"`
+				Source      string   `json:"source"`
+				Options     []string `json:"options"`
+			} `json:"mounts"`
+			Volumes []struct {
+				Name    string   `json:"Name"`
+				Dest    string   `json:"Dest"`
+				Options []string `json:"Options"`
+			} `json:"volumes"`
+			NetNS struct {
+				NSMode string `json:"nsmode"`
+			} `json:"netns"`
+			Networks   map[string]any `json:"Networks"`
+			Privileged bool           `json:"privileged"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		c := &fakeContainer{
+			Image:      spec.Image,
+			Entrypoint: spec.Entrypoint,
+			Tty:        spec.Terminal,
+			User:       spec.User,
+			Workdir:    spec.WorkDir,
+			Privileged: spec.Privileged,
+			Labels:     spec.Labels,
+		}
+		for name, value := range spec.Env {
+			c.Env = append(c.Env, name+"="+value)
+		}
+		for _, mount := range spec.Mounts {
+			c.Binds = append(c.Binds, joinBind(mount.Source, mount.Destination, mount.Options))
+		}
+		for _, volume := range spec.Volumes {
+			c.Binds = append(c.Binds, joinBind(volume.Name, volume.Dest, volume.Options))
+		}
+		if spec.NetNS.NSMode != "bridge" {
+			c.Network = spec.NetNS.NSMode
+		}
+		for network := range spec.Networks {
+			c.Network = network
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"Id": e.create(c), "Warnings": []string{}})
+	case r.Method == http.MethodGet && path == "/containers/json":
+		var filters map[string][]string
+		json.Unmarshal([]byte(query.Get("filters")), &filters)
+		containers := []map[string]string{}
+		for _, id := range e.list(filters["label"], query.Get("all") == "true") {
+			containers = append(containers, map[string]string{"Id": id})
+		}
+		writeJSON(w, http.StatusOK, containers)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/exec/") && strings.HasSuffix(path, "/start"):
+		hijack(w, "application/vnd.docker.raw-stream")
+	case strings.HasPrefix(path, "/containers/"):
+		e.serveContainer(w, r, strings.TrimPrefix(path, "/containers/"), query.Get("force") == "true")
+	default:
+		writeError(w, http.StatusNotFound, "unexpected libpod endpoint "+r.Method+" "+path)
+	}
+}
+
+// serveContainer serves the endpoints of a container, they're the same in both APIs
+func (e *fakeEngine) serveContainer(w http.ResponseWriter, r *http.Request, path string, force bool) {
+	id, action, _ := strings.Cut(path, "/")
+	var err error
+	switch {
+	case r.Method == http.MethodPost && action == "start":
+		err = e.setRunning(id, true)
+	case r.Method == http.MethodPost && action == "stop":
+		err = e.setRunning(id, false)
+	case r.Method == http.MethodDelete && action == "":
+		err = e.remove(id, force)
+	case r.Method == http.MethodPost && action == "exec":
+		var config struct {
+			Cmd        []string
+			Env        []string
+			WorkingDir string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := e.exec(fakeExec{Container: id, Cmd: config.Cmd, Env: config.Env, Workdir: config.WorkingDir}); err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"Id": "exec-" + id})
+		return
+	default:
+		writeError(w, http.StatusNotFound, "unexpected container endpoint "+r.Method+" "+path)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveNerdctl runs a command relayed by the fake nerdctl
+func (e *fakeEngine) serveNerdctl(w http.ResponseWriter, r *http.Request) {
+	var command fakeCommand
+	if err := json.NewDecoder(r.Body).Decode(&command); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	stdout, err := e.nerdctl(command.Args, command.Stdin, command.Config)
+	command.Stdout = stdout
+	if err != nil {
+		command.Stderr = err.Error()
+		command.Status = 1
+	}
+	writeJSON(w, http.StatusOK, command)
+}
+
+// nerdctl runs the commands of nerdctl used by ContainerdClient
+func (e *fakeEngine) nerdctl(args []string, stdin string, config string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("missing command")
+	}
+	command, flags, positional := parseNerdctlArgs(args[0], args[1:])
+	switch command {
+	case "login":
+		if flags["password-stdin"] == nil || stdin == "" {
+			return "", fmt.Errorf("missing password")
+		}
+		e.mu.Lock()
+		e.loggedIn[config] = flags["username"][0]
+		e.mu.Unlock()
+		return "Login Succeeded\n", nil
+	case "pull":
+		e.mu.Lock()
+		username := e.loggedIn[config]
+		e.mu.Unlock()
+		e.pull(positional[0], username)
+		return positional[0] + ": resolved\n", nil
+	case "build":
+		dockerfile, err := filepath.Rel(positional[0], flags["file"][0])
+		if err != nil {
+			return "", err
+		}
+		build := fakeBuild{Tag: flags["tag"][0], Dockerfile: dockerfile}
+		for _, arg := range flags["build-arg"] {
+			name, value, _ := strings.Cut(arg, "=")
+			build.BuildArgs = setArg(build.BuildArgs, name, value)
+		}
+		if target := flags["target"]; target != nil {
+			build.Target = target[0]
+		}
+		e.build(build, nil)
+		return "naming to " + build.Tag + " done\n", nil
+	case "images":
+		if e.imageExists(positional[0]) {
+			return "0123456789ab\n", nil
+		}
+		return "", nil
+	case "run":
+		c := &fakeContainer{
+			Image:      positional[0],
+			Entrypoint: flags["entrypoint"],
+			Tty:        flags["tty"] != nil,
+			Env:        flags["env"],
+			Binds:      flags["volume"],
+			Privileged: flags["privileged"] != nil,
+			Labels:     make(map[string]string),
+		}
+		for name, field := range map[string]*string{"user": &c.User, "workdir": &c.Workdir, "network": &c.Network} {
+			if value := flags[name]; value != nil {
+				*field = value[0]
+			}
+		}
+		for _, label := range flags["label"] {
+			name, value, _ := strings.Cut(label, "=")
+			c.Labels[name] = value
+		}
+		id := e.create(c)
+		return id + "\n", e.setRunning(id, true)
+	case "ps":
+		var labels []string
+		for _, filter := range flags["filter"] {
+			labels = append(labels, strings.TrimPrefix(filter, "label="))
+		}
+		ids := e.list(labels, flags["all"] != nil)
+		if len(ids) == 0 {
+			return "", nil
+		}
+		return strings.Join(ids, "\n") + "\n", nil
+	case "exec":
+		exec := fakeExec{Container: positional[0], Cmd: positional[1:], Env: flags["env"]}
+		if workdir := flags["workdir"]; workdir != nil {
+			exec.Workdir = workdir[0]
+		}
+		return fakeExecOutput, e.exec(exec)
+	case "stop":
+		return positional[0] + "\n", e.setRunning(positional[0], false)
+	case "rm":
+		for _, id := range positional {
+			if err := e.remove(id, flags["force"] != nil); err != nil {
+				return "", err
+			}
+		}
+		return strings.Join(positional, "\n") + "\n", nil
+	}
+	return "", fmt.Errorf("unknown command %s", command)
+}
+
+// parseNerdctlArgs splits the arguments into flags and positional arguments, the command of exec
+// and of run follows the container or the image
+func parseNerdctlArgs(command string, args []string) (string, map[string][]string, []string) {
+	withValue := map[string]bool{
+		"username": true, "tag": true, "file": true, "build-arg": true, "target": true, "entrypoint": true,
+		"env": true, "user": true, "workdir": true, "volume": true, "network": true, "label": true, "filter": true,
+	}
+	flags := make(map[string][]string)
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		name, isFlag := strings.CutPrefix(args[i], "--")
+		if !isFlag || len(positional) > 0 {
+			positional = append(positional, args[i])
+			continue
+		}
+		if withValue[name] {
+			i++
+			flags[name] = append(flags[name], args[i])
+		} else {
+			flags[name] = append(flags[name], "")
+		}
+	}
+	return command, flags, positional
+}
+
+// fakeNerdctl relays the command to the fake engine and prints its output like nerdctl would
+func fakeNerdctl(socket string, args []string) int {
+	stdin := ""
+	if len(args) > 0 && args[0] == "login" {
+		data, _ := io.ReadAll(os.Stdin)
+		stdin = string(data)
+	}
+	body, _ := json.Marshal(fakeCommand{Args: args, Stdin: stdin, Config: os.Getenv("DOCKER_CONFIG")})
+	client := &http.Client{Transport: &http.Transport{
+		Dial: func(_, _ string) (net.Conn, error) { return net.Dial("unix", socket) },
+	}}
+	resp, err := client.Post("http://nerdctl/nerdctl", "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	var command fakeCommand
+	if err := json.NewDecoder(resp.Body).Decode(&command); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprint(os.Stdout, command.Stdout)
+	fmt.Fprint(os.Stderr, command.Stderr)
+	return command.Status
+}
+
+// state returns copies of what the engine recorded and of its containers by id
+func (e *fakeEngine) state() ([]fakePull, []fakeBuild, []fakeExec, map[string]fakeContainer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	containers := make(map[string]fakeContainer, len(e.containers))
+	for id, c := range e.containers {
+		containers[id] = *c
+	}
+	return append([]fakePull(nil), e.pulls...), append([]fakeBuild(nil), e.builds...), append([]fakeExec(nil), e.execs...), containers
+}
+
+func (e *fakeEngine) pull(imageName string, username string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.images[imageName] = true
+	e.pulls = append(e.pulls, fakePull{Image: imageName, Username: username})
+}
+
+// build records the build, the build context has to be a tar archive if it's sent
+func (e *fakeEngine) build(build fakeBuild, buildContext io.Reader) {
+	if buildContext != nil {
+		io.Copy(io.Discard, buildContext)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.images[build.Tag] = true
+	e.builds = append(e.builds, build)
+}
+
+func (e *fakeEngine) imageExists(imageName string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.images[imageName]
+}
+
+func (e *fakeEngine) create(c *fakeContainer) string {
+	sort.Strings(c.Env)
+	sort.Strings(c.Binds)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastId++
+	id := fmt.Sprintf("%064x", e.lastId)
+	e.containers[id] = c
+	return id
+}
+
+func (e *fakeEngine) setRunning(id string, running bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c, ok := e.containers[id]
+	if !ok {
+		return fmt.Errorf("no such container %s", id)
+	}
+	c.Running = running
+	return nil
+}
+
+func (e *fakeEngine) remove(id string, force bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c, ok := e.containers[id]
+	if !ok {
+		return fmt.Errorf("no such container %s", id)
+	}
+	if c.Running && !force {
+		return fmt.Errorf("container %s is running", id)
+	}
+	delete(e.containers, id)
+	return nil
+}
+
+// list returns the ids of the containers with all the labels, given as name=value, sorted
+func (e *fakeEngine) list(labels []string, all bool) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var ids []string
+	for id, c := range e.containers {
+		matches := all || c.Running
+		for _, label := range labels {
+			name, value, _ := strings.Cut(label, "=")
+			matches = matches && c.Labels[name] == value
+		}
+		if matches {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (e *fakeEngine) exec(exec fakeExec) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if c, ok := e.containers[exec.Container]; !ok || !c.Running {
+		return fmt.Errorf("container %s is not running", exec.Container)
+	}
+	e.execs = append(e.execs, exec)
+	return nil
+}
+
+// hijack takes over the connection and streams the output of the exec session
+func hijack(w http.ResponseWriter, mediaType string) {
+	conn, buffered, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer conn.Close()
+	fmt.Fprintf(buffered, "HTTP/1.1 101 UPGRADED\r\nContent-Type: %s\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n", mediaType)
+	buffered.WriteString(fakeExecOutput)
+	buffered.Flush()
+}
+
+// registryUser returns the user of the X-Registry-Auth header
+func registryUser(r *http.Request) string {
+	data, err := base64.URLEncoding.DecodeString(r.Header.Get("X-Registry-Auth"))
+	if err != nil {
+		return ""
+	}
+	var auth struct {
+		Username string `json:"username"`
+	}
+	json.Unmarshal(data, &auth)
+	return auth.Username
+}
+
+func joinBind(source string, destination string, options []string) string {
+	bind := destination
+	if source != "" {
+		bind = source + ":" + destination
+	}
+	if len(options) > 0 {
+		bind += ":" + strings.Join(options, ",")
+	}
+	return bind
+}
+
+func setArg(args map[string]string, name string, value string) map[string]string {
+	if args == nil {
+		args = make(map[string]string)
+	}
+	args[name] = value
+	return args
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
@@ -0,0 +1,393 @@
+package shared
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// podmanApiVersion is the version of the libpod API the client speaks, podman 4 and later serve it
+const podmanApiVersion = "v4.0.0"
+
+type (
+	// PodmanClient drives podman through the libpod REST API on its unix socket, see `podman system service`
+	PodmanClient struct {
+		socket string
+		http   *http.Client
+	}
+
+	// podmanSpec is the part of the libpod SpecGenerator the agent containers need
+	podmanSpec struct {
+		Image      string                 `json:"image"`
+		Entrypoint []string               `json:"entrypoint,omitempty"`
+		Terminal   bool                   `json:"terminal,omitempty"`
+		Env        map[string]string      `json:"env,omitempty"`
+		User       string                 `json:"user,omitempty"`
+		WorkDir    string                 `json:"work_dir,omitempty"`
+		Labels     map[string]string      `json:"labels,omitempty"`
+		Mounts     []podmanMount          `json:"mounts,omitempty"`
+		Volumes    []podmanVolume         `json:"volumes,omitempty"`
+		NetNS      *podmanNamespace       `json:"netns,omitempty"`
+		Networks   map[string]interface{} `json:"Networks,omitempty"`
+		Privileged bool                   `json:"privileged,omitempty"`
+	}
+
+	podmanMount struct {
+		Destination string   `json:"destination"`
+		Type        string   `json:"type"`
+		Source      string   `json:"source"`
+		Options     []string `json:"options,omitempty"`
+	}
+
+	podmanVolume struct {
+		Name    string   `json:"Name"`
+		Dest    string   `json:"Dest"`
+		Options []string `json:"Options,omitempty"`
+	}
+
+	podmanNamespace struct {
+		NSMode string `json:"nsmode"`
+		Value  string `json:"value,omitempty"`
+	}
+
+	podmanExecConfig struct {
+		AttachStdout bool     `json:"AttachStdout"`
+		AttachStderr bool     `json:"AttachStderr"`
+		Cmd          []string `json:"Cmd"`
+		Env          []string `json:"Env,omitempty"`
+		WorkingDir   string   `json:"WorkingDir,omitempty"`
+	}
+
+	// podmanId is the response of the endpoints which create containers and exec sessions
+	podmanId struct {
+		Id string `json:"Id"`
+	}
+)
+
+// NewPodmanClient connects to the socket of CONTAINER_HOST, by default to the one of the rootless service
+// of the user or to the system one
+func NewPodmanClient(ctx context.Context) (DockerClient, error) {
+	host := os.Getenv("CONTAINER_HOST")
+	if host == "" {
+		host = "unix:///run/podman/podman.sock"
+		if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" && os.Getuid() != 0 {
+			host = "unix://" + filepath.Join(runtimeDir, "podman", "podman.sock")
+		}
+	}
+	socket, ok := strings.CutPrefix(host, "unix://")
+	if !ok {
+		return nil, fmt.Errorf("failed to create Podman client: only unix sockets are supported, got %s", host)
+	}
+	return newPodmanClient(socket), nil
+}
+
+func newPodmanClient(socket string) *PodmanClient {
+	return &PodmanClient{
+		socket: socket,
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+func (p *PodmanClient) Pull(ctx context.Context, imageName string, auth *RegistryAuth) (io.ReadCloser, error) {
+	header := http.Header{}
+	if auth != nil {
+		registryAuth, err := auth.encode()
+		if err != nil {
+			return nil, err
+		}
+		header.Set("X-Registry-Auth", registryAuth)
+	}
+	resp, err := p.do(ctx, http.MethodPost, "/images/pull", url.Values{"reference": {buildImageWithTag(imageName)}}, nil, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull Podman image %s: %w", imageName, err)
+	}
+	return resp.Body, nil
+}
+
+// BuildImage: same as `podman build`, the directory is sent as the build context
+func (p *PodmanClient) BuildImage(ctx context.Context, options BuildOptions) (io.ReadCloser, error) {
+	query := url.Values{
+		"t":          {options.Tag},
+		"dockerfile": {filepath.ToSlash(options.Dockerfile)},
+		"pull":       {strconv.FormatBool(options.Pull)},
+		"nocache":    {strconv.FormatBool(options.NoCache)},
+		"rm":         {"true"},
+	}
+	if options.Target != "" {
+		query.Set("target", options.Target)
+	}
+	if len(options.BuildArgs) > 0 {
+		buildArgs := make(map[string]string, len(options.BuildArgs))
+		for name, value := range options.BuildArgs {
+			if value != nil {
+				buildArgs[name] = *value
+			}
+		}
+		encoded, err := json.Marshal(buildArgs)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("buildargs", string(encoded))
+	}
+
+	buildContext, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(tarContext(options.ContextDir, writer))
+	}()
+	resp, err := p.do(ctx, http.MethodPost, "/build", query, buildContext, http.Header{"Content-Type": {"application/x-tar"}})
+	if err != nil {
+		buildContext.Close()
+		return nil, fmt.Errorf("failed to build Podman image %s: %w", options.Tag, err)
+	}
+	return resp.Body, nil
+}
+
+// ImageExists: same as `podman image exists`
+func (p *PodmanClient) ImageExists(ctx context.Context, imageName string) (bool, error) {
+	resp, err := p.do(ctx, http.MethodGet, "/images/"+imageName+"/exists", nil, nil, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// RunContainer: same as `podman run`
+func (p *PodmanClient) RunContainer(ctx context.Context, imageName string, options RunOptions) (string, error) {
+	spec := podmanSpec{
+		Image:      imageName,
+		Entrypoint: []string{"sh"},
+		Terminal:   true,
+		User:       options.User,
+		WorkDir:    options.Workdir,
+		Labels:     options.Labels,
+		Privileged: options.Privileged,
+	}
+	if len(options.Env) > 0 {
+		spec.Env = make(map[string]string, len(options.Env))
+		for _, variable := range options.Env {
+			name, value, _ := strings.Cut(variable, "=")
+			spec.Env[name] = value
+		}
+	}
+	for _, bind := range options.Binds {
+		parts := strings.SplitN(bind, ":", 3)
+		var mountOptions []string
+		if len(parts) == 3 {
+			mountOptions = strings.Split(parts[2], ",")
+		}
+		switch {
+		case len(parts) == 1:
+			// an anonymous volume
+			spec.Volumes = append(spec.Volumes, podmanVolume{Dest: parts[0]})
+		case strings.HasPrefix(parts[0], "/") || strings.HasPrefix(parts[0], "."):
+			spec.Mounts = append(spec.Mounts, podmanMount{Destination: parts[1], Type: "bind", Source: parts[0], Options: mountOptions})
+		default:
+			spec.Volumes = append(spec.Volumes, podmanVolume{Name: parts[0], Dest: parts[1], Options: mountOptions})
+		}
+	}
+	switch mode, value, _ := strings.Cut(options.Network, ":"); mode {
+	case "", "bridge":
+	case "host", "none", "container", "ns":
+		spec.NetNS = &podmanNamespace{NSMode: mode, Value: value}
+	default:
+		spec.NetNS = &podmanNamespace{NSMode: "bridge"}
+		spec.Networks = map[string]interface{}{options.Network: struct{}{}}
+	}
+
+	var created podmanId
+	if err := p.call(ctx, http.MethodPost, "/containers/create", nil, spec, &created); err != nil {
+		return "", fmt.Errorf("failed to create Podman container: %w", err)
+	}
+	if err := p.call(ctx, http.MethodPost, "/containers/"+created.Id+"/start", nil, nil, nil); err != nil {
+		return "", fmt.Errorf("failed to start Podman container: %w", err)
+	}
+	return created.Id, nil
+}
+
+// ExecContainer: same as `podman exec`, the command runs in workdir or in the working directory of the container
+func (p *PodmanClient) ExecContainer(ctx context.Context, containerId string, cmd []string, env []string, workdir string) (*types.HijackedResponse, error) {
+	var exec podmanId
+	err := p.call(ctx, http.MethodPost, "/containers/"+containerId+"/exec", nil, podmanExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+		Env:          env,
+		WorkingDir:   workdir,
+	}, &exec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec instance for command '%v': %w", cmd, err)
+	}
+
+	resp, err := p.hijack(ctx, "/exec/"+exec.Id+"/start", map[string]bool{"Detach": false, "Tty": false})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start exec instance for command '%v': %w", cmd, err)
+	}
+	return resp, nil
+}
+
+func (p *PodmanClient) StopContainer(ctx context.Context, containerId string) error {
+	if err := p.call(ctx, http.MethodPost, "/containers/"+containerId+"/stop", nil, nil, nil); err != nil {
+		return err
+	}
+	return p.call(ctx, http.MethodDelete, "/containers/"+containerId, nil, nil, nil)
+}
+
+func (p *PodmanClient) FindContainer(ctx context.Context, labels map[string]string) (string, error) {
+	containers, err := p.listContainers(ctx, labels, false)
+	if err != nil || len(containers) == 0 {
+		return "", err
+	}
+	return containers[0].Id, nil
+}
+
+func (p *PodmanClient) RemoveContainers(ctx context.Context, labels map[string]string) error {
+	containers, err := p.listContainers(ctx, labels, true)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, c := range containers {
+		errs = append(errs, p.call(ctx, http.MethodDelete, "/containers/"+c.Id, url.Values{"force": {"true"}}, nil, nil))
+	}
+	return errors.Join(errs...)
+}
+
+func (p *PodmanClient) Stop() error {
+	p.http.CloseIdleConnections()
+	return nil
+}
+
+func (p *PodmanClient) listContainers(ctx context.Context, labels map[string]string, all bool) ([]podmanId, error) {
+	var labelFilters []string
+	for name, value := range labels {
+		labelFilters = append(labelFilters, name+"="+value)
+	}
+	filters, err := json.Marshal(map[string][]string{"label": labelFilters})
+	if err != nil {
+		return nil, err
+	}
+	var containers []podmanId
+	err = p.call(ctx, http.MethodGet, "/containers/json", url.Values{"all": {strconv.FormatBool(all)}, "filters": {string(filters)}}, nil, &containers)
+	return containers, err
+}
+
+// call sends the request body as JSON and decodes the JSON response into out, if it's given
+func (p *PodmanClient) call(ctx context.Context, method string, path string, query url.Values, in interface{}, out interface{}) error {
+	var body io.Reader
+	header := http.Header{}
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.do(ctx, method, path, query, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// do sends the request to the libpod API, a response with an error status is returned along with the error
+func (p *PodmanClient) do(ctx context.Context, method string, path string, query url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.url(path, query), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to Podman at %s: %w", p.socket, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return resp, responseError(resp)
+	}
+	return resp, nil
+}
+
+// hijack starts a request which output is streamed over the connection, like the attached exec sessions
+func (p *PodmanClient) hijack(ctx context.Context, path string, in interface{}) (*types.HijackedResponse, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url(path, nil), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", p.socket)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to Podman at %s: %w", p.socket, err)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		defer conn.Close()
+		return nil, responseError(resp)
+	}
+	// the output follows the headers on the connection
+	return &types.HijackedResponse{Conn: conn, Reader: reader}, nil
+}
+
+func (p *PodmanClient) url(path string, query url.Values) string {
+	u := url.URL{Scheme: "http", Host: "podman", Path: "/" + podmanApiVersion + "/libpod" + path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// responseError returns the message of an error response, engines send it as {"message": "..."}
+func responseError(resp *http.Response) error {
+	var body struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(data, &body) == nil && body.Message != "" {
+		return fmt.Errorf("%s (status %d)", body.Message, resp.StatusCode)
+	}
+	return fmt.Errorf("%s (status %d)", strings.TrimSpace(string(data)), resp.StatusCode)
+}
@@ -0,0 +1,122 @@
+package shared
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types/registry"
+)
+
+type (
+	// RunOptions are the settings of the agent container, mostly taken from the args of the docker agent
+	RunOptions struct {
+		// Binds are the volumes, e.g. /cache:/cache:ro
+		Binds      []string
+		Env        []string
+		Network    string
+		User       string
+		Workdir    string
+		Privileged bool
+		// Labels tell the containers kept across the stages of a build apart
+		Labels map[string]string
+	}
+
+	// RegistryAuth is the account images are pulled with
+	RegistryAuth struct {
+		ServerAddress string
+		Username      string
+		Password      string
+	}
+)
+
+// ParseArgs adds the arguments given to `docker run`, e.g. the args of the docker agent: -v, -e, --network,
+// -u, -w and --privileged are supported, with their long forms
+func (options *RunOptions) ParseArgs(args string) error {
+	words, err := splitArgs(args)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(words); i++ {
+		name, value, hasValue := strings.Cut(words[i], "=")
+		if name == "--privileged" {
+			options.Privileged = true
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(words) {
+				return fmt.Errorf("%s requires a value", name)
+			}
+			i++
+			value = words[i]
+		}
+
+		switch name {
+		case "-v", "--volume":
+			options.Binds = append(options.Binds, value)
+		case "-e", "--env":
+			// a variable without a value takes the one of the environment
+			if !strings.Contains(value, "=") {
+				envValue, found := os.LookupEnv(value)
+				if !found {
+					continue
+				}
+				value += "=" + envValue
+			}
+			options.Env = append(options.Env, value)
+		case "--network", "--net":
+			options.Network = value
+		case "-u", "--user":
+			options.User = value
+		case "-w", "--workdir":
+			options.Workdir = value
+		default:
+			return fmt.Errorf("unsupported docker run argument %s", name)
+		}
+	}
+	return nil
+}
+
+// encode returns the X-Registry-Auth header of the account
+func (auth *RegistryAuth) encode() (string, error) {
+	data, err := json.Marshal(registry.AuthConfig{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		ServerAddress: auth.ServerAddress,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(data), nil
+}
+
+// RegistryImage returns the name of the image in the registry, e.g. registry.example.com/maven for
+// https://registry.example.com/ and maven. Images which name a registry already are left as they are.
+func RegistryImage(registryUrl string, imageName string) string {
+	host := RegistryHost(registryUrl)
+	if host == "" {
+		return imageName
+	}
+	if first, _, ok := strings.Cut(imageName, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return imageName
+	}
+	return host + "/" + imageName
+}
+
+// RegistryHost returns the host, and the port, of the registry url
+func RegistryHost(registryUrl string) string {
+	if registryUrl == "" {
+		return ""
+	}
+	if !strings.Contains(registryUrl, "://") {
+		registryUrl = "https://" + registryUrl
+	}
+	parsed, err := url.Parse(registryUrl)
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
+}
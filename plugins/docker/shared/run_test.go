@@ -0,0 +1,65 @@
+package shared
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRunArgs(t *testing.T) {
+	t.Setenv("GOPROXY", "https://proxy.golang.org")
+
+	var options RunOptions
+	err := options.ParseArgs(`-v /cache:/cache --volume=/root/.m2:/root/.m2:ro -e "GREETING=hello world" --env GOPROXY -e UNSET --network host -u 1000:1000 -w /src --privileged`)
+	if err != nil {
+		t.Fatalf("Failed to parse run args: %v", err)
+	}
+	want := RunOptions{
+		Binds:      []string{"/cache:/cache", "/root/.m2:/root/.m2:ro"},
+		Env:        []string{"GREETING=hello world", "GOPROXY=https://proxy.golang.org"},
+		Network:    "host",
+		User:       "1000:1000",
+		Workdir:    "/src",
+		Privileged: true,
+	}
+	if diff := cmp.Diff(options, want); diff != "" {
+		t.Errorf("Run options are not equal (-got +want):\n%s", diff)
+	}
+
+	for _, invalid := range []string{"--rm", "-v", "--cpus 2"} {
+		if err := (&RunOptions{}).ParseArgs(invalid); err == nil {
+			t.Errorf("Parsing %q should fail", invalid)
+		}
+	}
+}
+
+func TestRegistryImage(t *testing.T) {
+	tests := []struct {
+		registryUrl, imageName, want string
+	}{
+		{"", "maven:3.9", "maven:3.9"},
+		{"https://registry.example.com/", "maven:3.9", "registry.example.com/maven:3.9"},
+		{"registry.example.com:5000", "team/maven", "registry.example.com:5000/team/maven"},
+		{"https://registry.example.com/", "other.example.com/maven", "other.example.com/maven"},
+		{"https://registry.example.com/", "localhost/maven", "localhost/maven"},
+	}
+	for _, test := range tests {
+		if got := RegistryImage(test.registryUrl, test.imageName); got != test.want {
+			t.Errorf("RegistryImage(%q, %q) = %q, want %q", test.registryUrl, test.imageName, got, test.want)
+		}
+	}
+}
+
+func TestBuildImageWithTag(t *testing.T) {
+	tests := map[string]string{
+		"maven":                               "maven:latest",
+		"maven:3.9":                           "maven:3.9",
+		"registry.example.com:5000/maven":     "registry.example.com:5000/maven:latest",
+		"registry.example.com:5000/maven:3.9": "registry.example.com:5000/maven:3.9",
+	}
+	for imageName, want := range tests {
+		if got := buildImageWithTag(imageName); got != want {
+			t.Errorf("buildImageWithTag(%q) = %q, want %q", imageName, got, want)
+		}
+	}
+}
@@ -27,6 +27,8 @@ type PluginManager struct {
 var (
 	instance *PluginManager
 	once     sync.Once
+
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
 )
 
 func GetInstance() *PluginManager {
@@ -60,6 +62,20 @@ func (pm *PluginManager) Register(ctx context.Context, name string, plugin Plugi
 	return nil
 }
 
+// Declare records the methods of a plugin without starting it, so that steps can be validated
+// by processes which don't execute them, e.g. the API or the linter
+func (pm *PluginManager) Declare(name string, plugin Plugin) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	for methodName, methodFunc := range plugin.ListMethods() {
+		pm.methodToInfo[methodName] = MethodInfo{
+			pluginName: name,
+			funcName:   methodFunc,
+		}
+	}
+}
+
 func (pm *PluginManager) Unregister(name string) error {
 	plugin, exists := pm.plugins[name]
 	if !exists {
@@ -102,7 +118,9 @@ func (pm *PluginManager) GetPluginInfo(methodName string) (string, string, bool)
 	return "", "", false
 }
 
-func (pm *PluginManager) Execute(pluginName string, methodName string, args map[string]interface{}) (interface{}, error) {
+// Execute calls the method of the plugin with args. Methods which take a context.Context first receive ctx,
+// so that they can stop when the step is cancelled.
+func (pm *PluginManager) Execute(ctx context.Context, pluginName string, methodName string, args map[string]interface{}) (interface{}, error) {
 	pm.lock.RLock()
 	plugin, exists := pm.plugins[pluginName]
 	pm.lock.RUnlock()
@@ -122,6 +140,9 @@ func (pm *PluginManager) Execute(pluginName string, methodName string, args map[
 	//     inputArgs[i] = reflect.ValueOf(arg)
 	// }
 	inputArgs := []reflect.Value{reflect.ValueOf(args)}
+	if method.Type().NumIn() == 2 && method.Type().In(0) == contextType {
+		inputArgs = []reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(args)}
+	}
 
 	// Call the method and handle results
 	results := method.Call(inputArgs)
@@ -74,4 +74,9 @@ func (p *ScmPlugin) ListMethods() map[string]string {
 
 func (scmClient *ScmPlugin) Checkout(args map[string]interface{}) (string, error) {
 	return scmClient.scm.Checkout(args)
+}
+
+// RemoteHead asks the remote repository which commit the branch points to, e.g. to poll for changes
+func (scmClient *ScmPlugin) RemoteHead(args map[string]interface{}) (string, error) {
+	return scmClient.scm.RemoteHead(args)
 }
\ No newline at end of file
@@ -11,12 +11,16 @@ import (
 	"strings"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
 )
 
 type Git interface {
-	CloneOrPull(url string, branch string, authMethod transport.AuthMethod) error
+	// CloneOrPull clones the branch into the workspace, or pulls it if it's there already
+	CloneOrPull(workspace string, url string, branch string, authMethod transport.AuthMethod) error
+	RemoteHead(url string, branch string, authMethod transport.AuthMethod) (string, error)
 }
 
 type GitRepo struct {
@@ -29,12 +33,12 @@ type GitRepo struct {
 	ProgressWriter io.Writer
 }
 
-func (r *GitRepo) CloneOrPull(url string, branch string, authMethod transport.AuthMethod) error {
+func (r *GitRepo) CloneOrPull(workspace string, url string, branch string, authMethod transport.AuthMethod) error {
 	cloneDir, err := DeriveCloneDir(url)
 	if err != nil {
 		return err
 	}
-	cloneDir = filepath.Join(os.Getenv("WORKSPACE"), cloneDir)
+	cloneDir = filepath.Join(workspace, cloneDir)
 
 	if _, err := os.Stat(cloneDir); os.IsNotExist(err) {
 		// Clone the repository
@@ -89,6 +93,26 @@ func (r *GitRepo) pullRepo(cloneDir string, branch string, authMethod transport.
 	return err
 }
 
+// RemoteHead lists the references of the remote repository, like git ls-remote, and returns the commit of the branch
+func (r *GitRepo) RemoteHead(url string, branch string, authMethod transport.AuthMethod) (string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{url},
+	})
+	refs, err := remote.List(&git.ListOptions{Auth: authMethod})
+	if err != nil {
+		return "", fmt.Errorf("failed to list remote references: %w", err)
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(branch)
+	for _, ref := range refs {
+		if ref.Name() == branchRef {
+			return ref.Hash().String(), nil
+		}
+	}
+	return "", fmt.Errorf("branch %s not found in %s", branch, url)
+}
+
 // deriveCloneDir derives a clone directory name from a Git repository URL.
 func DeriveCloneDir(repoURL string) (string, error) {
 
@@ -52,11 +52,43 @@ var (
 )
 
 func (g *ScmPluginImpl) Checkout(args map[string]interface{}) (string, error) {
+	url, branch, authMethod, err := g.parseArgs(args)
+	if err != nil {
+		return "", err
+	}
+
+	g.logger.Info("PluginImpl Checkout %s...", url)
+	g.logger.Info("PluginImpl auth method %s:%s...", authMethod.Name(), authMethod.String())
+
+	// the workspace of the build, $WORKSPACE when the step runs outside of one
+	workspace, ok := args["workspace"].(string)
+	if !ok || workspace == "" {
+		workspace = os.Getenv("WORKSPACE")
+	}
+	if err := g.git.CloneOrPull(workspace, url, branch, authMethod); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Cloned repo %s and branch %s", url, branch), nil
+}
+
+func (g *ScmPluginImpl) RemoteHead(args map[string]interface{}) (string, error) {
+	url, branch, authMethod, err := g.parseArgs(args)
+	if err != nil {
+		return "", err
+	}
+
+	g.logger.Info("PluginImpl RemoteHead %s...", url)
+	return g.git.RemoteHead(url, branch, authMethod)
+}
+
+// parseArgs reads the repository, the branch and the auth method from the arguments of the git step
+func (g *ScmPluginImpl) parseArgs(args map[string]interface{}) (string, string, transport.AuthMethod, error) {
 	if _, ok := args["url"]; !ok {
-		return "", fmt.Errorf("url is missing")
+		return "", "", nil, fmt.Errorf("url is missing")
 	}
 	if _, ok := args["branch"]; !ok {
-		return "", fmt.Errorf("git branch is missing")
+		return "", "", nil, fmt.Errorf("git branch is missing")
 	}
 
 	url := args["url"].(string)
@@ -67,7 +99,7 @@ func (g *ScmPluginImpl) Checkout(args map[string]interface{}) (string, error) {
 		crypto := cryptography.GetInstance()
 		credentials = crypto.GetCredentialsById(credentialsId)
 		if credentials == nil {
-			return "", fmt.Errorf("credentials not found by id %s", credentialsId)
+			return "", "", nil, fmt.Errorf("credentials not found by id %s", credentialsId)
 		}
 
 		g.logger.Info("PluginImpl credentialsId:", credentialsId)
@@ -79,15 +111,7 @@ func (g *ScmPluginImpl) Checkout(args map[string]interface{}) (string, error) {
 		generateAuth := authMethods["ssh"]
 		authMethod = generateAuth(credentials)
 	}
-
-	g.logger.Info("PluginImpl Checkout %s...", url)
-	g.logger.Info("PluginImpl auth method %s:%s...", authMethod.Name(), authMethod.String())
-
-	if err := g.git.CloneOrPull(url, branch, authMethod); err != nil {
-		return "", err
-	}
-
-	return fmt.Sprintf("Cloned repo %s and branch %s", url, branch), nil
+	return url, branch, authMethod, nil
 }
 
 var handshakeConfig = plugin.HandshakeConfig{
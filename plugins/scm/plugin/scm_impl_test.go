@@ -15,10 +15,14 @@ import (
 type GitMock struct {
 }
 
-func (r *GitMock) CloneOrPull(url string, branch string, authMethod transport.AuthMethod) error {
+func (r *GitMock) CloneOrPull(workspace string, url string, branch string, authMethod transport.AuthMethod) error {
     return nil
 }
 
+func (r *GitMock) RemoteHead(url string, branch string, authMethod transport.AuthMethod) (string, error) {
+	return "0123456789abcdef0123456789abcdef01234567", nil
+}
+
 func Test_checkout_ssh_auth(t *testing.T) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
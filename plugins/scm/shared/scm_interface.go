@@ -9,6 +9,8 @@ import (
 
 type Scm interface {
 	Checkout(args map[string]interface{}) (string, error)
+	// RemoteHead returns the commit the branch points to in the remote repository, without cloning it
+	RemoteHead(args map[string]interface{}) (string, error)
 }
 
 // Here is an implementation that talks over RPC
@@ -29,6 +31,18 @@ func (g *ScmRPCClient) Checkout(args map[string]interface{}) (string, error) {
 	return result, nil
 }
 
+func (g *ScmRPCClient) RemoteHead(args map[string]interface{}) (string, error) {
+	var resp []string
+	err := g.client.Call("Plugin.RemoteHead", args, &resp)
+	if err != nil {
+		return "", err
+	}
+	if resp[1] != "" {
+		return "", errors.New(resp[1])
+	}
+	return resp[0], nil
+}
+
 type ScmRPCServer struct {
 	// This is the real implementation
 	Impl Scm
@@ -45,6 +59,17 @@ func (s *ScmRPCServer) Checkout(args map[string]interface{}, resp *[]string) err
 	return nil
 }
 
+func (s *ScmRPCServer) RemoteHead(args map[string]interface{}, resp *[]string) error {
+	r, err := s.Impl.RemoteHead(args)
+
+	var errMessage string
+	if err != nil {
+		errMessage = err.Error()
+	}
+	*resp = []string{r, errMessage}
+	return nil
+}
+
 type ScmPlugin struct {
 	// Impl Injection
 	Impl Scm
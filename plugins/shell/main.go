@@ -97,13 +97,14 @@ func (p *ShellPlugin) ListMethods() map[string]string {
 	}
 }
 
-func (scmClient *ShellPlugin) Echo(args map[string]interface{}) error {
+func (scmClient *ShellPlugin) Echo(ctx context.Context, args map[string]interface{}) error {
 	workflowExecutionId, ok := args["workflowExecutionId"].(string)
 	if !ok {
 		return errors.New("unable to redirect ShellPlugin.Echo output. 'workflowExecutionId' not found")
 	}
 
-	serverStream, err := scmClient.shell.Echo(scmClient.ctx, args)
+	// cancelling ctx cancels the stream and the command run by the plugin
+	serverStream, err := scmClient.shell.Echo(ctx, args)
 	if err != nil {
 		return err
 	}
@@ -115,13 +116,14 @@ func (scmClient *ShellPlugin) Echo(args map[string]interface{}) error {
 	})
 }
 
-func (scmClient *ShellPlugin) Sh(args map[string]interface{}) error {
+func (scmClient *ShellPlugin) Sh(ctx context.Context, args map[string]interface{}) error {
 	workflowExecutionId, ok := args["workflowExecutionId"].(string)
 	if !ok {
 		return errors.New("unable to redirect ShellPlugin.Sh output. 'workflowExecutionId' not found")
 	}
 
-	serverStream, err := scmClient.shell.Sh(scmClient.ctx, args)
+	// cancelling ctx cancels the stream and the command run by the plugin
+	serverStream, err := scmClient.shell.Sh(ctx, args)
 	if err != nil {
 		return err
 	}
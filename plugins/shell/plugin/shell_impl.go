@@ -23,22 +23,30 @@ import (
 
 type ShellPluginImpl struct {
 	logger hclog.Logger
-	docker docker.DockerClient
+	// docker connects to the engine of each container, given by its id
+	docker *docker.Clients
 }
 
+// Echo prints the text like the other steps run, with the environment of the build and in the agent container.
+// The text is already interpolated, so it's passed as an argument and the shell doesn't expand it again.
 func (g *ShellPluginImpl) Echo(req *pb.ShellRequest, res grpc.ServerStreamingServer[pb.ShellResponse]) error {
-	return g.execShell(req, res)
+	return g.execShell(req, res, []string{"sh", "-c", `printf '%s\n' "$1"`, "echo", req.Command})
 }
 
 func (g *ShellPluginImpl) Sh(req *pb.ShellRequest, res grpc.ServerStreamingServer[pb.ShellResponse]) error {
-	return g.execShell(req, res)	
+	// scripts may span multiple lines, so they are run by the shell and stop at the first failing command
+	return g.execShell(req, res, []string{"sh", "-e", "-c", req.Command})
 }
 
-func (g *ShellPluginImpl) execShell(req *pb.ShellRequest, res grpc.ServerStreamingServer[pb.ShellResponse]) error {
+func (g *ShellPluginImpl) execShell(req *pb.ShellRequest, res grpc.ServerStreamingServer[pb.ShellResponse], terms []string) error {
 	g.logger.Info("[Shell] sh '%s'...", req.Command)
-	terms := strings.Fields(req.Command)
-	
-	cmd := exec.Command(terms[0], terms[1:]...)
+
+	// the request context is cancelled when the step is aborted, which kills the process
+	cmd := exec.CommandContext(res.Context(), terms[0], terms[1:]...)
+	cmd.Env = append(os.Environ(), req.Env...)
+	// scripts run in the workspace of the build, it's mounted at the same path in agent containers
+	workspace := lookupEnv(req.Env, "WORKSPACE")
+	cmd.Dir = workspace
 	inputStreamConsumer, closeStreamConsumer := func() (*bufio.Scanner, error) {
 		stdout, err := cmd.StdoutPipe()
 		cmd.Stderr = cmd.Stdout
@@ -56,12 +64,21 @@ func (g *ShellPluginImpl) execShell(req *pb.ShellRequest, res grpc.ServerStreami
 	if (req.ContainerId != "") {
 		var attachResp *types.HijackedResponse = nil
 		inputStreamConsumer, closeStreamConsumer = func() (*bufio.Scanner, error) {
-			var err error
-			attachResp, err = g.docker.ExecContainer(context.Background(), req.ContainerId, terms)
+			engine, containerId := docker.SplitContainerId(req.ContainerId)
+			client, err := g.docker.Get(context.Background(), engine)
+			if err != nil {
+				return nil, err
+			}
+			attachResp, err = client.ExecContainer(context.Background(), containerId, terms, req.Env, workspace)
 
 			if err != nil {
 				return nil, fmt.Errorf("error attaching to container %s: %v", req.ContainerId, err)
 			}
+			// stop reading on abort, the process itself goes away with the agent container
+			go func() {
+				<-res.Context().Done()
+				attachResp.Close()
+			}()
 			return bufio.NewScanner(attachResp.Reader), nil
 		}, func() error {
 			attachResp.Close()
@@ -97,6 +114,17 @@ func (g *ShellPluginImpl) readAndSendBack(scanner *bufio.Scanner, res grpc.Serve
 	return scanner.Err()
 }
 
+// lookupEnv returns the value of the variable in a list of KEY=VALUE pairs, the last one wins like in os/exec
+func lookupEnv(env []string, name string) string {
+	value := ""
+	for _, pair := range env {
+		if key, v, ok := strings.Cut(pair, "="); ok && key == name {
+			value = v
+		}
+	}
+	return value
+}
+
 // RemoveControlChars removes non-printable ASCII characters from byte array and return human readble string.
 func removeControlChars(input []byte) []byte {
 	return bytes.Map(func(r rune) rune {
@@ -120,14 +148,12 @@ func main() {
 		JSONFormat: true,
 	})
 
-	dockerClient, err := docker.NewDockerClient(context.Background())
-	if err != nil {
-		logger.Warn("error initializing docker client %v", err)
-	}
-	defer dockerClient.Stop()
+	// the container engines are connected once a step runs in one of their containers
+	dockerClients := docker.NewClients()
+	defer dockerClients.Stop()
 
 	shellImpl := &ShellPluginImpl{
-		docker: dockerClient,
+		docker: dockerClients,
 		logger: logger,
 	}
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"io"
 	"os"
 	"testing"
@@ -18,6 +19,10 @@ func (r *DummyResponse) Send(resp *proto.ShellResponse) error {
 	return nil
 }
 
+func (r *DummyResponse) Context() context.Context {
+	return context.Background()
+}
+
 func Test_shell_command(t *testing.T) {
 
 	logger := hclog.New(&hclog.LoggerOptions{
@@ -48,3 +53,35 @@ func Test_shell_command(t *testing.T) {
 		t.Fatalf("Error executing plugin: %v", err)
 	}
 }
+
+// recordingResponse keeps the chunks sent back by the plugin
+type recordingResponse struct {
+	DummyResponse
+	chunks []string
+}
+
+func (r *recordingResponse) Send(resp *proto.ShellResponse) error {
+	r.chunks = append(r.chunks, resp.Chunk)
+	return nil
+}
+
+func Test_echo_command(t *testing.T) {
+	shellImpl := &ShellPluginImpl{
+		logger: hclog.NewNullLogger(),
+	}
+
+	res := &recordingResponse{}
+	err := shellImpl.Echo(&proto.ShellRequest{
+		Command: "Deploying $TARGET to 'staging'\nline two",
+		Env:     []string{"TARGET=prod"},
+	}, res)
+	if err != nil {
+		t.Fatalf("Error executing plugin: %v", err)
+	}
+
+	// the text is interpolated by the workflow, the shell prints it as is
+	want := []string{"Deploying $TARGET to 'staging'", "line two"}
+	if len(res.chunks) != len(want) || res.chunks[0] != want[0] || res.chunks[1] != want[1] {
+		t.Errorf("Expected %q, got %q", want, res.chunks)
+	}
+}
@@ -26,22 +26,26 @@ type ShellRPCClient struct {
 
 func (g *ShellRPCClient) Echo(ctx context.Context, args map[string]interface{}) (grpc.ServerStreamingClient[pb.ShellResponse], error) {
 
-	cmd := "echo " + args["text"].(string)
+	cmd := args["text"].(string)
 	containerId, _ := args["containerId"].(string)
+	env, _ := args["env"].([]string)
 	
-	return g.client.Echo(context.Background(), &pb.ShellRequest{
+	return g.client.Echo(ctx, &pb.ShellRequest{
 		Command:     cmd,
 		ContainerId: containerId,
+		Env:         env,
 	})
 }
 
 func (g *ShellRPCClient) Sh(ctx context.Context, args map[string]interface{}) (grpc.ServerStreamingClient[pb.ShellResponse], error) {
 	cmd := args["text"].(string)
 	containerId, _ := args["containerId"].(string)
+	env, _ := args["env"].([]string)
 
 	return g.client.Sh(ctx, &pb.ShellRequest{
 		Command:     cmd,
 		ContainerId: containerId,
+		Env:         env,
 	})
 }
 
@@ -56,7 +60,7 @@ func (s *ShellRPCServer) Echo(request *pb.ShellRequest, response grpc.ServerStre
 }
 
 func (s *ShellRPCServer) Sh(request *pb.ShellRequest, response grpc.ServerStreamingServer[pb.ShellResponse]) error {
-	return s.Impl.Echo(request, response)
+	return s.Impl.Sh(request, response)
 }
 
 type ServerShellPlugin struct {